@@ -0,0 +1,63 @@
+#!/usr/bin/env python3
+"""Time a large generated program with the parse and operand caches on and off."""
+
+from __future__ import annotations
+
+import sys
+import time
+from pathlib import Path
+
+
+ROOT = Path(__file__).resolve().parent
+if str(ROOT) not in sys.path:
+    sys.path.insert(0, str(ROOT))
+
+from modules.AssemblyHelper import AssemblyHelper
+
+
+def generate_program(blocks: int):
+    lines = []
+    for index in range(blocks):
+        lines.extend(
+            [
+                f"block_{index}: LDI #{index % 200}",
+                "MOV RD, RA",
+                f"ADDI #{index % 8}",
+                f"JEQ block_{(index * 7) % blocks}",
+                "PUSHI #0x55",
+            ]
+        )
+    lines.append("HLT")
+    return lines
+
+
+def time_build(source_lines, optimize: bool, cache_parsing: bool, repeats: int):
+    best = None
+    output = None
+    for _ in range(repeats):
+        helper = AssemblyHelper()
+        helper.cache_parsing = cache_parsing
+        started = time.perf_counter()
+        output = helper.convert_to_machine_code(source_lines, optimize=optimize)[0]
+        elapsed = time.perf_counter() - started
+        best = elapsed if best is None else min(best, elapsed)
+    return best, output
+
+
+def main():
+    blocks = int(sys.argv[1]) if len(sys.argv) > 1 else 2000
+    repeats = 3
+    source_lines = generate_program(blocks)
+    print(f"{len(source_lines)} source lines, best of {repeats}")
+
+    for optimize in (False, True):
+        uncached, uncached_output = time_build(source_lines, optimize, cache_parsing=False, repeats=repeats)
+        cached, cached_output = time_build(source_lines, optimize, cache_parsing=True, repeats=repeats)
+        if cached_output != uncached_output:
+            raise SystemExit("caching changed the assembled output")
+        mode = "optimized" if optimize else "canonical"
+        print(f"  {mode:9s}  uncached {uncached:6.3f}s  cached {cached:6.3f}s  speedup {uncached / cached:4.2f}x")
+
+
+if __name__ == "__main__":
+    main()
@@ -6,12 +6,31 @@ for the ArniComp custom ISA architecture.
 
 Usage:
     python main.py assemble <input.asm> [output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
+    python main.py assemble -c <input.asm> [-o output.o]
+    python main.py link <a.o> [b.o ...] [-o output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
     python main.py disassemble <input.txt> [output.asm]
-    python main.py createbin <input.txt> [output.bin]
+    python main.py disasm <image.bin|image.hex|input.txt> [output.asm] [--symbols program.sym]
+    python main.py createbin <input.txt> [output.bin] [--rom-size N] [--fill BYTE] [--split hi,lo|lo,hi|even,odd]
     python main.py createihex <input.asm> [output.hex] [--optimize]
     python main.py createsvhex <input.asm> [output.mem] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
     python main.py createsvmi <input.asm> [output.mi] [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
+    python main.py createmif <input.asm> [output.mif] [--depth N] [--optimize]
+    python main.py createcoe <input.asm> [output.coe] [--depth N] [--optimize]
+    python main.py createlogisim <input.asm> [output.img] [--optimize]
     python main.py creategowinprom <input.asm> <gowin_prom.v> [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
+    python main.py createcarray <input.asm> [output.h] [--array-name NAME] [--optimize]
+    python main.py createcdefines <input.asm> [output.h] [--define-prefix PREFIX] [--mangle] [--optimize]
+    python main.py dumpjson <input.asm> [output.json] [--optimize]
+    python main.py buildmatrix <input.asm> <matrix.txt> [--optimize]
+    python main.py createbase64 <input.asm> [output.b64] [--gzip] [--optimize]
+    python main.py createrecord <input.asm> [output.rec] [--record-width N] [--optimize]
+    python main.py decodebase64 <input.b64> [output.txt]
+    python main.py dumpast "<expression>" [input.asm] [--optimize]
+    python main.py run <program.asm|image.bin|image.hex|input.txt> [--max-steps N] [--stack-base ADDR] [--dump ADDR[:COUNT]] [--device NAME[@ADDR]] [--uart-input TEXT] [--timing] [--symbols program.sym] [--trace trace.log] [--save-state PATH] [--load-state PATH]
+    python main.py debug <program.asm|image.bin|image.hex|input.txt> [--symbols program.sym] [--source-map program.map.json] [--stack-base ADDR]
+    python main.py gdbserver <program.asm|image.bin|image.hex|input.txt> [--port N] [--host ADDR] [--stack-base ADDR] [--device NAME[@ADDR]]
+    python main.py test <program.asm> [--max-steps N] [--stack-base ADDR] [--device NAME[@ADDR]]
+    python main.py flash <program.asm|image.bin|image.hex|input.txt> [--port PORT] [--baud N] [--fill BYTE]
     python main.py load <binary.bin>
     python main.py help
 """
@@ -19,9 +38,90 @@ Usage:
 import sys
 import os
 import re
-from typing import Optional
+from dataclasses import dataclass, field
+from typing import Dict, List, Optional, Tuple
 
 from modules.AssemblyHelper import AssemblyHelper
+from modules.BuildMatrix import parse_define
+from modules.Linker import build_object, link_objects, load_object
+from modules.OutputFormats import format_checksum_line, parse_fill_byte, parse_rom_size, parse_split, split_interleaved
+from modules.Preprocessor import DEFAULT_MAX_INCLUDE_DEPTH, DEFAULT_MAX_MACRO_DEPTH, MacroDefinition
+from modules.ProjectConfig import ProjectConfig, find_project_config, load_project_config
+from modules.SyntaxProfiles import SYNTAX_PROFILES, get_syntax_profile
+from modules.Targets import DEFAULT_TARGET, TARGETS, TARGET_V2, normalize_target
+
+
+@dataclass
+class AssembleArgs:
+    """Parsed arguments shared by the assemble-style commands"""
+    input_file: str
+    output_file: Optional[str] = None
+    depth: Optional[int] = None
+    listing_file: Optional[str] = None
+    listing_mode: str = "hex"
+    optimize: bool = False
+    array_name: str = "rom"
+    define_prefix: str = ""
+    mangle: bool = False
+    gzip: bool = False
+    record_width: int = 4
+    verify_roundtrip: bool = False
+    check_reachability: bool = False
+    crlf: bool = False
+    suggest_optimize: bool = False
+    partial: bool = False
+    placeholder: int = 0x00
+    data_base: int = 0x0000
+    map_file: Optional[str] = None
+    symbols_file: Optional[str] = None
+    source_map_file: Optional[str] = None
+    rom_size: int = 65536
+    group_digits: Optional[int] = None
+    group_separator: str = "_"
+    byteswap: bool = False
+    append_crc: bool = False
+    stats: bool = False
+    stack_depth: bool = False
+    undef_zero: bool = False
+    warn_symbol_case: bool = False
+    strict_case: bool = False
+    max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH
+    max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH
+    include_paths: List[str] = field(default_factory=list)
+    error_format: str = "default"
+    length_prefix: Optional[int] = None
+    fail_fast: bool = False
+    compile_object: bool = False
+    defines: Dict[str, int] = field(default_factory=dict)
+    comment_char: str = ';'
+    block_comment_start: str = '/*'
+    block_comment_end: str = '*/'
+    syntax: str = "arnicomp"
+    target: str = DEFAULT_TARGET
+    project_config: Optional[str] = None
+    pseudo_instructions: Dict[str, MacroDefinition] = field(default_factory=dict)
+
+    def apply_syntax_profile(self, name: str) -> None:
+        """Select a syntax profile and take its comment markers"""
+        profile = get_syntax_profile(name)
+        self.syntax = profile.name
+        self.comment_char = profile.comment_char
+        self.block_comment_start = profile.block_comment_start
+        self.block_comment_end = profile.block_comment_end
+
+    def apply_project_config(self, config: ProjectConfig) -> None:
+        """Take defaults from a .asmconfig file; flags parsed afterwards still override them"""
+        self.project_config = config.path
+        if config.syntax is not None:
+            self.apply_syntax_profile(config.syntax)
+        if config.pseudo_instructions is not None:
+            self.pseudo_instructions = dict(config.pseudo_instructions)
+        if config.include_paths is not None:
+            self.include_paths = list(config.include_paths)
+        for name in ("comment_char", "block_comment_start", "block_comment_end", "optimize", "listing_mode", "crlf", "target"):
+            value = getattr(config, name)
+            if value is not None:
+                setattr(self, name, value)
 
 
 class AssemblerCLI:
@@ -37,7 +137,236 @@ class AssemblerCLI:
             label_prefix='@'
         )
         self.comport = comport
+        self.verify_roundtrip = False
+        self.check_reachability = False
+        self.suggest_optimize = False
+        self.partial_placeholder: Optional[int] = None
+        self.data_base = 0x0000
+        self.map_file: Optional[str] = None
+        self.symbols_file: Optional[str] = None
+        self.source_map_file: Optional[str] = None
+        self.rom_size = 65536
+        self.partial_errors = []
+        self.group_digits: Optional[int] = None
+        self.group_separator = "_"
+        self.byteswap = False
+        self.append_crc = False
+        self.stats = False
+        self.stack_depth = False
+        self.undef_zero = False
+        self.warn_symbol_case = False
+        self.strict_case = False
+        self.max_include_depth = DEFAULT_MAX_INCLUDE_DEPTH
+        self.max_macro_depth = DEFAULT_MAX_MACRO_DEPTH
+        self.error_format = "default"
+        self.length_prefix: Optional[int] = None
+        self.fail_fast = False
+        self.defines: Dict[str, int] = {}
+        self.newline = "\n"
+
+    def configure(self, args: AssembleArgs) -> None:
+        """Apply command-line options that affect every assemble-style command"""
+        comment_settings = (args.comment_char, args.block_comment_start, args.block_comment_end)
+        if comment_settings != (self.helper.comment_char, self.helper.block_comment_start, self.helper.block_comment_end):
+            self.helper = AssemblyHelper(
+                comment_char=args.comment_char,
+                block_comment_start=args.block_comment_start,
+                block_comment_end=args.block_comment_end,
+                label_char=':',
+                constant_keyword='equ',
+                number_prefix='#',
+                constant_prefix='$',
+                label_prefix='@'
+            )
+        self.helper.syntax = get_syntax_profile(args.syntax)
+        self.helper.target = args.target
+        self.helper.pseudo_instructions.update(args.pseudo_instructions)
+        self.helper.preprocessor.include_paths = list(args.include_paths)
+        if args.project_config:
+            print(f"Using project config: {args.project_config}")
+        self.verify_roundtrip = args.verify_roundtrip
+        self.check_reachability = args.check_reachability
+        self.suggest_optimize = args.suggest_optimize
+        self.partial_placeholder = args.placeholder if args.partial else None
+        self.data_base = args.data_base
+        self.map_file = args.map_file
+        self.symbols_file = args.symbols_file
+        self.source_map_file = args.source_map_file
+        self.rom_size = args.rom_size
+        self.group_digits = args.group_digits
+        self.group_separator = args.group_separator
+        self.byteswap = args.byteswap
+        self.append_crc = args.append_crc
+        self.stats = args.stats
+        self.stack_depth = args.stack_depth
+        self.undef_zero = args.undef_zero
+        self.warn_symbol_case = args.warn_symbol_case
+        self.strict_case = args.strict_case
+        self.max_include_depth = args.max_include_depth
+        self.max_macro_depth = args.max_macro_depth
+        self.error_format = args.error_format
+        self.length_prefix = args.length_prefix
+        self.fail_fast = args.fail_fast
+        self.defines = dict(args.defines)
+        self.newline = "\r\n" if args.crlf else "\n"
+
+    def open_text_output(self, path: str):
+        """Open a text output file whose line endings follow --crlf instead of the OS default"""
+        return open(path, 'w', encoding='utf-8', newline=self.newline)
+
+    def read_source_file(self, input_file: str):
+        """Read a whole source file as lines, or exit with an error naming the file"""
+        try:
+            with open(input_file, 'r', encoding='utf-8') as f:
+                return f.readlines()
+        except FileNotFoundError:
+            print(f"Error: Input file '{input_file}' not found")
+        except UnicodeDecodeError as e:
+            print(f"Error: Input file '{input_file}' is not UTF-8 text (byte 0x{e.object[e.start]:02X} at offset {e.start})")
+        except OSError as e:
+            print(f"Error: Cannot read input file '{input_file}': {e.strerror}")
+        sys.exit(1)
+
+    def print_success(self, message: str) -> None:
+        """Print a command's success line; a partial build, which still exits 1, is not reported as a success."""
+        if self.partial_errors:
+            print("Partial build written")
+        else:
+            print(message)
+
+    def convert_source(self, raw_lines, input_file: str, optimize: bool, defines=None):
+        """Assemble source lines with the options shared by every assemble-style command"""
+        try:
+            result = self.helper.convert_to_machine_code(
+                raw_lines,
+                source_name=input_file,
+                optimize=optimize,
+                defines={**self.defines, **(defines or {})},
+                verify_roundtrip=self.verify_roundtrip,
+                check_reachability=self.check_reachability,
+                suggest_optimize=self.suggest_optimize,
+                partial_placeholder=self.partial_placeholder,
+                fail_fast=self.fail_fast,
+                undefined_as_zero=self.undef_zero,
+                warn_symbol_case=self.warn_symbol_case,
+                strict_case=self.strict_case,
+                max_include_depth=self.max_include_depth,
+                max_macro_depth=self.max_macro_depth,
+                data_base=self.data_base,
+            )
+        except ValueError as exc:
+            if self.error_format == "gnu":
+                errors = [str(d) for d in self.helper.last_diagnostics if d.severity == "error"]
+                raise ValueError(f"{len(errors)} error{'s' if len(errors) != 1 else ''}:\n" + "\n".join(errors)) from exc
+            raise
+        if self.error_format == "gnu":
+            diagnostics = self.helper.build_diagnostics(input_file, self.helper.last_errors)
+            self.helper.last_errors = [str(d) for d in diagnostics if d.severity == "error"]
+        if self.helper.last_errors:
+            self.partial_errors.extend(self.helper.last_errors)
+            print(f"Partial build: {len(self.helper.last_errors)} line(s) replaced with 0x{self.partial_placeholder:02X}")
+            for error in self.helper.last_errors:
+                print(f"  {error}")
+        if self.stats:
+            self.print_stats()
+        if self.stack_depth:
+            # The analysis follows jumps to internal labels too, such as numeric `1f` targets.
+            self.print_stack_depth(self.helper.last_labels, self.helper.last_constants)
+        # Symbol outputs are written after the image transforms below, so they describe the ROM as
+        # written: the CRC is counted in the map, while the length prefix (stripped by the loader)
+        # and --byteswap (a transfer byte order) leave every address where the CPU sees it.
+        program_size = len(result[0])
+        if self.append_crc:
+            from modules.OutputFormats import crc16
+
+            binary_lines, labels, constants = result
+            value = crc16(bytes(int(line, 2) for line in binary_lines))
+            result = binary_lines + [f"{byte:08b}\n" for byte in value.to_bytes(2, "little")], labels, constants
+        if self.byteswap:
+            from modules.OutputFormats import swap_byte_pairs
+
+            binary_lines, labels, constants = result
+            result = swap_byte_pairs(binary_lines), labels, constants
+        if self.length_prefix:
+            from modules.OutputFormats import length_prefix
+
+            binary_lines, labels, constants = result
+            header = [f"{value:08b}\n" for value in length_prefix(len(binary_lines), self.length_prefix)]
+            result = header + binary_lines, labels, constants
+        if self.map_file:
+            self.write_map(input_file, program_size, result[1], crc_bytes=2 if self.append_crc else 0)
+        if self.symbols_file:
+            self.write_symbols(input_file, result[1])
+        if self.source_map_file:
+            self.write_source_map(input_file)
+        if self.error_format == "gnu":
+            diagnostics = self.helper.build_diagnostics(input_file, [])
+            self.helper.last_warnings = [str(d) for d in diagnostics]
+        return result
     
+    def print_stats(self) -> None:
+        """Print how often each mnemonic appears in the last assembled program"""
+        histogram = self.helper.instruction_histogram()
+        total = sum(count for _, count in histogram)
+        print(f"Instruction usage ({total} source instructions):")
+        if not total:
+            return
+        for mnemonic, count in histogram:
+            print(f"  {mnemonic:10s} {count:5d}  {count * 100 / total:5.1f}%")
+
+    def write_map(self, source_name: str, program_size: int, labels, crc_bytes: int = 0) -> None:
+        """Write the --map report of the last build: sections, ROM use, free blocks, and labels"""
+        from modules.MemoryMap import format_memory_map
+
+        with self.open_text_output(self.map_file) as f:
+            f.writelines(format_memory_map(self.helper, labels, program_size, self.rom_size, source_name, crc_bytes))
+        print(f"Memory map written to: {self.map_file}")
+
+    def write_symbols(self, source_name: str, labels) -> None:
+        """Write the --symbols file: JSON when the path ends in .json, otherwise `ADDRESS NAME` lines"""
+        from modules.OutputFormats import format_symbol_file, format_symbol_json
+
+        data_labels = list(self.helper.data_labels)
+        with self.open_text_output(self.symbols_file) as f:
+            if self.symbols_file.lower().endswith(".json"):
+                f.write(format_symbol_json(labels, data_labels, source_name))
+            else:
+                f.writelines(format_symbol_file(labels, data_labels))
+        print(f"Symbols written to: {self.symbols_file}")
+
+    def write_source_map(self, source_name: str) -> None:
+        """Write the --source-map JSON: address ranges to file, line, and macro expansion stack"""
+        import json
+
+        with self.open_text_output(self.source_map_file) as f:
+            f.write(json.dumps(self.helper.source_map_document(source_name), indent=2))
+            f.write("\n")
+        print(f"Source map written to: {self.source_map_file}")
+
+    def print_stack_depth(self, labels, constants) -> None:
+        """Print the deepest PUSH/POP nesting from 0x0000 and from each CALL target"""
+        report = self.helper.stack_depth_checker.analyze(self.helper.last_listing, labels, constants)
+        print("Stack depth (bytes pushed, relative to each entry point):")
+        for root in report.roots:
+            note = f", pops {-root.min_depth} caller byte(s)" if root.min_depth < 0 and root.name != "entry" else ""
+            print(f"  {root.name:20s} 0x{root.address:04X}  max {root.max_depth}{note}")
+        self.helper.last_warnings.extend(report.warnings)
+
+    def format_symbol_tables(self, labels, constants) -> list:
+        """Render the label and constant tables in a stable order: labels by address then name, constants by name"""
+        lines = []
+        if labels:
+            lines.append("\n  Defined labels:")
+            for label, addr in sorted(labels.items(), key=lambda item: (item[1], item[0])):
+                where = ".data" if label in self.helper.data_labels else f"line {addr}"
+                lines.append(f"    {label:20s} -> 0x{addr:04X} ({where})")
+
+        if constants:
+            lines.append("\n  Defined constants:")
+            for const, value in sorted(constants.items(), key=lambda item: (item[0], item[1])):
+                lines.append(f"    {const:20s} = 0x{value:02X} ({value})")
+        return lines
+
     def assemble(
         self,
         input_file: str,
@@ -53,24 +382,15 @@ class AssemblerCLI:
             output_file = f"{base_name}.bin"
         
         # Read input file
-        try:
-            with open(input_file, 'r') as f:
-                raw_lines = f.readlines()
-        except FileNotFoundError:
-            print(f"Error: Input file '{input_file}' not found")
-            sys.exit(1)
+        raw_lines = self.read_source_file(input_file)
         
         # Assemble
         try:
-            binary_lines, labels, constants = self.helper.convert_to_machine_code(
-                raw_lines,
-                source_name=input_file,
-                optimize=optimize,
-            )
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
             warnings = self.helper.last_warnings
             
             # Display info
-            print(f"Assembly successful!")
+            self.print_success("Assembly successful!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
             print(f"  Instructions: {len(binary_lines)}")
@@ -79,15 +399,8 @@ class AssemblerCLI:
             print(f"  Warnings: {len(warnings)}")
             print(f"  Mode: {'optimized' if optimize else 'canonical'}")
             
-            if labels:
-                print("\n  Defined labels:")
-                for label, addr in sorted(labels.items(), key=lambda x: x[1]):
-                    print(f"    {label:20s} -> 0x{addr:04X} (line {addr})")
-            
-            if constants:
-                print("\n  Defined constants:")
-                for const, value in sorted(constants.items()):
-                    print(f"    {const:20s} = 0x{value:02X} ({value})")
+            for line in self.format_symbol_tables(labels, constants):
+                print(line)
 
             if warnings:
                 print("\n  Warnings:")
@@ -95,12 +408,12 @@ class AssemblerCLI:
                     print(f"    {warning}")
             
             # Write output
-            with open(output_file, 'w') as f:
+            with self.open_text_output(output_file) as f:
                 f.writelines(binary_lines)
 
             if listing_file:
-                with open(listing_file, 'w', encoding='utf-8') as f:
-                    f.writelines(self.helper.format_listing(listing_mode))
+                with self.open_text_output(listing_file) as f:
+                    f.writelines(self.helper.format_listing(listing_mode, self.group_digits, self.group_separator))
              
             print(f"\nBinary machine code written to: {output_file}")
             if listing_file:
@@ -109,6 +422,117 @@ class AssemblerCLI:
         except Exception as e:
             print(f"Assembly error: {e}")
             sys.exit(1)
+
+    def compile_object(self, input_file: str, output_file: Optional[str] = None) -> None:
+        """Assemble one source file into a relocatable object file for `link`"""
+        import json
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.o"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            document = build_object(
+                self.helper,
+                raw_lines,
+                input_file,
+                defines=self.defines,
+                fail_fast=self.fail_fast,
+                warn_symbol_case=self.warn_symbol_case,
+                strict_case=self.strict_case,
+                max_include_depth=self.max_include_depth,
+                max_macro_depth=self.max_macro_depth,
+            )
+            warnings = self.helper.last_warnings
+
+            with self.open_text_output(output_file) as f:
+                f.write(json.dumps(document, indent=2))
+                f.write("\n")
+
+            print("Object file created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Symbols: {len(document['symbols'])}")
+            print(f"  Relocations: {len(document['relocations'])}")
+            print(f"  Warnings: {len(warnings)}")
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Assembly error: {e}")
+            sys.exit(1)
+
+    def link(
+        self,
+        object_files,
+        output_file: Optional[str] = None,
+        listing_file: Optional[str] = None,
+        listing_mode: str = "hex",
+        optimize: bool = False,
+    ) -> None:
+        """Link object files, in the order given, into one binary"""
+        if output_file is None:
+            base_name = os.path.splitext(object_files[0])[0]
+            output_file = f"{base_name}.bin"
+
+        try:
+            objects = [load_object(path) for path in object_files]
+            binary_lines, labels, constants = link_objects(
+                self.helper,
+                objects,
+                optimize=optimize,
+                verify_roundtrip=self.verify_roundtrip,
+                check_reachability=self.check_reachability,
+                fail_fast=self.fail_fast,
+                data_base=self.data_base,
+            )
+            warnings = self.helper.last_warnings
+            if self.map_file:
+                self.write_map(", ".join(object_files), len(binary_lines), labels)
+            if self.symbols_file:
+                self.write_symbols(", ".join(object_files), labels)
+            if self.source_map_file:
+                self.write_source_map(", ".join(object_files))
+
+            print("Link successful!")
+            print(f"  Objects: {', '.join(object_files)}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            print(f"  Labels: {len(labels)}")
+            print(f"  Constants: {len(constants)}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            for line in self.format_symbol_tables(labels, constants):
+                print(line)
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(binary_lines)
+
+            if listing_file:
+                with self.open_text_output(listing_file) as f:
+                    f.writelines(self.helper.format_listing(listing_mode, self.group_digits, self.group_separator))
+
+            print(f"\nBinary machine code written to: {output_file}")
+            if listing_file:
+                print(f"Listing written to: {listing_file}")
+
+        except FileNotFoundError as e:
+            print(f"Error: Object file '{e.filename}' not found")
+            sys.exit(1)
+        except Exception as e:
+            print(f"Link error: {e}")
+            sys.exit(1)
     
     def disassemble(self, input_file: str, output_file: Optional[str] = None) -> None:
         """Disassemble binary machine code to assembly mnemonics"""
@@ -138,7 +562,7 @@ class AssemblerCLI:
                         assembly_lines.append(f"; ERROR: {e}\n")
             
             # Write output
-            with open(output_file, 'w') as f:
+            with self.open_text_output(output_file) as f:
                 f.writelines(assembly_lines)
             
             print(f"Disassembly successful!")
@@ -150,19 +574,279 @@ class AssemblerCLI:
             print(f"Disassembly error: {e}")
             sys.exit(1)
     
-    def create_bin(self, input_file: str, output_file: Optional[str] = None) -> None:
-        """Convert text binary format to .bin file"""
+    def disasm(self, input_file: str, output_file: Optional[str] = None, symbols_file: Optional[str] = None) -> None:
+        """Disassemble a ROM image with addresses, naming labels from an optional --symbols file"""
+        from modules.Disassembler import disassemble_image, read_image, read_symbol_file
+
+        try:
+            image = read_image(input_file)
+            symbols = read_symbol_file(symbols_file) if symbols_file else {}
+        except FileNotFoundError as e:
+            print(f"Error: File '{e.filename}' not found")
+            sys.exit(1)
+        except ValueError as e:
+            print(f"Disassembly error: {e}")
+            sys.exit(1)
+
+        assembly_lines = disassemble_image(self.helper, image, symbols)
+        if output_file is None:
+            sys.stdout.writelines(assembly_lines)
+            return
+
+        with self.open_text_output(output_file) as f:
+            f.writelines(assembly_lines)
+        print(f"Disassembly successful!")
+        print(f"  Input: {input_file}")
+        print(f"  Output: {output_file}")
+        print(f"  Bytes: {len(image)}")
+        print(f"  Symbols: {sum(len(names) for names in symbols.values())}")
+
+    def load_program_image(self, input_file: str):
+        """Return (image, labels) for a source file, assembled here, or for a ROM image"""
+        from modules.Disassembler import read_image
+
+        try:
+            if input_file.lower().endswith(".asm"):
+                with open(input_file, 'r') as f:
+                    raw_lines = f.readlines()
+                binary_lines, labels, _ = self.convert_source(raw_lines, input_file, optimize=False)
+                return {address: int(line.strip(), 2) for address, line in enumerate(binary_lines)}, labels
+            return read_image(input_file), {}
+        except FileNotFoundError:
+            print(f"Error: Input file '{input_file}' not found")
+            sys.exit(1)
+        except ValueError as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+
+    def run_program(
+        self,
+        input_file: str,
+        max_steps: int,
+        stack_base: int,
+        dumps=(),
+        devices=(),
+        uart_input: bytes = b"",
+        timing: bool = False,
+        symbols_file: Optional[str] = None,
+        trace_file: Optional[str] = None,
+        save_state_file: Optional[str] = None,
+        load_state_file: Optional[str] = None,
+    ) -> None:
+        """Execute a program in the emulator, with optional devices from --device, and print the final state"""
+        import json
+
+        from modules.Devices import DEVICE_TYPES, UartDevice
+        from modules.Disassembler import read_symbol_file
+        from modules.Emulator import Emulator, read_state_file
+
+        image, labels = self.load_program_image(input_file)
+        code_labels = {name: address for name, address in labels.items() if name not in self.helper.data_labels}
+        if symbols_file:
+            try:
+                for address, names in read_symbol_file(symbols_file).items():
+                    code_labels.update({name: address for name in names})
+            except FileNotFoundError:
+                print(f"Error: Symbol file '{symbols_file}' not found")
+                sys.exit(1)
+            except ValueError as e:
+                print(f"Error: {e}")
+                sys.exit(1)
+
+        emulator = Emulator(self.helper, sp=stack_base, symbols={**self.helper.last_constants, **labels})
+        emulator.load(image)
+        emulator.add_assertions(self.helper.last_assertions)
+        try:
+            for name, start, end in devices:
+                emulator.attach(DEVICE_TYPES[name][0](), start, end)
+            if load_state_file:
+                state = read_state_file(load_state_file)
+                attached = {(start, end, device.name) for start, end, device in emulator.devices}
+                for saved in state["devices"]:
+                    if (saved["start"], saved["end"], saved["device"]) not in attached and saved["device"] in DEVICE_TYPES:
+                        emulator.attach(DEVICE_TYPES[saved["device"]][0](), saved["start"], saved["end"])
+                emulator.restore_state(state)
+        except FileNotFoundError:
+            print(f"Error: Snapshot file '{load_state_file}' not found")
+            sys.exit(1)
+        except ValueError as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+        # Input is queued after a restored snapshot's, so runs forked from one checkpoint can differ.
+        for _, _, device in emulator.devices:
+            if isinstance(device, UartDevice):
+                device.input.extend(uart_input)
+        trace = self.open_text_output(trace_file) if trace_file else None
+        if trace is not None:
+            if trace_file.lower().endswith(".jsonl"):
+                emulator.tracer = lambda record: trace.write(json.dumps(record) + "\n")
+            else:
+                trace.write("#   step  PC    OP  instruction       changes and writes\n")
+                emulator.tracer = lambda record: trace.write(emulator.format_trace_record(record) + "\n")
+        try:
+            result = emulator.run(max_steps)
+        except ValueError as e:
+            print(f"Emulation error: {e}")
+            for line in emulator.format_state():
+                print(f"  {line}")
+            sys.exit(1)
+        finally:
+            if trace is not None:
+                trace.close()
+
+        for line in emulator.format_state(result):
+            print(line)
+        if save_state_file:
+            with self.open_text_output(save_state_file) as f:
+                json.dump(emulator.save_state(), f)
+            print(f"Saved state to {save_state_file}")
+        for _, _, device in emulator.devices:
+            for line in device.report():
+                print(line)
+        if timing:
+            print()
+            for line in emulator.format_timing_report(code_labels):
+                print(line)
+        for start, count in dumps:
+            print(f"\nRAM 0x{start:04X}-0x{(start + count - 1) & 0xFFFF:04X}:")
+            for line in emulator.format_ram(start, count):
+                print(f"  {line}")
+        if emulator.failed_assertion is not None:
+            sys.exit(1)
+
+    def debug_program(
+        self,
+        input_file: str,
+        stack_base: int,
+        symbols_file: Optional[str] = None,
+        source_map_file: Optional[str] = None,
+    ) -> None:
+        """Start an interactive debugger session on a program, reading commands from stdin"""
+        from modules.Debugger import PROMPT, Debugger, read_source_map
+        from modules.Disassembler import read_symbol_file
+        from modules.Emulator import Emulator
+
+        image, labels = self.load_program_image(input_file)
+        mappings = []
+        data_labels = set()
+        if input_file.lower().endswith(".asm"):
+            mappings = self.helper.source_map_document(input_file)["mappings"]
+            data_labels = set(self.helper.data_labels)
+        try:
+            if symbols_file:
+                for address, names in read_symbol_file(symbols_file).items():
+                    labels.update({name: address for name in names})
+            if source_map_file:
+                mappings = read_source_map(source_map_file)
+        except FileNotFoundError as e:
+            print(f"Error: File '{e.filename}' not found")
+            sys.exit(1)
+        except ValueError as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+
+        emulator = Emulator(self.helper, sp=stack_base, symbols=dict(self.helper.last_constants))
+        emulator.load(image)
+        emulator.add_assertions(self.helper.last_assertions)
+        debugger = Debugger(emulator, labels, mappings, data_labels)
+        print(f"Debugging {input_file} ({len(image)} bytes); type 'help' for commands")
+        for line in debugger.where():
+            print(line)
+        while not debugger.finished:
+            try:
+                command = input(PROMPT)
+            except EOFError:
+                print()
+                break
+            for line in debugger.execute(command):
+                print(line)
+
+    def gdb_server(self, input_file: str, host: str, port: int, stack_base: int, devices=()) -> None:
+        """Serve a program in the emulator to a GDB remote debugger until it detaches"""
+        from modules.Devices import DEVICE_TYPES
+        from modules.Emulator import Emulator
+        from modules.GdbStub import GdbStub
+
+        image, _ = self.load_program_image(input_file)
+        emulator = Emulator(self.helper, sp=stack_base)
+        emulator.load(image)
+        try:
+            for name, start, end in devices:
+                emulator.attach(DEVICE_TYPES[name][0](), start, end)
+            GdbStub(emulator).serve(host, port)
+        except (ValueError, OSError) as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+        except KeyboardInterrupt:
+            print()
+
+    def test_program(self, input_file: str, max_steps: int, stack_base: int, devices=()) -> None:
+        """Run every .test block of a source file in a fresh emulator and exit 1 if any fails"""
+        from modules.Devices import DEVICE_TYPES
+        from modules.Emulator import Emulator
+        from modules.ProgramTests import format_outcomes, run_tests
+
+        if not input_file.lower().endswith(".asm"):
+            print(f"Error: test needs a source file with .test blocks, not '{input_file}'")
+            sys.exit(1)
+        self.helper.include_tests = True
+        image, labels = self.load_program_image(input_file)
+        if not self.helper.last_tests:
+            print(f"Error: No .test blocks in {input_file}")
+            sys.exit(1)
+
+        def make_emulator() -> Emulator:
+            emulator = Emulator(self.helper, sp=stack_base, symbols={**self.helper.last_constants, **labels})
+            emulator.load(image)
+            emulator.add_assertions(self.helper.last_assertions)
+            for name, start, end in devices:
+                emulator.attach(DEVICE_TYPES[name][0](), start, end)
+            return emulator
+
+        try:
+            outcomes = run_tests(make_emulator, self.helper.last_tests, max_steps)
+        except ValueError as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+        for line in format_outcomes(outcomes):
+            print(line)
+        if not all(outcome.passed for outcome in outcomes):
+            sys.exit(1)
+
+    def create_bin(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        rom_size: int = 65536,
+        fill_byte: int = 0x00,
+        split: Optional[Tuple[str, str]] = None,
+    ) -> None:
+        """Convert text binary format to a .bin ROM image padded with fill_byte to rom_size bytes.
+
+        With `split`, the image is written as two files of even and odd bytes, named after the
+        parts, plus a checksum file to check each EEPROM against once it is programmed.
+        """
         # Determine output file
         if output_file is None:
             base_name = os.path.splitext(input_file)[0]
             output_file = f"{base_name}.bin"
         
-        # Create binary program
-        program = bytearray(65536)  # 64KB address space
+        if split is not None and rom_size % 2:
+            print(f"Error: --split needs an even ROM size, got {rom_size}")
+            sys.exit(1)
+
+        # Create binary program (default: the full 64KB address space)
+        program = bytearray([fill_byte]) * rom_size
         
         try:
             with open(input_file, 'r') as f:
                 lines = f.readlines()
+
+            while lines and not lines[-1].strip():
+                lines.pop()
+            if len(lines) > rom_size:
+                print(f"Error: Program has {len(lines)} bytes and does not fit in a {rom_size}-byte ROM")
+                sys.exit(1)
                 
             for i, line in enumerate(lines):
                 line = line.strip()
@@ -172,6 +856,28 @@ class AssemblerCLI:
                     except ValueError:
                         print(f"Warning: Invalid binary format on line {i + 1}: {line}")
             
+            if split is not None:
+                base_name, extension = os.path.splitext(output_file)
+                halves = dict(zip(split, split_interleaved(bytes(program))))
+                checksum_lines = [format_checksum_line(f"{os.path.basename(output_file)} (combined)", bytes(program))]
+                for name, data in halves.items():
+                    half_file = f"{base_name}.{name}{extension or '.bin'}"
+                    with open(half_file, 'wb') as f:
+                        f.write(data)
+                    checksum_lines.append(format_checksum_line(os.path.basename(half_file), data))
+                checksum_file = f"{base_name}.checksums.txt"
+                with open(checksum_file, 'w') as f:
+                    f.write("\n".join(checksum_lines) + "\n")
+
+                print(f"Split binary files created successfully!")
+                print(f"  Input: {input_file}")
+                print(f"  Size: {len(program)} bytes (fill 0x{fill_byte:02X}), {len(program) // 2} per EEPROM")
+                print(f"  Instructions loaded: {len(lines)}")
+                print(f"  Checksums: {checksum_file}")
+                for line in checksum_lines[1:]:
+                    print(f"    {line}")
+                return
+
             # Write binary file
             with open(output_file, 'wb') as f:
                 f.write(program)
@@ -179,8 +885,8 @@ class AssemblerCLI:
             print(f"Binary file created successfully!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
-            print(f"  Size: {len(program)} bytes")
-            print(f"  Instructions loaded: {i + 1}")
+            print(f"  Size: {len(program)} bytes (fill 0x{fill_byte:02X})")
+            print(f"  Instructions loaded: {len(lines)}")
             
         except FileNotFoundError:
             print(f"Error: Input file '{input_file}' not found")
@@ -198,26 +904,17 @@ class AssemblerCLI:
             output_file = f"{base_name}.hex"
         
         # Read input file
-        try:
-            with open(input_file, 'r') as f:
-                raw_lines = f.readlines()
-        except FileNotFoundError:
-            print(f"Error: Input file '{input_file}' not found")
-            sys.exit(1)
+        raw_lines = self.read_source_file(input_file)
         
         # Assemble and convert to Intel HEX
         try:
-            binary_lines, labels, constants = self.helper.convert_to_machine_code(
-                raw_lines,
-                source_name=input_file,
-                optimize=optimize,
-            )
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
             warnings = self.helper.last_warnings
             
             # Save as Intel HEX format
-            save_intelHexFile(output_file, binary_lines, line_type='bin')
+            save_intelHexFile(output_file, binary_lines, line_type='bin', newline=self.newline)
             
-            print(f"Intel HEX file created successfully!")
+            self.print_success("Intel HEX file created successfully!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
             print(f"  Instructions: {len(binary_lines)}")
@@ -253,34 +950,25 @@ class AssemblerCLI:
             output_file = f"{base_name}.mem"
         
         # Read input file
-        try:
-            with open(input_file, 'r') as f:
-                raw_lines = f.readlines()
-        except FileNotFoundError:
-            print(f"Error: Input file '{input_file}' not found")
-            sys.exit(1)
+        raw_lines = self.read_source_file(input_file)
         
         # Assemble and convert to Intel HEX
         try:
-            binary_lines, labels, constants = self.helper.convert_to_machine_code(
-                raw_lines,
-                source_name=input_file,
-                optimize=optimize,
-            )
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
             warnings = self.helper.last_warnings
             
-            with open(output_file, 'w') as f:
+            with self.open_text_output(output_file) as f:
                 f.write("@0\n")
                 for binline in binary_lines:
                     hexLine = hex(int(binline, 2) &0xFF)[2:]
                     f.write(f"{hexLine:>02}\n")
 
             if listing_file:
-                with open(listing_file, 'w', encoding='utf-8') as f:
-                    f.writelines(self.helper.format_listing(listing_mode))
+                with self.open_text_output(listing_file) as f:
+                    f.writelines(self.helper.format_listing(listing_mode, self.group_digits, self.group_separator))
 
              
-            print(f"HEX file created successfully!")
+            self.print_success("HEX file created successfully!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
             print(f"  Instructions: {len(binary_lines)}")
@@ -317,19 +1005,10 @@ class AssemblerCLI:
             base_name = os.path.splitext(input_file)[0]
             output_file = f"{base_name}.mi"
 
-        try:
-            with open(input_file, 'r') as f:
-                raw_lines = f.readlines()
-        except FileNotFoundError:
-            print(f"Error: Input file '{input_file}' not found")
-            sys.exit(1)
+        raw_lines = self.read_source_file(input_file)
 
         try:
-            binary_lines, labels, constants = self.helper.convert_to_machine_code(
-                raw_lines,
-                source_name=input_file,
-                optimize=optimize,
-            )
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
             warnings = self.helper.last_warnings
             byte_values = [format(int(binline, 2) & 0xFF, "02X") for binline in binary_lines]
 
@@ -344,7 +1023,7 @@ class AssemblerCLI:
 
             address_depth = max(len(byte_values), 1)
 
-            with open(output_file, 'w', encoding='utf-8') as f:
+            with self.open_text_output(output_file) as f:
                 f.write("#File_format=Hex\n")
                 f.write(f"#Address_depth={address_depth}\n")
                 f.write("#Data_width=8\n")
@@ -352,10 +1031,10 @@ class AssemblerCLI:
                     f.write(f"{hex_line}\n")
 
             if listing_file:
-                with open(listing_file, 'w', encoding='utf-8') as f:
-                    f.writelines(self.helper.format_listing(listing_mode))
+                with self.open_text_output(listing_file) as f:
+                    f.writelines(self.helper.format_listing(listing_mode, self.group_digits, self.group_separator))
 
-            print("MI file created successfully!")
+            self.print_success("MI file created successfully!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
             print(f"  Instructions: {len(binary_lines)}")
@@ -380,6 +1059,99 @@ class AssemblerCLI:
             print(f"Error creating Gowin MI file: {e}")
             sys.exit(1)
 
+    def create_memory_init(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        file_format: str = "mif",
+        depth: Optional[int] = None,
+        optimize: bool = False,
+    ) -> None:
+        """Convert assembly file to an FPGA memory initialization file: Intel .mif or Xilinx .coe"""
+        from modules.OutputFormats import format_coe, format_mif
+
+        formatters = {
+            "mif": (format_mif, "Intel MIF (Quartus memory initialization)"),
+            "coe": (format_coe, "Xilinx COE (block memory generator)"),
+        }
+        formatter, description = formatters[file_format]
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.{file_format}"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            byte_values = [int(binline, 2) & 0xFF for binline in binary_lines]
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(formatter(byte_values, depth, source_name=os.path.basename(input_file)))
+
+            self.print_success(f"{file_format.upper()} file created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            if depth is not None:
+                print(f"  Padded depth: {depth}")
+            print(f"  Format: {description}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if labels:
+                print(f"  Labels: {len(labels)}")
+            if constants:
+                print(f"  Constants: {len(constants)}")
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating {file_format.upper()} file: {e}")
+            sys.exit(1)
+
+    def create_logisim(self, input_file: str, output_file: Optional[str] = None, optimize: bool = False) -> None:
+        """Convert assembly file to a Logisim-evolution ROM/RAM image (v2.0 raw, run-length encoded)"""
+        from modules.OutputFormats import format_logisim_image
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.img"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            byte_values = [int(binline, 2) & 0xFF for binline in binary_lines]
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(format_logisim_image(byte_values))
+
+            self.print_success("Logisim image created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            print("  Format: Logisim-evolution v2.0 raw (right-click the ROM > Load Image)")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if labels:
+                print(f"  Labels: {len(labels)}")
+            if constants:
+                print(f"  Constants: {len(constants)}")
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating Logisim image: {e}")
+            sys.exit(1)
+
     def create_gowin_prom(
         self,
         input_file: str,
@@ -390,12 +1162,7 @@ class AssemblerCLI:
         optimize: bool = False,
     ) -> None:
         """Patch Gowin_pROM INIT_RAM_xx defparams in a generated gowin_prom.v file."""
-        try:
-            with open(input_file, 'r') as f:
-                raw_lines = f.readlines()
-        except FileNotFoundError:
-            print(f"Error: Input file '{input_file}' not found")
-            sys.exit(1)
+        raw_lines = self.read_source_file(input_file)
 
         try:
             with open(output_file, 'r', encoding='utf-8') as f:
@@ -405,11 +1172,7 @@ class AssemblerCLI:
             sys.exit(1)
 
         try:
-            binary_lines, labels, constants = self.helper.convert_to_machine_code(
-                raw_lines,
-                source_name=input_file,
-                optimize=optimize,
-            )
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
             warnings = self.helper.last_warnings
             byte_values = [format(int(binline, 2) & 0xFF, "02X") for binline in binary_lines]
 
@@ -488,14 +1251,14 @@ class AssemblerCLI:
 
                 updated_text = pattern.sub(new_init_block + "\n", updated_text, count=1)
 
-            with open(output_file, 'w', encoding='utf-8') as f:
+            with self.open_text_output(output_file) as f:
                 f.write(updated_text)
 
             if listing_file:
-                with open(listing_file, 'w', encoding='utf-8') as f:
-                    f.writelines(self.helper.format_listing(listing_mode))
+                with self.open_text_output(listing_file) as f:
+                    f.writelines(self.helper.format_listing(listing_mode, self.group_digits, self.group_separator))
 
-            print("Gowin pROM file updated successfully!")
+            self.print_success("Gowin pROM file updated successfully!")
             print(f"  Input: {input_file}")
             print(f"  Output: {output_file}")
             print(f"  Instructions: {len(binary_lines)}")
@@ -522,9 +1285,329 @@ class AssemblerCLI:
         except Exception as e:
             print(f"Error updating Gowin pROM file: {e}")
             sys.exit(1)
-    
-    def load_to_eeprom(self, bin_file: str) -> None:
-        """Load a binary file to EEPROM"""
+
+    def create_carray(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        array_name: str = "rom",
+        optimize: bool = False,
+    ) -> None:
+        """Convert assembly file to a C header holding the ROM image as a const array"""
+        from modules.OutputFormats import format_c_array
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.h"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            byte_values = [int(binline, 2) & 0xFF for binline in binary_lines]
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(format_c_array(byte_values, array_name, source_name=os.path.basename(input_file)))
+
+            self.print_success("C array header created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            print(f"  Array: {array_name}[{array_name.upper()}_LEN]")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if labels:
+                print(f"  Labels: {len(labels)}")
+            if constants:
+                print(f"  Constants: {len(constants)}")
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating C array header: {e}")
+            sys.exit(1)
+
+    def create_c_defines(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        prefix: str = "",
+        mangle: bool = False,
+        optimize: bool = False,
+    ) -> None:
+        """Convert assembly file to a C header with a #define for every label and constant"""
+        from modules.OutputFormats import format_c_defines
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}_symbols.h"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            guard = re.sub(r"[^A-Za-z0-9_]", "_", os.path.basename(output_file)).upper()
+            if not re.match(r"^[A-Z]", guard):
+                guard = f"H_{guard.lstrip('_')}"
+            header_lines = format_c_defines(
+                labels,
+                constants,
+                guard,
+                source_name=os.path.basename(input_file),
+                prefix=prefix,
+                mangle=mangle,
+            )
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(header_lines)
+
+            self.print_success("C defines header created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            print(f"  Labels: {len(labels)}")
+            print(f"  Constants: {len(constants)}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating C defines header: {e}")
+            sys.exit(1)
+
+    def dump_json(self, input_file: str, output_file: Optional[str] = None, optimize: bool = False) -> None:
+        """Convert assembly file to a JSON description of its symbols and statements"""
+        import json
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.json"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            document = self.helper.program_document(input_file)
+
+            with self.open_text_output(output_file) as f:
+                f.write(json.dumps(document, indent=2))
+                f.write("\n")
+
+            self.print_success("Program JSON created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Statements: {len(document['statements'])}")
+            print(f"  Bytes: {len(binary_lines)}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating program JSON: {e}")
+            sys.exit(1)
+
+    def create_base64(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        compress: bool = False,
+        optimize: bool = False,
+    ) -> None:
+        """Convert assembly file to a single base64 line for sharing small programs as text"""
+        from modules.OutputFormats import encode_base64
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.b64"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            byte_values = [int(binline, 2) & 0xFF for binline in binary_lines]
+            blob = encode_base64(byte_values, compress=compress)
+
+            with self.open_text_output(output_file) as f:
+                f.write(f"{blob}\n")
+
+            self.print_success("Base64 blob created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Instructions: {len(binary_lines)}")
+            print(f"  Encoded length: {len(blob)} characters{' (gzip)' if compress else ''}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating base64 blob: {e}")
+            sys.exit(1)
+
+    def create_record(
+        self,
+        input_file: str,
+        output_file: Optional[str] = None,
+        record_width: int = 4,
+        optimize: bool = False,
+    ) -> None:
+        """Convert assembly file to fixed-width address + bytes records, one per instruction"""
+        from modules.OutputFormats import format_records
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.rec"
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            if self.byteswap or self.length_prefix or self.append_crc:
+                raise ValueError("--byteswap, --length-prefix, and --append-crc are not supported for record output")
+            binary_lines, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            warnings = self.helper.last_warnings
+            instructions = [
+                (entry.address, [int(binary, 2) for binary in entry.binary_bytes])
+                for entry in self.helper.last_listing
+            ]
+            records = format_records(instructions, record_width)
+
+            with self.open_text_output(output_file) as f:
+                f.writelines(records)
+
+            self.print_success("Record file created successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Records: {len(records)} x {record_width} bytes")
+            print(f"  Program bytes: {len(binary_lines)}")
+            print(f"  Warnings: {len(warnings)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            if warnings:
+                print("\n  Warnings:")
+                for warning in warnings:
+                    print(f"    {warning}")
+
+        except Exception as e:
+            print(f"Error creating record file: {e}")
+            sys.exit(1)
+
+    def decode_base64(self, input_file: str, output_file: Optional[str] = None) -> None:
+        """Decode a base64 blob back to the binary text format written by assemble"""
+        from modules.OutputFormats import decode_base64
+
+        if output_file is None:
+            base_name = os.path.splitext(input_file)[0]
+            output_file = f"{base_name}.txt"
+
+        try:
+            with open(input_file, 'r') as f:
+                blob = f.read()
+        except FileNotFoundError:
+            print(f"Error: Input file '{input_file}' not found")
+            sys.exit(1)
+
+        try:
+            byte_values = decode_base64(blob)
+            with self.open_text_output(output_file) as f:
+                f.writelines(f"{value:08b}\n" for value in byte_values)
+
+            print("Base64 blob decoded successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Output: {output_file}")
+            print(f"  Bytes: {len(byte_values)}")
+
+        except Exception as e:
+            print(f"Error decoding base64 blob: {e}")
+            sys.exit(1)
+
+    def dump_ast(self, expression: str, input_file: Optional[str] = None, optimize: bool = False) -> None:
+        """Print an operand expression's parse tree and value against a program's symbol table"""
+        labels, constants = {}, {}
+        if input_file is not None:
+            raw_lines = self.read_source_file(input_file)
+            try:
+                _, labels, constants = self.convert_source(raw_lines, input_file, optimize)
+            except Exception as e:
+                print(f"Error assembling {input_file}: {e}")
+                sys.exit(1)
+
+        try:
+            tree = self.helper.dump_expression_ast(expression, labels, constants)
+            value = self.helper.evaluate_operand_expression(
+                expression.strip().removeprefix(self.helper.number_prefix), labels, constants
+            )
+        except ValueError as e:
+            print(f"Error: {e}")
+            sys.exit(1)
+
+        print(f"Expression: {expression}")
+        for line in tree:
+            print(f"  {line}")
+        print(f"Result: {value} (0x{value & 0xFFFF:04X})")
+
+    def build_matrix(self, input_file: str, matrix_file: str, optimize: bool = False) -> None:
+        """Assemble one source once per define-set listed in a build matrix file"""
+        from modules.BuildMatrix import parse_build_matrix
+
+        raw_lines = self.read_source_file(input_file)
+
+        try:
+            with open(matrix_file, 'r', encoding='utf-8') as f:
+                matrix_lines = f.readlines()
+        except FileNotFoundError:
+            print(f"Error: Build matrix file '{matrix_file}' not found")
+            sys.exit(1)
+
+        try:
+            variants = parse_build_matrix(matrix_lines, self.helper.evaluate_expression, source_name=matrix_file)
+            matrix_dir = os.path.dirname(os.path.abspath(matrix_file))
+
+            self.print_success("Build matrix assembled successfully!")
+            print(f"  Input: {input_file}")
+            print(f"  Matrix: {matrix_file}")
+            print(f"  Variants: {len(variants)}")
+            print(f"  Mode: {'optimized' if optimize else 'canonical'}")
+
+            for variant in variants:
+                output_file = variant.output_file
+                if not os.path.isabs(output_file):
+                    output_file = os.path.join(matrix_dir, output_file)
+
+                binary_lines, _, _ = self.convert_source(raw_lines, input_file, optimize, defines=variant.defines)
+                with self.open_text_output(output_file) as f:
+                    f.writelines(binary_lines)
+
+                define_text = " ".join(f"{name}={value}" for name, value in variant.defines.items()) or "(no defines)"
+                print(f"\n  {output_file}")
+                print(f"    Defines: {define_text}")
+                print(f"    Instructions: {len(binary_lines)}")
+                for warning in self.helper.last_warnings:
+                    print(f"    Warning: {warning}")
+
+        except Exception as e:
+            print(f"Build matrix error: {e}")
+            sys.exit(1)
+
+    def load_to_eeprom(self, bin_file: str) -> None:
+        """Load a binary file to EEPROM"""
         from modules.EepromLoader import EepromLoader
         try:
             eeprom_loader = EepromLoader(self.comport)
@@ -538,6 +1621,45 @@ class AssemblerCLI:
             print(f"Error loading to EEPROM: {e}")
             sys.exit(1)
     
+    def flash_program(
+        self,
+        input_file: str,
+        port: Optional[str] = None,
+        baud: int = 115200,
+        fill_byte: int = 0x00,
+    ) -> None:
+        """Write a program to the EEPROM programmer with the load protocol `load` uses"""
+        import time
+
+        from modules.SerialFlasher import RESET_DELAY, SerialFlasher, flatten_image
+
+        image, _ = self.load_program_image(input_file)
+        if not image:
+            print(f"Error: {input_file} contains no bytes to flash")
+            sys.exit(1)
+        data = flatten_image(image, fill_byte)
+        port = port or self.comport
+        try:
+            import serial
+        except ImportError:
+            print("Error: flash needs pyserial (pip install pyserial)")
+            sys.exit(1)
+        try:
+            with serial.Serial(port, baud) as connection:
+                time.sleep(RESET_DELAY)
+                print(f"Flashing {len(data)} bytes from {input_file} via {port} at {baud} baud...")
+                SerialFlasher(connection).flash(
+                    data,
+                    lambda done, total: print(f"\r  {done}/{total} bytes", end="", flush=True),
+                )
+                print()
+        except serial.SerialException as e:
+            print()
+            print(f"Error flashing EEPROM: {e}")
+            sys.exit(1)
+        # The programmer does not answer, so the checksums are the only way to confirm what arrived.
+        print(f"Sent {format_checksum_line(input_file, data)}")
+
     def assemble_and_load(self, asm_file: str) -> None:
         """Assemble and load directly to EEPROM (uses temporary files)"""
         tmp_txt = "_tmp_machine.txt"
@@ -601,13 +1723,31 @@ COMMANDS:
         Assemble assembly code to binary text format
         Example: python main.py assemble program.asm program.txt --listing program.lst --listing-mode both --optimize
 
+    assemble -c <input.asm> [-o output.o]
+        Write a relocatable object file (JSON) with the labels the file exports (.global) and the
+        symbols it uses from other files (.extern), instead of a binary
+        Example: python main.py assemble -c uart.asm -o uart.o
+
+    link <a.o> [b.o ...] [-o output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
+        Link object files in the order given into one binary; the first starts at 0x0000
+        Example: python main.py link main.o uart.o -o program.txt
+
     disassemble <input.txt> [output.asm]
         Disassemble binary text format back to assembly
         Example: python main.py disassemble program.txt program_dis.asm
 
-    createbin <input.txt> [output.bin]
-        Convert binary text format to .bin file
+    disasm <image.bin|image.hex|input.txt> [output.asm] [--symbols program.sym]
+        Disassemble a ROM image (raw bytes, Intel HEX, or binary text) with addresses and byte values;
+        --symbols names labels and jump targets; prints to the console unless an output path is given
+        Example: python main.py disasm eeprom_dump.bin --symbols program.sym
+
+    createbin <input.txt> [output.bin] [--rom-size N] [--fill BYTE] [--split hi,lo|lo,hi|even,odd]
+        Convert binary text format to a .bin ROM image of N bytes (default 64K; 32K or 0x8000 style)
+        padded with BYTE (default 0x00); fails if the program does not fit.
+        --split writes the image as two EEPROMs instead: the first part gets the even addresses and the second the odd
+        ones (output.hi.bin and output.lo.bin), with sizes, 16-bit sums, and CRC-32s in output.checksums.txt
         Example: python main.py createbin program.txt program.bin
+        Example: python main.py createbin program.txt program.bin --rom-size 32K --split hi,lo
 
     createihex <input.asm> [output.hex] [--optimize]
         Assemble and convert to Intel HEX format (for Digital circuit simulator)
@@ -621,10 +1761,93 @@ COMMANDS:
         Assemble and convert to Gowin MI format for pROM initialization
         Example: python main.py createsvmi program.asm program.mi --depth 2048 --listing program.lst --listing-mode asm --optimize
 
+    createmif <input.asm> [output.mif] [--depth N] [--optimize]
+        Assemble and write an Intel/Altera Memory Initialization File (WIDTH=8), padded with 00 to N bytes
+        Example: python main.py createmif program.asm program.mif --depth 4096
+
+    createcoe <input.asm> [output.coe] [--depth N] [--optimize]
+        Assemble and write a Xilinx .coe file (radix 16) for the block memory generator, padded to N bytes
+        Example: python main.py createcoe program.asm program.coe --depth 4096
+
+    createlogisim <input.asm> [output.img] [--optimize]
+        Assemble and write a Logisim-evolution "v2.0 raw" image; repeated bytes are written as COUNT*VALUE
+        Example: python main.py createlogisim program.asm program.img
+
     creategowinprom <input.asm> <gowin_prom.v> [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]
         Assemble and patch Gowin_pROM INIT_RAM_xx defparams directly
         Example: python main.py creategowinprom program.asm ../verilog/src/gowin_prom/gowin_prom.v --depth 2048 --optimize
 
+    createcarray <input.asm> [output.h] [--array-name NAME] [--optimize]
+        Assemble and write a C header with const unsigned char NAME[] and a NAME_LEN macro
+        Example: python main.py createcarray program.asm rom_image.h --array-name program_rom
+
+    createcdefines <input.asm> [output.h] [--define-prefix PREFIX] [--mangle] [--optimize]
+        Assemble and write "#define NAME value" for every label (hex address) and constant (decimal)
+        Names reserved in C (local labels' "__", a leading "_") fail unless PREFIX or --mangle fixes them
+        Example: python main.py createcdefines program.asm program_symbols.h --define-prefix ARNI_ --mangle
+
+    dumpjson <input.asm> [output.json] [--optimize]
+        Assemble and write the program as JSON: labels, constants, and every statement with its
+        address, mnemonic, bytes, and operands (expressions as parse trees) for external tools
+        Example: python main.py dumpjson program.asm program.json
+
+    buildmatrix <input.asm> <matrix.txt> [--optimize]
+        Assemble one binary text output per define-set line ("out.txt NAME=value ...")
+        Example: python main.py buildmatrix program.asm variants.txt
+
+    createbase64 <input.asm> [output.b64] [--gzip] [--optimize]
+        Assemble and write the program bytes as one base64 line (--gzip compresses first)
+        Example: python main.py createbase64 program.asm program.b64 --gzip
+
+    createrecord <input.asm> [output.rec] [--record-width N] [--optimize]
+        Assemble and write one "AAAA NN B0 B1 ..." record per instruction, padded to N bytes (default 4)
+        Example: python main.py createrecord program.asm program.rec --record-width 8
+
+    decodebase64 <input.b64> [output.txt]
+        Decode a base64 blob (plain or gzip) back to binary text format
+        Example: python main.py decodebase64 program.b64 program.txt
+
+    dumpast "<expression>" [input.asm] [--optimize]
+        Print the parse tree of an operand expression with each node's value, using the labels and
+        constants of input.asm when given
+        Example: python main.py dumpast "(@table + $OFFSET * 2) >> 1" program.asm
+
+    run <program.asm|image.bin|image.hex|input.txt> [--max-steps N] [--stack-base ADDR] [--dump ADDR[:COUNT]] [--device NAME[@ADDR]] [--uart-input TEXT] [--timing] [--symbols program.sym] [--trace trace.log] [--save-state PATH] [--load-state PATH]
+        Execute a program in the arnicomp-v2 emulator and print the final registers, flags, SP, and MAR;
+        stops at HLT, an idle loop such as `end: JMP end`, or after N steps (default 1000000).
+        --stack-base sets the initial SP (default 0x0D00); --dump prints COUNT (default 16) RAM bytes, repeatable.
+        --device maps a peripheral model (uart at 0x0900, led at 0x0C00 unless @ADDR is given), repeatable;
+        --uart-input gives the bytes the UART receives. --timing reports the cycles spent under each code label,
+        hottest first, taking labels from the source or from --symbols for an image. --trace writes every executed
+        instruction with its register, flag, and SP changes and RAM writes; a .jsonl path writes one JSON object per line.
+        --save-state writes the machine state (registers, RAM, devices, cycles) after the run; --load-state resumes
+        the same program from such a snapshot, recreating its devices, with --uart-input queued after saved input
+        Example: python main.py run program.asm --dump 0x0100:32
+        Example: python main.py run hello.asm --device uart --device led
+
+    debug <program.asm|image.bin|image.hex|input.txt> [--symbols program.sym] [--source-map program.map.json] [--stack-base ADDR]
+        Start an interactive debugger on the emulator: breakpoints by label or address, single-step,
+        register and RAM inspection, and watch expressions, showing the source line of each stop.
+        An image takes its labels from --symbols and its source lines from --source-map; type 'help' in the session
+        Example: python main.py debug program.asm
+
+    gdbserver <program.asm|image.bin|image.hex|input.txt> [--port N] [--host ADDR] [--stack-base ADDR] [--device NAME[@ADDR]]
+        Serve the emulator over the GDB remote serial protocol (default 127.0.0.1:1234) for GDB and IDE front-ends:
+        registers, ROM at 0x0000 and RAM at 0x10000, breakpoints, stepping, and continue with Ctrl-C
+        Example: python main.py gdbserver program.asm --port 3333
+
+    test <program.asm> [--max-steps N] [--stack-base ADDR] [--device NAME[@ADDR]]
+        Assemble a program with its .test/.endtest blocks and run each in a fresh emulator; a test passes when it
+        reaches its .endtest without a failed .assert. Prints PASS/FAIL per test and exits 1 if any fails.
+        .assert also stops run and debug when false. Default step limit per test: 1000000
+        Example: python main.py test math_tests.asm
+
+    flash <program.asm|image.bin|image.hex|input.txt> [--port PORT] [--baud N] [--fill BYTE]
+        Assemble a source file, or read an image, and send it to the EEPROM programmer with the same 'L' load
+        protocol as load, from 0x0000 with --fill (default 0x00) in gaps the image leaves. The programmer does not acknowledge,
+        so flash prints the size, sum16, and CRC-32 it sent. Defaults: port /dev/ttyACM0, 115200 baud. Needs pyserial
+        Example: python main.py flash program.asm --port /dev/ttyUSB0 --baud 57600
+
     load <binary.bin>
         Load a binary file to EEPROM
         Example: python main.py load program.bin
@@ -712,10 +1935,66 @@ REGISTERS:
         - emitted bytes
         - source file and line
         - original source text
-        --listing-mode hex|asm|both
-        Choose hex summary view, expanded assembly view, or both
+        -o, --output PATH
+        Output file, as an alternative to the positional [output] argument
+        --error-format default|gnu
+        gnu reports errors and warnings as "file:line:column: severity: message" for editors and IDEs
+        --listing-mode hex|asm|both|bitfields
+        Choose hex summary view, expanded assembly view, both, or each byte split into encoding fields
+        --group-digits N [--group-separator _]
+        Add each byte in binary to the assembly view, grouped every N digits (e.g. 1100_0001)
         --optimize
         Enable monotonic address-path relaxation for smaller codegen
+        --partial [--placeholder BYTE]
+        Replace lines that fail to encode with BYTE (default 0x00 = NOP), write outputs anyway, exit nonzero
+        --suggest-optimize
+        Keep canonical output but warn about each line --optimize would shrink, with bytes saved
+        --verify-roundtrip (also --verify)
+        Disassemble the emitted bytes, reassemble them, and fail on any mismatch
+        --check-reachability
+        Warn about code that static control flow from 0x0000 never reaches
+        --undef-zero
+        Assemble undefined labels and constants as 0 with a warning per reference (development builds only)
+        --warn-symbol-case
+        Warn when label and constant names differ only in letter case (names are case-insensitive)
+        --strict-case
+        Lint: fail when a label or constant is referenced or redefined in a different letter case than its first definition
+        --max-include-depth N
+        Fail when .include nests more than N files deep (default 64); the error shows the include chain
+        --max-macro-depth N
+        Fail when macro invocations nest more than N deep (default 32); the error shows the macro chain
+        -I DIR (also -IDIR, --include-path DIR)
+        Search DIR for a relative .include not found next to the including file; repeat for more directories
+        --stack-depth
+        Report the maximum PUSH/POP depth from 0x0000 and each CALL target; warn on underflow and unbalanced joins
+        -D NAME=value (also -DNAME=value, --define NAME=value)
+        Define NAME like an equ constant, visible to .if/.ifdef conditions and expressions; repeatable
+        --fail-fast
+        Stop at the first encoding error instead of reporting every failing line
+        --stats
+        Print how many times each mnemonic appears, most frequent first
+        --syntax PROFILE
+        Parse another assembler's dialect: arnicomp (default), intel (0FFh, ORG, DS), gnu (// comments, .balign, .space)
+        --data-base ADDR
+        First RAM address of the .data section (default 0x0000); .data labels count up from it
+        --map PATH
+        Write a memory map: section sizes, ROM used and free, free blocks, and every label's address
+        --symbols PATH
+        Write labels for emulators and debuggers: `ADDRESS NAME` lines, or JSON when PATH ends in .json
+        --source-map PATH
+        Write JSON mapping each emitted address range to its file, line, and macro expansion stack
+        --rom-size N
+        ROM size the map measures free space against (default 64K; 32K or 0x8000 style)
+        --target arnicomp-v1|arnicomp-v2
+        Encode for the original v1 CPU (instruction table from the repository's config/config.json) or the current v2 ISA (default)
+        --length-prefix N
+        Prepend the program length as an N-byte little-endian field (N = 1..4) for loaders that strip it
+        --byteswap
+        Swap each pair of adjacent output bytes (16-bit word byte order); the program must be an even length
+        --append-crc
+        Append the CRC-16/CCITT-FALSE of the whole program, low byte first, before --byteswap and --length-prefix
+        --crlf
+        Write text outputs (binary text, hex, mem, mi, listings) with CRLF line endings; LF is the default
 
 EXAMPLES:
     equ TARGET 0x1234
@@ -731,6 +2010,14 @@ EXAMPLES:
         JGE retry :RD
         HLT
 
+PROJECT CONFIG:
+    A .asmconfig JSON file in the source directory or any parent sets defaults for
+    "syntax", "comment", "block_comment_start", "block_comment_end", "optimize", "listing_mode", "crlf",
+    "target", "include_paths" (relative to the .asmconfig), and "pseudo_instructions".
+    "endianness" is rejected: instructions are single bytes and multi-byte fields are little-endian
+    (.endian big in the source switches .word tables).
+    Precedence: command-line flags > .asmconfig > config/config.json defaults.
+
 NOTES:
     - Bare jumps with no operand still jump to the address already in PRH:PRL.
     - Jump forms with a label or constant target are assembler pseudoinstructions:
@@ -748,16 +2035,24 @@ NOTES:
 
 def main():
     """Main entry point for the CLI"""
-    def parse_assemble_args(arguments, allow_depth: bool = False):
+    def parse_assemble_args(
+        arguments,
+        allow_depth: bool = False,
+        allow_array_name: bool = False,
+        allow_gzip: bool = False,
+        allow_record_width: bool = False,
+        allow_c_defines: bool = False,
+        allow_compile_object: bool = False,
+    ) -> AssembleArgs:
         if not arguments:
             raise ValueError("Input file required")
 
-        input_file = arguments[0]
-        output_file = None
-        depth = None
-        listing_file = None
-        listing_mode = "hex"
-        optimize = False
+        parsed = AssembleArgs(input_file=arguments[0])
+        project_config_path = find_project_config(os.path.dirname(os.path.abspath(parsed.input_file)))
+        if project_config_path is not None:
+            parsed.apply_project_config(load_project_config(project_config_path))
+        # -I directories replace the .asmconfig include_paths rather than adding to them.
+        include_paths = []
         index = 1
 
         while index < len(arguments):
@@ -765,16 +2060,51 @@ def main():
             if token == "--listing":
                 if index + 1 >= len(arguments):
                     raise ValueError("--listing requires an output path")
-                listing_file = arguments[index + 1]
+                parsed.listing_file = arguments[index + 1]
+                index += 2
+                continue
+
+            if token in {"-o", "--output"}:
+                if index + 1 >= len(arguments):
+                    raise ValueError(f"{token} requires an output path")
+                if parsed.output_file is not None:
+                    raise ValueError(f"Output file given twice: {parsed.output_file} and {arguments[index + 1]}")
+                parsed.output_file = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--error-format":
+                if index + 1 >= len(arguments) or arguments[index + 1] not in {"default", "gnu"}:
+                    raise ValueError("--error-format must be default or gnu")
+                parsed.error_format = arguments[index + 1]
                 index += 2
                 continue
 
             if token == "--listing-mode":
                 if index + 1 >= len(arguments):
-                    raise ValueError("--listing-mode requires one of: hex, asm, both")
-                listing_mode = arguments[index + 1].lower()
-                if listing_mode not in {"hex", "asm", "both"}:
-                    raise ValueError("--listing-mode must be one of: hex, asm, both")
+                    raise ValueError("--listing-mode requires one of: hex, asm, both, bitfields")
+                parsed.listing_mode = arguments[index + 1].lower()
+                if parsed.listing_mode not in {"hex", "asm", "both", "bitfields"}:
+                    raise ValueError("--listing-mode must be one of: hex, asm, both, bitfields")
+                index += 2
+                continue
+
+            if token == "--group-digits":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--group-digits requires a positive integer value")
+                try:
+                    parsed.group_digits = int(arguments[index + 1])
+                except ValueError as exc:
+                    raise ValueError("--group-digits requires a positive integer value") from exc
+                if parsed.group_digits <= 0:
+                    raise ValueError("--group-digits requires a positive integer value")
+                index += 2
+                continue
+
+            if token == "--group-separator":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--group-separator requires a separator string")
+                parsed.group_separator = arguments[index + 1]
                 index += 2
                 continue
 
@@ -784,27 +2114,295 @@ def main():
                 if index + 1 >= len(arguments):
                     raise ValueError("--depth requires a positive integer value")
                 try:
-                    depth = int(arguments[index + 1])
+                    parsed.depth = int(arguments[index + 1])
                 except ValueError as exc:
                     raise ValueError("--depth requires a positive integer value") from exc
-                if depth <= 0:
+                if parsed.depth <= 0:
                     raise ValueError("--depth requires a positive integer value")
                 index += 2
                 continue
 
+            if token == "--array-name":
+                if not allow_array_name:
+                    raise ValueError("--array-name is not supported for this command")
+                if index + 1 >= len(arguments):
+                    raise ValueError("--array-name requires a C identifier")
+                parsed.array_name = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--record-width":
+                if not allow_record_width:
+                    raise ValueError("--record-width is not supported for this command")
+                if index + 1 >= len(arguments):
+                    raise ValueError("--record-width requires a positive integer value")
+                try:
+                    parsed.record_width = int(arguments[index + 1])
+                except ValueError as exc:
+                    raise ValueError("--record-width requires a positive integer value") from exc
+                if parsed.record_width <= 0:
+                    raise ValueError("--record-width requires a positive integer value")
+                index += 2
+                continue
+
+            if token == "--define-prefix":
+                if not allow_c_defines:
+                    raise ValueError("--define-prefix is not supported for this command")
+                if index + 1 >= len(arguments):
+                    raise ValueError("--define-prefix requires a prefix")
+                parsed.define_prefix = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--mangle":
+                if not allow_c_defines:
+                    raise ValueError("--mangle is not supported for this command")
+                parsed.mangle = True
+                index += 1
+                continue
+
+            if token == "--gzip":
+                if not allow_gzip:
+                    raise ValueError("--gzip is not supported for this command")
+                parsed.gzip = True
+                index += 1
+                continue
+
             if token == "--optimize":
-                optimize = True
+                parsed.optimize = True
                 index += 1
                 continue
 
-            if output_file is None:
-                output_file = token
+            if token == "-c":
+                if not allow_compile_object:
+                    raise ValueError("-c is only supported by assemble")
+                parsed.compile_object = True
+                index += 1
+                continue
+
+            if token in {"--verify", "--verify-roundtrip"}:
+                parsed.verify_roundtrip = True
+                index += 1
+                continue
+
+            if token == "--partial":
+                parsed.partial = True
+                index += 1
+                continue
+
+            if token == "--placeholder":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--placeholder requires a byte value")
+                try:
+                    parsed.placeholder = int(arguments[index + 1], 0)
+                except ValueError as exc:
+                    raise ValueError("--placeholder requires a byte value such as 0x00 or 0xFF") from exc
+                if not 0 <= parsed.placeholder <= 0xFF:
+                    raise ValueError("--placeholder must be between 0x00 and 0xFF")
+                index += 2
+                continue
+
+            if token == "--data-base":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--data-base requires an address")
+                try:
+                    parsed.data_base = int(arguments[index + 1], 0)
+                except ValueError as exc:
+                    raise ValueError("--data-base requires an address such as 0x0100") from exc
+                if not 0 <= parsed.data_base <= 0xFFFF:
+                    raise ValueError("--data-base must be between 0x0000 and 0xFFFF")
+                index += 2
+                continue
+
+            if token == "--map":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--map requires an output path")
+                parsed.map_file = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--symbols":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--symbols requires an output path")
+                parsed.symbols_file = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--source-map":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--source-map requires an output path")
+                parsed.source_map_file = arguments[index + 1]
+                index += 2
+                continue
+
+            if token == "--rom-size":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--rom-size requires a size such as 32K")
+                parsed.rom_size = parse_rom_size(arguments[index + 1])
+                index += 2
+                continue
+
+            if token == "--suggest-optimize":
+                parsed.suggest_optimize = True
+                index += 1
+                continue
+
+            if token in {"-D", "--define"} or (token.startswith("-D") and len(token) > 2):
+                if token in {"-D", "--define"}:
+                    if index + 1 >= len(arguments):
+                        raise ValueError(f"{token} requires NAME=value")
+                    define_text = arguments[index + 1]
+                    index += 2
+                else:
+                    define_text = token[2:]
+                    index += 1
+                name, value = parse_define(define_text, AssemblyHelper().evaluate_expression)
+                if name in parsed.defines and parsed.defines[name] != value:
+                    raise ValueError(f"{name} defined twice on the command line: {parsed.defines[name]} and {value}")
+                parsed.defines[name] = value
+                continue
+
+            if token == "--fail-fast":
+                parsed.fail_fast = True
+                index += 1
+                continue
+
+            if token == "--stats":
+                parsed.stats = True
+                index += 1
+                continue
+
+            if token == "--byteswap":
+                parsed.byteswap = True
+                index += 1
+                continue
+
+            if token == "--append-crc":
+                parsed.append_crc = True
+                index += 1
+                continue
+
+            if token == "--crlf":
+                parsed.crlf = True
+                index += 1
+                continue
+
+            if token == "--syntax":
+                if index + 1 >= len(arguments):
+                    raise ValueError(f"--syntax requires one of: {', '.join(SYNTAX_PROFILES)}")
+                parsed.apply_syntax_profile(arguments[index + 1])
+                index += 2
+                continue
+
+            if token == "--target":
+                if index + 1 >= len(arguments):
+                    raise ValueError(f"--target requires one of: {', '.join(TARGETS)}")
+                parsed.target = normalize_target(arguments[index + 1])
+                index += 2
+                continue
+
+            if token == "--length-prefix":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--length-prefix requires a field width of 1 to 4 bytes")
+                try:
+                    parsed.length_prefix = int(arguments[index + 1])
+                except ValueError as exc:
+                    raise ValueError("--length-prefix requires a field width of 1 to 4 bytes") from exc
+                if not 1 <= parsed.length_prefix <= 4:
+                    raise ValueError("--length-prefix requires a field width of 1 to 4 bytes")
+                index += 2
+                continue
+
+            if token == "--undef-zero":
+                parsed.undef_zero = True
+                index += 1
+                continue
+
+            if token == "--max-include-depth":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--max-include-depth requires a positive number")
+                try:
+                    parsed.max_include_depth = int(arguments[index + 1])
+                except ValueError as exc:
+                    raise ValueError("--max-include-depth requires a positive number") from exc
+                if parsed.max_include_depth < 1:
+                    raise ValueError("--max-include-depth requires a positive number")
+                index += 2
+                continue
+
+            if token == "--max-macro-depth":
+                if index + 1 >= len(arguments):
+                    raise ValueError("--max-macro-depth requires a positive number")
+                try:
+                    parsed.max_macro_depth = int(arguments[index + 1])
+                except ValueError as exc:
+                    raise ValueError("--max-macro-depth requires a positive number") from exc
+                if parsed.max_macro_depth < 1:
+                    raise ValueError("--max-macro-depth requires a positive number")
+                index += 2
+                continue
+
+            if token in {"-I", "--include-path"} or (token.startswith("-I") and len(token) > 2):
+                if token in {"-I", "--include-path"}:
+                    if index + 1 >= len(arguments):
+                        raise ValueError(f"{token} requires a directory")
+                    include_paths.append(os.path.abspath(arguments[index + 1]))
+                    index += 2
+                else:
+                    include_paths.append(os.path.abspath(token[2:]))
+                    index += 1
+                continue
+
+            if token == "--warn-symbol-case":
+                parsed.warn_symbol_case = True
+                index += 1
+                continue
+
+            if token == "--strict-case":
+                parsed.strict_case = True
+                index += 1
+                continue
+
+            if token == "--stack-depth":
+                parsed.stack_depth = True
+                index += 1
+                continue
+
+            if token == "--check-reachability":
+                parsed.check_reachability = True
+                index += 1
+                continue
+
+            if parsed.output_file is None:
+                parsed.output_file = token
                 index += 1
                 continue
 
             raise ValueError(f"Unexpected assemble argument: {token}")
 
-        return input_file, output_file, depth, listing_file, listing_mode, optimize
+        if include_paths:
+            parsed.include_paths = include_paths
+        if parsed.stack_depth and parsed.target != TARGET_V2:
+            raise ValueError(f"--stack-depth is only available for the {TARGET_V2} target")
+        if parsed.compile_object and (
+            parsed.listing_file or parsed.optimize or parsed.partial or parsed.map_file or parsed.symbols_file
+            or parsed.source_map_file
+        ):
+            raise ValueError(
+                "-c writes an object file; --listing, --map, --symbols, --source-map, --optimize, and --partial belong on link"
+            )
+        return parsed
+
+    def parse_link_args(arguments):
+        """Split link arguments into the leading object files and the assemble options after them"""
+        object_files = []
+        while len(object_files) < len(arguments) and not arguments[len(object_files)].startswith("-"):
+            object_files.append(arguments[len(object_files)])
+        if not object_files:
+            raise ValueError("At least one object file required")
+        # The first object stands in as the input file, so its folder's .asmconfig applies.
+        parsed = parse_assemble_args([object_files[0], *arguments[len(object_files):]])
+        return object_files, parsed
 
     # Parse command line arguments
     if len(sys.argv) < 2:
@@ -827,14 +2425,36 @@ def main():
             print("Usage: python main.py assemble <input.asm> [output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
 
+        arguments = sys.argv[2:]
+        if arguments[0] == "-c":
+            # `assemble -c file.asm` reads naturally; the parser expects the input file first.
+            arguments = arguments[1:] + arguments[:1]
         try:
-            input_file, output_file, _, listing_file, listing_mode, optimize = parse_assemble_args(sys.argv[2:])
+            args = parse_assemble_args(arguments, allow_compile_object=True)
         except ValueError as e:
             print(f"Error: {e}")
             print("Usage: python main.py assemble <input.asm> [output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
+        cli.configure(args)
 
-        cli.assemble(input_file, output_file, listing_file, listing_mode, optimize)
+        if args.compile_object:
+            cli.compile_object(args.input_file, args.output_file)
+        else:
+            cli.assemble(args.input_file, args.output_file, args.listing_file, args.listing_mode, args.optimize)
+
+    elif command == "link":
+        if len(sys.argv) < 3:
+            print("Error: Object file required")
+            print("Usage: python main.py link <a.o> [b.o ...] [-o output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
+            sys.exit(1)
+        try:
+            object_files, args = parse_link_args(sys.argv[2:])
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py link <a.o> [b.o ...] [-o output.txt] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.link(object_files, args.output_file, args.listing_file, args.listing_mode, args.optimize)
     
     elif command == "disassemble":
         if len(sys.argv) < 3:
@@ -845,16 +2465,247 @@ def main():
         input_file = sys.argv[2]
         output_file = sys.argv[3] if len(sys.argv) >= 4 else None
         cli.disassemble(input_file, output_file)
+
+    elif command == "run":
+        from modules.Devices import parse_device_spec
+        from modules.Emulator import DEFAULT_MAX_STEPS, DEFAULT_STACK_BASE
+
+        usage = "Usage: python main.py run <program.asm|image.bin|image.hex|input.txt> [--max-steps N] [--stack-base ADDR] [--dump ADDR[:COUNT]] [--device NAME[@ADDR]] [--uart-input TEXT] [--timing] [--symbols program.sym] [--trace trace.log] [--save-state PATH] [--load-state PATH]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        max_steps = DEFAULT_MAX_STEPS
+        stack_base = DEFAULT_STACK_BASE
+        dumps = []
+        devices = []
+        uart_input = b""
+        timing = False
+        symbols_file = None
+        trace_file = None
+        save_state_file = None
+        load_state_file = None
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if token == "--timing":
+                    timing = True
+                    index += 1
+                    continue
+                if index + 1 >= len(sys.argv) or token not in {"--max-steps", "--stack-base", "--dump", "--device", "--uart-input", "--symbols", "--trace", "--save-state", "--load-state"}:
+                    raise ValueError(f"Unexpected run argument: {token}")
+                value = sys.argv[index + 1]
+                if token == "--max-steps":
+                    max_steps = int(value, 0)
+                    if max_steps < 1:
+                        raise ValueError("--max-steps requires a positive number")
+                elif token == "--stack-base":
+                    stack_base = int(value, 0)
+                    if not 0 <= stack_base <= 0xFFFF:
+                        raise ValueError("--stack-base must be between 0x0000 and 0xFFFF")
+                elif token == "--device":
+                    devices.append(parse_device_spec(value))
+                elif token == "--uart-input":
+                    uart_input = value.encode("utf-8").decode("unicode_escape").encode("latin-1")
+                elif token == "--symbols":
+                    symbols_file = value
+                elif token == "--trace":
+                    trace_file = value
+                elif token == "--save-state":
+                    save_state_file = value
+                elif token == "--load-state":
+                    load_state_file = value
+                else:
+                    start_text, _, count_text = value.partition(":")
+                    start, count = int(start_text, 0), int(count_text, 0) if count_text else 16
+                    if not 0 <= start <= 0xFFFF or count < 1:
+                        raise ValueError("--dump requires ADDR[:COUNT] with ADDR in 0x0000-0xFFFF and COUNT positive")
+                    dumps.append((start, count))
+                index += 2
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(usage)
+            sys.exit(1)
+        if uart_input and not load_state_file and not any(name == "uart" for name, _, _ in devices):
+            print("Error: --uart-input requires --device uart")
+            print(usage)
+            sys.exit(1)
+        cli.run_program(sys.argv[2], max_steps, stack_base, dumps, devices, uart_input, timing, symbols_file, trace_file, save_state_file, load_state_file)
+
+    elif command == "gdbserver":
+        from modules.Devices import parse_device_spec
+        from modules.Emulator import DEFAULT_STACK_BASE
+        from modules.GdbStub import DEFAULT_PORT
+
+        usage = "Usage: python main.py gdbserver <program.asm|image.bin|image.hex|input.txt> [--port N] [--host ADDR] [--stack-base ADDR] [--device NAME[@ADDR]]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        host = "127.0.0.1"
+        port = DEFAULT_PORT
+        stack_base = DEFAULT_STACK_BASE
+        devices = []
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if index + 1 >= len(sys.argv) or token not in {"--port", "--host", "--stack-base", "--device"}:
+                    raise ValueError(f"Unexpected gdbserver argument: {token}")
+                value = sys.argv[index + 1]
+                if token == "--port":
+                    port = int(value, 0)
+                    if not 0 <= port <= 0xFFFF:
+                        raise ValueError("--port must be between 0 and 65535")
+                elif token == "--host":
+                    host = value
+                elif token == "--stack-base":
+                    stack_base = int(value, 0)
+                    if not 0 <= stack_base <= 0xFFFF:
+                        raise ValueError("--stack-base must be between 0x0000 and 0xFFFF")
+                else:
+                    devices.append(parse_device_spec(value))
+                index += 2
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(usage)
+            sys.exit(1)
+        cli.gdb_server(sys.argv[2], host, port, stack_base, devices)
+
+    elif command == "test":
+        from modules.Devices import parse_device_spec
+        from modules.Emulator import DEFAULT_MAX_STEPS, DEFAULT_STACK_BASE
+
+        usage = "Usage: python main.py test <program.asm> [--max-steps N] [--stack-base ADDR] [--device NAME[@ADDR]]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        max_steps = DEFAULT_MAX_STEPS
+        stack_base = DEFAULT_STACK_BASE
+        devices = []
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if index + 1 >= len(sys.argv) or token not in {"--max-steps", "--stack-base", "--device"}:
+                    raise ValueError(f"Unexpected test argument: {token}")
+                value = sys.argv[index + 1]
+                if token == "--max-steps":
+                    max_steps = int(value, 0)
+                    if max_steps < 1:
+                        raise ValueError("--max-steps requires a positive number")
+                elif token == "--stack-base":
+                    stack_base = int(value, 0)
+                    if not 0 <= stack_base <= 0xFFFF:
+                        raise ValueError("--stack-base must be between 0x0000 and 0xFFFF")
+                else:
+                    devices.append(parse_device_spec(value))
+                index += 2
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(usage)
+            sys.exit(1)
+        cli.test_program(sys.argv[2], max_steps, stack_base, devices)
+
+    elif command == "debug":
+        from modules.Emulator import DEFAULT_STACK_BASE
+
+        usage = "Usage: python main.py debug <program.asm|image.bin|image.hex|input.txt> [--symbols program.sym] [--source-map program.map.json] [--stack-base ADDR]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        stack_base = DEFAULT_STACK_BASE
+        symbols_file = None
+        source_map_file = None
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if index + 1 >= len(sys.argv) or token not in {"--symbols", "--source-map", "--stack-base"}:
+                    raise ValueError(f"Unexpected debug argument: {token}")
+                value = sys.argv[index + 1]
+                if token == "--symbols":
+                    symbols_file = value
+                elif token == "--source-map":
+                    source_map_file = value
+                else:
+                    stack_base = int(value, 0)
+                    if not 0 <= stack_base <= 0xFFFF:
+                        raise ValueError("--stack-base must be between 0x0000 and 0xFFFF")
+                index += 2
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(usage)
+            sys.exit(1)
+        cli.debug_program(sys.argv[2], stack_base, symbols_file, source_map_file)
+
+    elif command == "disasm":
+        usage = "Usage: python main.py disasm <image.bin|image.hex|input.txt> [output.asm] [--symbols program.sym]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        input_file = sys.argv[2]
+        output_file = None
+        symbols_file = None
+        index = 3
+        while index < len(sys.argv):
+            token = sys.argv[index]
+            if token == "--symbols" and index + 1 < len(sys.argv):
+                symbols_file = sys.argv[index + 1]
+                index += 2
+            elif not token.startswith("-") and output_file is None:
+                output_file = token
+                index += 1
+            else:
+                print(f"Error: Unexpected disasm argument: {token}")
+                print(usage)
+                sys.exit(1)
+        cli.disasm(input_file, output_file, symbols_file)
     
     elif command == "createbin":
         if len(sys.argv) < 3:
             print("Error: Input file required")
-            print("Usage: python main.py createbin <input.txt> [output.bin]")
+            print("Usage: python main.py createbin <input.txt> [output.bin] [--rom-size N] [--fill BYTE] [--split hi,lo|lo,hi|even,odd]")
             sys.exit(1)
-        
+
         input_file = sys.argv[2]
-        output_file = sys.argv[3] if len(sys.argv) >= 4 else None
-        cli.create_bin(input_file, output_file)
+        output_file = None
+        rom_size = 65536
+        fill_byte = 0x00
+        split = None
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if token in {"--rom-size", "--fill", "--split"}:
+                    if index + 1 >= len(sys.argv):
+                        raise ValueError(f"{token} requires a value")
+                    if token == "--rom-size":
+                        rom_size = parse_rom_size(sys.argv[index + 1])
+                    elif token == "--split":
+                        split = parse_split(sys.argv[index + 1])
+                    else:
+                        fill_byte = parse_fill_byte(sys.argv[index + 1])
+                    index += 2
+                elif output_file is None:
+                    output_file = token
+                    index += 1
+                else:
+                    raise ValueError(f"Unexpected createbin argument: {token}")
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createbin <input.txt> [output.bin] [--rom-size N] [--fill BYTE] [--split hi,lo|lo,hi|even,odd]")
+            sys.exit(1)
+        cli.create_bin(input_file, output_file, rom_size, fill_byte, split)
     
     elif command == "createihex":
         if len(sys.argv) < 3:
@@ -862,12 +2713,13 @@ def main():
             print("Usage: python main.py createihex <input.asm> [output.hex] [--optimize]")
             sys.exit(1)
         try:
-            input_file, output_file, _, _, _, optimize = parse_assemble_args(sys.argv[2:])
+            args = parse_assemble_args(sys.argv[2:])
         except ValueError as e:
             print(f"Error: {e}")
             print("Usage: python main.py createihex <input.asm> [output.hex] [--optimize]")
             sys.exit(1)
-        cli.create_ihex(input_file, output_file, optimize=optimize)
+        cli.configure(args)
+        cli.create_ihex(args.input_file, args.output_file, optimize=args.optimize)
 
     elif command == "createsvhex":
         if len(sys.argv) < 3:
@@ -875,12 +2727,13 @@ def main():
             print("Usage: python main.py createsvhex <input.asm> [output.mem] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
         try:
-            input_file, output_file, _, listing_file, listing_mode, optimize = parse_assemble_args(sys.argv[2:])
+            args = parse_assemble_args(sys.argv[2:])
         except ValueError as e:
             print(f"Error: {e}")
             print("Usage: python main.py createsvhex <input.asm> [output.mem] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
-        cli.create_svhex(input_file, output_file, listing_file, listing_mode, optimize)
+        cli.configure(args)
+        cli.create_svhex(args.input_file, args.output_file, args.listing_file, args.listing_mode, args.optimize)
 
     elif command == "createsvmi":
         if len(sys.argv) < 3:
@@ -888,12 +2741,43 @@ def main():
             print("Usage: python main.py createsvmi <input.asm> [output.mi] [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
         try:
-            input_file, output_file, depth, listing_file, listing_mode, optimize = parse_assemble_args(sys.argv[2:], allow_depth=True)
+            args = parse_assemble_args(sys.argv[2:], allow_depth=True)
         except ValueError as e:
             print(f"Error: {e}")
             print("Usage: python main.py createsvmi <input.asm> [output.mi] [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
-        cli.create_svmi(input_file, output_file, depth, listing_file, listing_mode, optimize)
+        cli.configure(args)
+        cli.create_svmi(args.input_file, args.output_file, args.depth, args.listing_file, args.listing_mode, args.optimize)
+
+    elif command in {"createmif", "createcoe"}:
+        file_format = command[len("create"):]
+        usage = f"python main.py {command} <input.asm> [output.{file_format}] [--depth N] [--optimize]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(f"Usage: {usage}")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:], allow_depth=True)
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(f"Usage: {usage}")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_memory_init(args.input_file, args.output_file, file_format, args.depth, args.optimize)
+
+    elif command == "createlogisim":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py createlogisim <input.asm> [output.img] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:])
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createlogisim <input.asm> [output.img] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_logisim(args.input_file, args.output_file, args.optimize)
 
     elif command == "creategowinprom":
         if len(sys.argv) < 4:
@@ -901,16 +2785,160 @@ def main():
             print("Usage: python main.py creategowinprom <input.asm> <gowin_prom.v> [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
         try:
-            input_file, output_file, depth, listing_file, listing_mode, optimize = parse_assemble_args(sys.argv[2:], allow_depth=True)
+            args = parse_assemble_args(sys.argv[2:], allow_depth=True)
         except ValueError as e:
             print(f"Error: {e}")
             print("Usage: python main.py creategowinprom <input.asm> <gowin_prom.v> [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
-        if output_file is None:
+        cli.configure(args)
+        if args.output_file is None:
             print("Error: Gowin pROM file path required")
             print("Usage: python main.py creategowinprom <input.asm> <gowin_prom.v> [--depth N] [--listing output.lst] [--listing-mode hex|asm|both] [--optimize]")
             sys.exit(1)
-        cli.create_gowin_prom(input_file, output_file, depth or 4096, listing_file, listing_mode, optimize)
+        cli.create_gowin_prom(args.input_file, args.output_file, args.depth or 4096, args.listing_file, args.listing_mode, args.optimize)
+
+    elif command == "createcarray":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py createcarray <input.asm> [output.h] [--array-name NAME] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:], allow_array_name=True)
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createcarray <input.asm> [output.h] [--array-name NAME] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_carray(args.input_file, args.output_file, args.array_name, args.optimize)
+
+    elif command == "createcdefines":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py createcdefines <input.asm> [output.h] [--define-prefix PREFIX] [--mangle] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:], allow_c_defines=True)
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createcdefines <input.asm> [output.h] [--define-prefix PREFIX] [--mangle] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_c_defines(args.input_file, args.output_file, args.define_prefix, args.mangle, args.optimize)
+
+    elif command == "dumpjson":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py dumpjson <input.asm> [output.json] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:])
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py dumpjson <input.asm> [output.json] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.dump_json(args.input_file, args.output_file, args.optimize)
+
+    elif command == "buildmatrix":
+        if len(sys.argv) < 4:
+            print("Error: Input assembly file and build matrix file required")
+            print("Usage: python main.py buildmatrix <input.asm> <matrix.txt> [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:])
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py buildmatrix <input.asm> <matrix.txt> [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.build_matrix(args.input_file, args.output_file, args.optimize)
+
+    elif command == "createbase64":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py createbase64 <input.asm> [output.b64] [--gzip] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:], allow_gzip=True)
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createbase64 <input.asm> [output.b64] [--gzip] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_base64(args.input_file, args.output_file, args.gzip, args.optimize)
+
+    elif command == "createrecord":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py createrecord <input.asm> [output.rec] [--record-width N] [--optimize]")
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[2:], allow_record_width=True)
+        except ValueError as e:
+            print(f"Error: {e}")
+            print("Usage: python main.py createrecord <input.asm> [output.rec] [--record-width N] [--optimize]")
+            sys.exit(1)
+        cli.configure(args)
+        cli.create_record(args.input_file, args.output_file, args.record_width, args.optimize)
+
+    elif command == "decodebase64":
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print("Usage: python main.py decodebase64 <input.b64> [output.txt]")
+            sys.exit(1)
+
+        input_file = sys.argv[2]
+        output_file = sys.argv[3] if len(sys.argv) >= 4 else None
+        cli.decode_base64(input_file, output_file)
+
+    elif command == "dumpast":
+        if len(sys.argv) < 3:
+            print("Error: Expression required")
+            print('Usage: python main.py dumpast "<expression>" [input.asm] [--optimize]')
+            sys.exit(1)
+        try:
+            args = parse_assemble_args(sys.argv[3:]) if len(sys.argv) >= 4 else None
+        except ValueError as e:
+            print(f"Error: {e}")
+            print('Usage: python main.py dumpast "<expression>" [input.asm] [--optimize]')
+            sys.exit(1)
+        if args is not None:
+            cli.configure(args)
+        cli.dump_ast(sys.argv[2], args.input_file if args else None, args.optimize if args else False)
+
+    elif command == "flash":
+        from modules.SerialFlasher import DEFAULT_BAUD, DEFAULT_FILL
+
+        usage = "Usage: python main.py flash <program.asm|image.bin|image.hex|input.txt> [--port PORT] [--baud N] [--fill BYTE]"
+        if len(sys.argv) < 3:
+            print("Error: Input file required")
+            print(usage)
+            sys.exit(1)
+
+        port = None
+        baud = DEFAULT_BAUD
+        fill_byte = DEFAULT_FILL
+        index = 3
+        try:
+            while index < len(sys.argv):
+                token = sys.argv[index]
+                if index + 1 >= len(sys.argv) or token not in {"--port", "--baud", "--fill"}:
+                    raise ValueError(f"Unexpected flash argument: {token}")
+                value = sys.argv[index + 1]
+                if token == "--port":
+                    port = value
+                elif token == "--baud":
+                    baud = int(value, 0)
+                    if baud < 1:
+                        raise ValueError("--baud requires a positive number")
+                else:
+                    fill_byte = parse_fill_byte(value)
+                index += 2
+        except ValueError as e:
+            print(f"Error: {e}")
+            print(usage)
+            sys.exit(1)
+        cli.flash_program(sys.argv[2], port, baud, fill_byte)
 
     elif command == "load":
         if len(sys.argv) < 3:
@@ -948,6 +2976,10 @@ def main():
         print("Use 'python main.py help' for usage information")
         sys.exit(1)
 
+    if cli.partial_errors:
+        print(f"\nPartial build finished with {len(cli.partial_errors)} error(s)")
+        sys.exit(1)
+
 
 if __name__ == "__main__":
     main()
@@ -0,0 +1,157 @@
+"""
+AsmTest: golden-output checks that pin assembler behaviour across refactors, for this repo's
+tests and for projects that embed the assembler.
+
+    from modules.Assembler import AssembleOptions
+    from modules.AsmTest import expect_assembly, expect_golden
+
+    expect_assembly("LDI #3\nHLT", "C3 01")
+    expect_assembly("JMP nowhere", diagnostics=["<input>:1:1: error: Undefined label reference: nowhere"])
+    expect_golden(open("boot.asm").read(), "tests/boot.golden", AssembleOptions(source_name="boot.asm"))
+
+A mismatch raises AssertionError, so the checks work under unittest, pytest, or a plain script.
+Its message is a readable diff: differing bytes are listed by address with the source line that
+produced them, and diagnostics and golden files are compared as unified diffs.
+
+Expected bytes are `bytes`, a list of ints, or hex text, where whitespace and commas separate
+bytes and `;` starts a comment. A golden file holds a hex dump of the binary followed by the
+diagnostics; `expect_golden` writes it when it is missing, or when `update` is true or the
+ASMTEST_UPDATE environment variable is set, so accepted changes are re-recorded in one run.
+"""
+
+from __future__ import annotations
+
+import difflib
+import os
+import re
+from typing import Dict, Iterable, List, Optional, Sequence, Union
+
+from .Assembler import AssembleOptions, AssemblyResult, assemble
+
+
+UPDATE_ENV = "ASMTEST_UPDATE"
+GOLDEN_HEADER = "; arnicomp golden output: hex dump, then diagnostics"
+# At most this many differing bytes are listed; the rest are only counted.
+MAX_BYTE_ROWS = 16
+
+ExpectedBytes = Union[bytes, bytearray, str, Iterable[int]]
+
+
+def parse_expected_bytes(expected: ExpectedBytes) -> bytes:
+    if isinstance(expected, (bytes, bytearray)):
+        return bytes(expected)
+    if not isinstance(expected, str):
+        return bytes(expected)
+    values = bytearray()
+    for line in expected.splitlines():
+        for token in re.split(r"[\s,]+", line.split(";", 1)[0].strip()):
+            if not token:
+                continue
+            if not re.fullmatch(r"(0[xX])?[0-9A-Fa-f]{1,2}", token):
+                raise ValueError(f"Expected bytes must be hex values, got '{token}'")
+            values.append(int(token, 16))
+    return bytes(values)
+
+
+def source_lines_by_address(result: AssemblyResult) -> Dict[int, str]:
+    sources: Dict[int, str] = {}
+    for entry in result.listing:
+        for offset in range(len(entry.binary_bytes)):
+            sources[entry.address + offset] = f"{entry.source_name}:{entry.line_number}: {entry.source_text.strip()}"
+    return sources
+
+
+def diff_bytes(expected: bytes, actual: bytes, sources: Optional[Dict[int, str]] = None) -> List[str]:
+    """Describe where `actual` differs from `expected`; empty when they match."""
+    if expected == actual:
+        return []
+    sources = sources or {}
+    differing = [
+        address
+        for address in range(max(len(expected), len(actual)))
+        if address >= len(expected) or address >= len(actual) or expected[address] != actual[address]
+    ]
+    lines = [
+        f"bytes differ (expected {len(expected)} bytes, got {len(actual)}):",
+        "  addr  expected  actual  source",
+    ]
+    for address in differing[:MAX_BYTE_ROWS]:
+        want = f"{expected[address]:02X}" if address < len(expected) else "--"
+        got = f"{actual[address]:02X}" if address < len(actual) else "--"
+        lines.append(f"  {address:04X}  {want:<8}  {got:<6}  {sources.get(address, '')}".rstrip())
+    if len(differing) > MAX_BYTE_ROWS:
+        lines.append(f"  ... {len(differing) - MAX_BYTE_ROWS} more")
+    return lines
+
+
+def diff_text(expected: Sequence[str], actual: Sequence[str], heading: str) -> List[str]:
+    """Unified diff of two line lists under `heading`; empty when they match."""
+    if list(expected) == list(actual):
+        return []
+    return [heading] + [
+        line.rstrip("\n")
+        for line in difflib.unified_diff(list(expected), list(actual), "expected", "actual", lineterm="")
+    ]
+
+
+def compare_assembly(
+    source: Union[str, List[str]],
+    expected_bytes: Optional[ExpectedBytes] = None,
+    diagnostics: Optional[Sequence[str]] = None,
+    options: Optional[AssembleOptions] = None,
+) -> List[str]:
+    """Assemble `source` and return the differences from what is expected; empty on a match.
+
+    Without `diagnostics`, any error is a difference, so a source that should build cannot pass
+    by failing. With it, every diagnostic, warnings included, must match its `str()` in order.
+    """
+    result = assemble(source, options)
+    problems: List[str] = []
+    actual_diagnostics = [str(diagnostic) for diagnostic in result.diagnostics]
+    if diagnostics is not None:
+        problems.extend(diff_text(list(diagnostics), actual_diagnostics, "diagnostics differ:"))
+    elif not result.ok:
+        problems.append("assembly failed:")
+        problems.extend(f"  {text}" for text in actual_diagnostics)
+    if expected_bytes is not None and (result.ok or diagnostics is None):
+        problems.extend(diff_bytes(parse_expected_bytes(expected_bytes), result.binary, source_lines_by_address(result)))
+    return problems
+
+
+def expect_assembly(
+    source: Union[str, List[str]],
+    expected_bytes: Optional[ExpectedBytes] = None,
+    diagnostics: Optional[Sequence[str]] = None,
+    options: Optional[AssembleOptions] = None,
+) -> None:
+    """Raise AssertionError with a readable diff unless `source` assembles as expected."""
+    problems = compare_assembly(source, expected_bytes, diagnostics, options)
+    if problems:
+        raise AssertionError("\n".join(problems))
+
+
+def format_golden(result: AssemblyResult) -> List[str]:
+    lines = [GOLDEN_HEADER]
+    for start in range(0, len(result.binary), 16):
+        lines.append(f"{start:04X}: " + " ".join(f"{value:02X}" for value in result.binary[start:start + 16]))
+    lines.extend(str(diagnostic) for diagnostic in result.diagnostics)
+    return lines
+
+
+def expect_golden(
+    source: Union[str, List[str]],
+    golden_path: str,
+    options: Optional[AssembleOptions] = None,
+    update: bool = False,
+) -> None:
+    """Compare the binary and diagnostics of `source` with a golden file, recording it when asked."""
+    actual = format_golden(assemble(source, options))
+    if update or os.environ.get(UPDATE_ENV) or not os.path.exists(golden_path):
+        with open(golden_path, "w", encoding="utf-8") as f:
+            f.write("\n".join(actual) + "\n")
+        return
+    with open(golden_path, "r", encoding="utf-8") as f:
+        expected = f.read().splitlines()
+    problems = diff_text(expected, actual, f"golden output {golden_path} differs:")
+    if problems:
+        raise AssertionError("\n".join(problems + [f"set {UPDATE_ENV}=1 to accept the new output"]))
@@ -0,0 +1,130 @@
+"""
+Assembler: one-call entry point for embedding the assembler in other tools and tests.
+
+    from modules.Assembler import AssembleOptions, assemble
+
+    result = assemble("start: LDI #1\nJMP start\n", AssembleOptions(defines={"DEBUG": 1}))
+    if result.ok:
+        rom = result.binary
+    for diagnostic in result.diagnostics:
+        print(diagnostic)
+
+Assembly errors do not raise; they are returned as error diagnostics with an empty binary, so a
+caller sees every problem from one run. Warnings are returned on success and on failure.
+"""
+
+from __future__ import annotations
+
+from dataclasses import dataclass, field
+from typing import Dict, List, Optional, Union
+
+from .AssemblyHelper import AssemblyHelper, ListingEntry
+from .Diagnostics import Diagnostic, parse_diagnostic
+from .Preprocessor import DEFAULT_MAX_INCLUDE_DEPTH, DEFAULT_MAX_MACRO_DEPTH
+from .SyntaxProfiles import get_syntax_profile
+from .Targets import DEFAULT_TARGET, normalize_target
+
+
+@dataclass
+class AssembleOptions:
+    source_name: str = "<input>"
+    optimize: bool = False
+    defines: Dict[str, int] = field(default_factory=dict)
+    syntax: str = "arnicomp"
+    target: str = DEFAULT_TARGET
+    pseudo_instructions: Dict[str, object] = field(default_factory=dict)
+    check_reachability: bool = False
+    warn_symbol_case: bool = False
+    strict_case: bool = False
+    fail_fast: bool = False
+    max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH
+    max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH
+    include_paths: List[str] = field(default_factory=list)
+    data_base: int = 0
+
+
+@dataclass
+class AssemblyResult:
+    binary: bytes
+    labels: Dict[str, int]
+    constants: Dict[str, int]
+    diagnostics: List[Diagnostic]
+    listing: List[ListingEntry]
+
+    @property
+    def ok(self) -> bool:
+        return not self.errors
+
+    @property
+    def errors(self) -> List[Diagnostic]:
+        return [diagnostic for diagnostic in self.diagnostics if diagnostic.severity == "error"]
+
+    @property
+    def warnings(self) -> List[Diagnostic]:
+        return [diagnostic for diagnostic in self.diagnostics if diagnostic.severity == "warning"]
+
+
+def assemble(source: Union[str, bytes, List[str]], options: Optional[AssembleOptions] = None) -> AssemblyResult:
+    """Assemble source text (or a list of lines) with a fresh assembler.
+
+    Includes are resolved relative to `options.source_name`, so pass the file's path when the
+    source uses `.include` or `.import`; `options.include_paths` are searched after that.
+    """
+    options = options or AssembleOptions()
+    if isinstance(source, bytes):
+        source = source.decode("utf-8")
+    raw_lines = source.splitlines() if isinstance(source, str) else list(source)
+
+    try:
+        profile = get_syntax_profile(options.syntax)
+    except ValueError as exc:
+        return AssemblyResult(
+            binary=b"",
+            labels={},
+            constants={},
+            diagnostics=[parse_diagnostic(str(exc), "error", options.source_name)],
+            listing=[],
+        )
+    # The profile's comment markers apply as they do for `--syntax` on the command line.
+    helper = AssemblyHelper(
+        comment_char=profile.comment_char,
+        block_comment_start=profile.block_comment_start,
+        block_comment_end=profile.block_comment_end,
+    )
+    helper.syntax = profile
+    helper.target = normalize_target(options.target)
+    helper.preprocessor.include_paths = list(options.include_paths)
+    try:
+        helper.add_pseudo_instructions(options.pseudo_instructions, options.source_name)
+    except ValueError as exc:
+        return AssemblyResult(
+            binary=b"",
+            labels={},
+            constants={},
+            diagnostics=[parse_diagnostic(str(exc), "error", options.source_name)],
+            listing=[],
+        )
+    try:
+        binary_lines, labels, constants = helper.convert_to_machine_code(
+            raw_lines,
+            source_name=options.source_name,
+            optimize=options.optimize,
+            defines=options.defines,
+            check_reachability=options.check_reachability,
+            warn_symbol_case=options.warn_symbol_case,
+            strict_case=options.strict_case,
+            fail_fast=options.fail_fast,
+            max_include_depth=options.max_include_depth,
+            max_macro_depth=options.max_macro_depth,
+            data_base=options.data_base,
+        )
+    except ValueError:
+        return AssemblyResult(binary=b"", labels={}, constants={}, diagnostics=helper.last_diagnostics, listing=[])
+
+    return AssemblyResult(
+        binary=bytes(int(line.strip(), 2) for line in binary_lines),
+        labels=labels,
+        constants=constants,
+        diagnostics=helper.last_diagnostics,
+        listing=list(helper.last_listing),
+    )
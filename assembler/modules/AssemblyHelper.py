@@ -5,18 +5,26 @@ AssemblyHelper: assembler/disassembler for the final ArniComp ISA.
 from __future__ import annotations
 
 import ast
-from dataclasses import dataclass
+from dataclasses import dataclass, field, replace
 import json
 import os
 import re
-from typing import Dict, List, Optional, Tuple
+from typing import Callable, Dict, List, Optional, Set, Tuple
 
-from .LayoutDirectiveHandler import LayoutDirectiveHandler
+from .LayoutDirectiveHandler import CHECKSUM_SIZES, LayoutDirectiveHandler
 from .MacroExpander import MacroExpander
 from .Optimizer import Optimizer
-from .Preprocessor import Preprocessor
+from .Preprocessor import DEFAULT_MAX_INCLUDE_DEPTH, DEFAULT_MAX_MACRO_DEPTH, MacroDefinition, Preprocessor, build_pseudo_instructions
 from .FunctionImportResolver import FunctionImportResolver
 from .CommentStripper import CommentStripper
+from .OutputFormats import checksum8, crc16, group_digits
+from .BitFields import build_field_layouts, build_opcode_table, split_fields
+from .ReachabilityChecker import ReachabilityChecker
+from .StackDepthChecker import StackDepthChecker
+from .Diagnostics import Diagnostic, collect_diagnostics
+from .Suggestions import closest_match
+from .SyntaxProfiles import SyntaxProfile, get_syntax_profile
+from .Targets import DEFAULT_TARGET, TARGET_V1, TARGET_V2, TARGETS, V1Encoder
 
 
 CONFIG_PATH = os.path.join(os.path.dirname(__file__), "..", "config", "config.json")
@@ -33,25 +41,65 @@ BLOCK_COMMENT_START = config["special_chars"].get("block_comment_start", "/*")
 BLOCK_COMMENT_END = config["special_chars"].get("block_comment_end", "*/")
 LABEL_CHAR = config["special_chars"]["label"]
 CONSTANT_KEYWORD = config["keywords"]["constant"]
+FIELD_LAYOUTS = build_field_layouts(config["instructions"], list(JUMP_CONDITIONS))
+OPCODES = build_opcode_table(config["instructions"])
+PUSH_SOURCES = {name.upper(): bits for name, bits in config["push_sources"].items()}
+REGISTER_NAMES = set(DESTINATIONS) | set(SOURCES) | set(PUSH_SOURCES)
+DATA_SECTION_DIRECTIVES = {".FILL", ".SPACE", ".ORG", ".PADTO", ".ALIGN"}
+# The `.text` directives whose padding byte `.text fill=` supplies when they name none.
+SECTION_FILL_DIRECTIVES = {".FILL", ".SPACE", ".ORG", ".PADTO", ".ALIGN"}
+SOURCE_OPERATIONS = ("ADD", "ADC", "NOT", "SUB", "SBC", "CMP", "XOR", "AND")
+IMMEDIATE_OPERATIONS = ("ADDI", "SUBI")
 SLICE_RE = re.compile(r"^(?P<base>.+?)\[(?P<hi>\d+):(?P<lo>\d+)\]$")
-
-PUSH_SOURCES = {
-    "RA": "000",
-    "RD": "001",
-    "RB": "010",
-    "ACC": "011",
-    "MARH": "100",
-    "LRL": "101",
-    "LRH": "110",
-    "MARL": "111",
+IDENTIFIER_RE = re.compile(r"[A-Za-z_][A-Za-z0-9_]*")
+OPERATOR_CHARS = "|&^*/%<>"
+COMPARISONS = {
+    ast.Eq: lambda left, right: left == right,
+    ast.NotEq: lambda left, right: left != right,
+    ast.Lt: lambda left, right: left < right,
+    ast.LtE: lambda left, right: left <= right,
+    ast.Gt: lambda left, right: left > right,
+    ast.GtE: lambda left, right: left >= right,
 }
-
+# `[expr]` in a runtime expression (`.assert`, debugger watches) reads the RAM byte at `expr`.
+RAM_READ_RE = re.compile(r"\[([^\[\]]+)\]")
+# Machine state a runtime expression may name besides labels and constants; see Emulator.machine_variables.
+RUNTIME_SYMBOLS = ("RA", "RD", "RB", "ACC", "MARL", "MARH", "PRL", "PRH", "LRL", "LRH", "PC", "SP", "MAR", "PR", "LR", "Z", "N", "C", "V")
+ASSERT_ARGUMENTS_RE = re.compile(r'^(?P<expression>.*?)\s*,\s*(?P<message>"(?:[^"\\]|\\.)*")\s*$')
+STRING_LITERAL_RE = re.compile(r"\"(?:\\.|[^\"\\])*\"|'(?:\\.|[^'\\])*'")
+NUMERIC_LABEL_DEF_RE = re.compile(r"^\s*(\d+):(.*)$")
+NUMERIC_LABEL_REF_RE = re.compile(r"(?<![A-Za-z0-9_$#.])(\d+)([bBfF])(?![A-Za-z0-9_])")
+REGISTER_ALIAS_HEAD_RE = re.compile(r"^(\s*(?:\*?[A-Za-z_][A-Za-z0-9_]*:)?\s*(\S+))(.*)$")
+# Names the assembler makes up for its own bookkeeping: numeric labels (`__N1_0`), the labels of a
+# linked object that it does not export (`__O2_LOOP`), and the per-definition aliases of a
+# redefined `.set` (`COUNT__SET2`). They resolve references but are never exported as symbols.
+INTERNAL_LABEL_RE = re.compile(r"__N\d+_\d+|__O\d+_[A-Za-z0-9_]+")
+INTERNAL_CONSTANT_RE = re.compile(r"[A-Za-z_][A-Za-z0-9_]*__SET\d+")
+LOCATION_SYMBOL_RE = re.compile(r"(?<![A-Za-z0-9_@$])__(FILE|LINE)__(?![A-Za-z0-9_])")
+KNOWN_MNEMONICS = {
+    "NOP", "HLT", "LDI", "LDL", "LDH", "MOV", "CLR", "ADD", "ADC", "SUB", "SBC", "AND", "XOR", "NOT",
+    "ADDI", "SUBI", "CMP", "PUSH", "POP", "INC", "DEC", "JAL", "CALL", "JMPA", "RET", "PUSHI", "PUSHSTR",
+    "JGT", "JLE", "JGE", "JLEU", "JGTU", ".FILL", ".ORG", ".PADTO", ".ALIGN", ".CHECKSUM", ".CRC16", ".SET", ".REG", ".TEXT", ".DATA",
+    ".GLOBAL", ".EXTERN", ".BYTE", ".WORD", ".ASCII", ".ASCIIZ", ".SPACE", ".ENDIAN", ".ENTRY",
+} | set(JUMP_CONDITIONS) | set(JUMP_ALIASES)
+PSEUDO_INSTRUCTIONS = build_pseudo_instructions(
+    config.get("pseudo_instructions", {}), os.path.normpath(CONFIG_PATH), KNOWN_MNEMONICS
+)
 
 @dataclass(frozen=True)
 class SourceLine:
     line_number: int
     text: str
     source_name: str = "<input>"
+    # Macro bodies this line was expanded from, outermost first, as (macro, file, line); the line
+    # itself is reported at the outermost invocation. Not compared, so it does not affect caching.
+    expansion: Tuple[Tuple[str, str, int], ...] = field(default=(), compare=False)
+    # 1-based column where the statement starts in the original line; expanded lines take the
+    # invocation's. Used for diagnostics only, so it is not compared either.
+    column: int = field(default=1, compare=False)
+
+    def with_text(self, text: str) -> "SourceLine":
+        return replace(self, text=text)
 
 
 @dataclass(frozen=True)
@@ -60,6 +108,7 @@ class ParsedLine:
     raw_line: str
     instruction: str
     args: List[str]
+    column: int = 1
 
 
 @dataclass(frozen=True)
@@ -69,6 +118,7 @@ class ListingEntry:
     address: int
     binary_bytes: List[str]
     source_text: str
+    expansion: Tuple[Tuple[str, str, int], ...] = ()
 
     @property
     def hex_bytes(self) -> List[str]:
@@ -91,6 +141,46 @@ class ResolvedValue:
         return self.slice_hi - self.slice_lo + 1
 
 
+@dataclass(frozen=True)
+class UndefinedReference:
+    """A reference to an undefined symbol that `undefined_as_zero` assembled as 0."""
+
+    name: str
+    kind: str
+    source_name: str
+    line_number: int
+
+    def describe(self) -> str:
+        return f"Line {self.source_name}:{self.line_number}: undefined {self.kind} {self.name} assembled as 0 (--undef-zero)"
+
+
+@dataclass(frozen=True)
+class RuntimeAssertion:
+    """An `.assert` checked by the emulator before the instruction at `address` executes."""
+
+    address: int
+    expression: str
+    message: str
+    source_name: str
+    line_number: int
+    test: Optional[str] = None
+
+    def describe(self) -> str:
+        text = f"{self.source_name}:{self.line_number}: {self.expression}"
+        return f"{text} ({self.message})" if self.message else text
+
+
+@dataclass(frozen=True)
+class ProgramTest:
+    """A `.test` block: it runs from `start` and passes by reaching the `HLT` at `end`."""
+
+    name: str
+    start: int
+    end: int
+    source_name: str
+    line_number: int
+
+
 class InstructionEncoder:
     """Encode final ISA instructions to 8-bit binary strings."""
 
@@ -100,7 +190,7 @@ class InstructionEncoder:
             raise ValueError("LDL destination must be RA or RD")
         if not (0 <= immediate <= 31):
             raise ValueError(f"LDL immediate value {immediate} out of range (0-31)")
-        return f"11{1 if dest == 'RD' else 0}{immediate:05b}"
+        return f"{OPCODES['LDL']}{1 if dest == 'RD' else 0}{immediate:05b}"
 
     @staticmethod
     def encode_ldh(dest: str, immediate: int) -> str:
@@ -108,7 +198,7 @@ class InstructionEncoder:
             raise ValueError("LDH destination must be RA or RD")
         if not (0 <= immediate <= 7):
             raise ValueError(f"LDH immediate value {immediate} out of range (0-7)")
-        return f"0011{1 if dest == 'RD' else 0}{immediate:03b}"
+        return f"{OPCODES['LDH']}{1 if dest == 'RD' else 0}{immediate:03b}"
 
     @staticmethod
     def encode_mov(dest: str, src: str) -> str:
@@ -116,75 +206,50 @@ class InstructionEncoder:
             raise ValueError(f"Invalid destination register: {dest}")
         if src not in SOURCES:
             raise ValueError(f"Invalid source register: {src}")
-        return f"10{DESTINATIONS[dest]}{SOURCES[src]}"
+        return f"{OPCODES['MOV']}{DESTINATIONS[dest]}{SOURCES[src]}"
 
     @staticmethod
     def encode_source_op(operation: str, src: str) -> str:
         if src not in SOURCES:
             raise ValueError(f"Invalid source register for {operation}: {src}")
-
-        prefixes = {
-            "ADD": "01000",
-            "ADC": "01010",
-            "NOT": "01011",
-            "SUB": "01100",
-            "SBC": "01110",
-            "CMP": "01111",
-            "XOR": "00001",
-            "AND": "00010",
-        }
-        if operation not in prefixes:
+        if operation not in SOURCE_OPERATIONS:
             raise ValueError(f"Unknown source-form instruction: {operation}")
-        return f"{prefixes[operation]}{SOURCES[src]}"
+        return f"{OPCODES[operation]}{SOURCES[src]}"
 
     @staticmethod
     def encode_push_source(src: str) -> str:
         if src not in PUSH_SOURCES:
             raise ValueError(f"Invalid source register for PUSH: {src}")
-        return f"00100{PUSH_SOURCES[src]}"
+        return f"{OPCODES['PUSH']}{PUSH_SOURCES[src]}"
 
     @staticmethod
     def encode_immediate_op(operation: str, immediate: int) -> str:
         if not (0 <= immediate <= 7):
             raise ValueError(f"{operation} immediate value {immediate} out of range (0-7)")
-        prefixes = {
-            "ADDI": "01001",
-            "SUBI": "01101",
-        }
-        if operation not in prefixes:
+        if operation not in IMMEDIATE_OPERATIONS:
             raise ValueError(f"Unknown immediate instruction: {operation}")
-        return f"{prefixes[operation]}{immediate:03b}"
+        return f"{OPCODES[operation]}{immediate:03b}"
 
     @staticmethod
     def encode_jump(condition: str) -> str:
         if condition not in JUMP_CONDITIONS:
             raise ValueError(f"Unknown jump condition: {condition}")
-        return f"00011{JUMP_CONDITIONS[condition]}"
+        return f"{OPCODES['JMP']}{JUMP_CONDITIONS[condition]}"
 
     @staticmethod
     def encode_pop(dest: str) -> str:
         if dest not in DESTINATIONS:
             raise ValueError(f"Invalid destination register for POP: {dest}")
-        return f"00101{DESTINATIONS[dest]}"
+        return f"{OPCODES['POP']}{DESTINATIONS[dest]}"
 
     @staticmethod
     def encode_special(instruction: str, immediate: Optional[int] = None) -> str:
-        if instruction == "NOP":
-            return "00000000"
-        if instruction == "HLT":
-            return "00000001"
-        if instruction == "JGT":
-            return "00000110"
-        if instruction == "JAL":
-            return "00000111"
-        if instruction == "INC":
-            if immediate not in {1, 2}:
-                raise ValueError("INC only accepts #1 or #2")
-            return f"0000001{immediate - 1}"
-        if instruction == "DEC":
+        if instruction in {"NOP", "HLT", "JGT", "JAL"}:
+            return OPCODES[instruction]
+        if instruction in {"INC", "DEC"}:
             if immediate not in {1, 2}:
-                raise ValueError("DEC only accepts #1 or #2")
-            return f"0000010{immediate - 1}"
+                raise ValueError(f"{instruction} only accepts #1 or #2")
+            return f"{OPCODES[instruction]}{immediate - 1}"
         raise ValueError(f"Unknown special instruction: {instruction}")
 
 
@@ -214,21 +279,79 @@ class AssemblyHelper:
         self.macro_expander = MacroExpander(self, self.encoder, JUMP_ALIASES, JUMP_CONDITIONS)
         self.layout_directives = LayoutDirectiveHandler(self)
         self.last_warnings: List[str] = []
+        self.last_errors: List[str] = []
+        self.last_diagnostics: List[Diagnostic] = []
+        # Parsing depends only on the line text, so each line is parsed once and reused by every
+        # sizing pass. Operands whose value cannot depend on an address (numbers, characters, and
+        # defined constants) are classified once per constants table; labels and expressions are
+        # still resolved on every pass.
+        self.cache_parsing = True
+        self.parse_cache: Dict[SourceLine, ParsedLine] = {}
+        self.operand_cache: Dict[str, ResolvedValue] = {}
+        self.operand_cache_constants: Optional[Dict[str, int]] = None
+        # Statement column of each (file, line) laid out in the last build; see SourceLine.column.
+        self.statement_columns: Dict[Tuple[str, int], int] = {}
         self.last_listing: List[ListingEntry] = []
+        # Symbol tables of the last successful build, used to annotate the listing.
+        self.last_labels: Dict[str, int] = {}
+        self.last_constants: Dict[str, int] = {}
+        # Runtime checks of the last build. `.test` blocks are assembled only with include_tests set,
+        # as the `test` command does; otherwise they and the asserts in them are dropped.
+        self.include_tests = False
+        self.last_assertions: List[RuntimeAssertion] = []
+        self.last_tests: List[ProgramTest] = []
+        self.pending_assertions: List[Tuple[str, str, str, SourceLine, Optional[str]]] = []
+        self.pending_tests: List[Tuple[str, str, str, SourceLine]] = []
+        # --undef-zero: undefined references resolve to 0 and are recorded against the line being
+        # emitted. A label defined anywhere in the program is never assumed, even before it has an address.
+        self.undefined_as_zero = False
+        self.defined_label_names: Set[str] = set()
+        self.emitting_line: Optional[SourceLine] = None
+        self.last_undefined_references: List[UndefinedReference] = []
+        # `.extern` names while an object file is built: they also read as 0, and each reference is
+        # kept as (name, kind, line) for the object's relocations.
+        self.external_symbols: Set[str] = set()
+        self.last_external_references: List[Tuple[str, str, SourceLine]] = []
+        # id() of every `.word` line that `.endian big` applies to; see extract_endianness.
+        self.big_endian_lines: set[int] = set()
+        # RAM addresses of labels in `.data`, fixed before code labels are laid out.
+        self.data_labels: Dict[str, int] = {}
+        # id() of each `.text` padding line without its own byte -> the `.text fill=` byte in effect there.
+        self.section_fill_bytes: Dict[int, int] = {}
+        # First and one-past-last RAM address reserved by `.data` in the last build.
+        self.data_range: Tuple[int, int] = (0, 0)
+        self.syntax: SyntaxProfile = get_syntax_profile("arnicomp")
+        # CPU revision to encode for; see Targets. The v1 table is loaded on first use.
+        self.target = DEFAULT_TARGET
+        self.v1_encoder: Optional[V1Encoder] = None
+        # Declarative pseudo-instructions, expanded like predefined .macro blocks.
+        self.pseudo_instructions: Dict[str, MacroDefinition] = dict(PSEUDO_INSTRUCTIONS)
         self.preprocessor = Preprocessor(
             comment_char=self.comment_char,
             block_comment_start=self.block_comment_start,
             block_comment_end=self.block_comment_end,
-            source_line_factory=lambda line_number, text, src: SourceLine(line_number, text, source_name=src),
+            source_line_factory=lambda line_number, text, src, expansion=(), column=1: SourceLine(line_number, text, src, expansion, column),
             expression_evaluator=lambda expr, vars=None: self.evaluate_expression(expr, vars),
+            line_translator=lambda line: self.syntax.translate(line),
+            argument_splitter=self.split_top_level_commas,
+            reserved_names=KNOWN_MNEMONICS,
+            register_names=[*DESTINATIONS, *SOURCES, *PUSH_SOURCES],
         )
         self.import_resolver = FunctionImportResolver(
             comment_char=self.comment_char,
-            constant_keyword=self.constant_keyword,
-            source_line_factory=lambda line_number, text, src: SourceLine(line_number, text, source_name=src),
-            preprocessor_expand=lambda raw_lines, source_name: self.preprocessor.expand(raw_lines, source_name=source_name),
+            constant_parser=self.parse_constant_definition,
+            source_line_factory=lambda line_number, text, src, expansion=(), column=1: SourceLine(line_number, text, src, expansion, column),
+            preprocessor_expand=lambda raw_lines, source_name: self.preprocessor.expand(
+                raw_lines, source_name=source_name, macros=dict(self.pseudo_instructions)
+            ),
         )
         self.optimizer = Optimizer(self)
+        self.reachability_checker = ReachabilityChecker(self)
+        self.stack_depth_checker = StackDepthChecker(self)
+
+    def add_pseudo_instructions(self, table: Dict[str, object], source_name: str) -> None:
+        """Add or replace pseudo-instructions from a `pseudo_instructions` table, e.g. from .asmconfig."""
+        self.pseudo_instructions.update(build_pseudo_instructions(table, source_name, KNOWN_MNEMONICS))
 
     def format_line_ref(self, source_line: SourceLine) -> str:
         return f"{source_line.source_name}:{source_line.line_number}"
@@ -249,6 +372,8 @@ class AssemblyHelper:
             return int(value[2:], 16)
         if value.startswith(("0b", "0B")):
             return int(value[2:], 2)
+        if value.startswith(("0o", "0O")):
+            return int(value[2:], 8)
         return int(value)
 
     def try_parse_char_literal(self, token: str) -> Optional[int]:
@@ -276,6 +401,7 @@ class AssemblyHelper:
         allowed_functions = {
             "MAX": max,
             "MIN": min,
+            "ABS": abs,
             "LOW": lambda value: value & 0xFF,
             "HIGH": lambda value: (value >> 8) & 0xFF,
             "BYTE0": lambda value: value & 0xFF,
@@ -310,6 +436,8 @@ class AssemblyHelper:
                     return operand
                 if isinstance(node.op, ast.USub):
                     return -operand
+                if isinstance(node.op, ast.Not):
+                    return int(not operand)
                 raise ValueError(f"Unsupported unary operator in expression: {expression}")
 
             if isinstance(node, ast.BinOp):
@@ -341,14 +469,39 @@ class AssemblyHelper:
                     return left ^ right
                 raise ValueError(f"Unsupported operator in expression: {expression}")
 
+            if isinstance(node, ast.Compare):
+                # Comparisons chain as in `0 <= x < 8` and give 1 or 0.
+                left = eval_node(node.left)
+                for op, comparator in zip(node.ops, node.comparators):
+                    right = eval_node(comparator)
+                    if type(op) not in COMPARISONS:
+                        raise ValueError(f"Unsupported comparison in expression: {expression}")
+                    if not COMPARISONS[type(op)](left, right):
+                        return 0
+                    left = right
+                return 1
+
+            if isinstance(node, ast.BoolOp):
+                values = (eval_node(value) for value in node.values)
+                if isinstance(node.op, ast.And):
+                    return int(all(values))
+                return int(any(values))
+
             if isinstance(node, ast.Call):
                 if not isinstance(node.func, ast.Name):
                     raise ValueError(f"Unsupported function call in expression: {expression}")
                 func_name = node.func.id.upper()
+                if func_name == "LEN":
+                    if len(node.args) != 1 or not isinstance(node.args[0], ast.Constant) or not isinstance(node.args[0].value, str):
+                        raise ValueError(f"len() expects exactly one string literal: {expression}")
+                    return len(node.args[0].value)
                 if func_name not in allowed_functions:
                     raise ValueError(f"Unsupported function in expression: {node.func.id}")
                 args = [eval_node(arg) for arg in node.args]
-                return int(allowed_functions[func_name](*args))
+                try:
+                    return int(allowed_functions[func_name](*args))
+                except TypeError as exc:
+                    raise ValueError(f"Wrong number of arguments for {func_name}(): {expression}") from exc
 
             raise ValueError(f"Unsupported expression: {expression}")
 
@@ -370,22 +523,36 @@ class AssemblyHelper:
         rewritten_parts: List[str] = []
         last_end = 0
 
+        string_spans = [match.span() for match in STRING_LITERAL_RE.finditer(expression)]
+
         for match in token_pattern.finditer(expression):
+            if any(start <= match.start() < end for start, end in string_spans):
+                continue
             rewritten_parts.append(expression[last_end:match.start()])
             prefix = match.group("prefix")
             name = match.group("name").upper()
             placeholder = f"{'LBL' if prefix == '@' else 'CONST'}_{name}"
 
             if prefix == "@":
-                if name not in labels:
-                    if allow_unresolved:
-                        return None
-                    raise ValueError(f"Undefined label reference: @{name}")
-                variables[placeholder] = labels[name]
+                if name in labels:
+                    variables[placeholder] = labels[name]
+                elif self.assume_zero(name, "label"):
+                    variables[placeholder] = 0
+                elif allow_unresolved:
+                    return None
+                else:
+                    raise ValueError(
+                        f"Undefined label reference: @{name}{self.undefined_symbol_hint(name, 'label', labels, constants, '@')}"
+                    )
             else:
-                if name not in constants:
-                    raise ValueError(f"Undefined constant reference: ${name}")
-                variables[placeholder] = constants[name]
+                if name in constants:
+                    variables[placeholder] = constants[name]
+                elif self.assume_zero(name, "constant"):
+                    variables[placeholder] = 0
+                else:
+                    raise ValueError(
+                        f"Undefined constant reference: ${name}{self.undefined_symbol_hint(name, 'constant', labels, constants)}"
+                    )
 
             rewritten_parts.append(placeholder)
             last_end = match.end()
@@ -394,8 +561,9 @@ class AssemblyHelper:
         rewritten_expression = "".join(rewritten_parts).strip()
 
         bare_name_pattern = re.compile(r"\b([A-Za-z_][A-Za-z0-9_]*)\b")
-        reserved = {"MAX", "MIN", "LOW", "HIGH", "BYTE0", "BYTE1", "BITS"}
-        for match in bare_name_pattern.finditer(rewritten_expression):
+        reserved = {"MAX", "MIN", "ABS", "LOW", "HIGH", "BYTE0", "BYTE1", "BITS", "LEN"}
+        expression_without_strings = STRING_LITERAL_RE.sub('""', rewritten_expression)
+        for match in bare_name_pattern.finditer(expression_without_strings):
             name = match.group(1).upper()
             if name in reserved or name in variables:
                 continue
@@ -412,6 +580,130 @@ class AssemblyHelper:
 
         return self.evaluate_expression(rewritten_expression, variables)
 
+    def expression_tree(
+        self,
+        expression: str,
+        labels: Optional[Dict[str, int]] = None,
+        constants: Optional[Dict[str, int]] = None,
+    ) -> Dict[str, object]:
+        """Return the parse tree of an operand expression as nested JSON-ready dicts.
+
+        Every node has a "node" kind (BinOp, UnaryOp, Call, Label, Constant, Symbol, Number, Char,
+        String), a "value" when it can be evaluated on its own, and "children" for operators and
+        calls. Symbols resolve the way evaluate_operand_expression resolves them.
+        """
+        labels = labels or {}
+        constants = constants or {}
+        expression = expression.strip()
+        if expression.startswith(self.number_prefix):
+            expression = expression[len(self.number_prefix):].strip()
+
+        token_pattern = re.compile(r"(?P<prefix>[@$])(?P<name>[A-Za-z_][A-Za-z0-9_]*)")
+        string_spans = [match.span() for match in STRING_LITERAL_RE.finditer(expression)]
+        placeholders: Dict[str, Tuple[str, str]] = {}
+
+        def replace_token(match: re.Match[str]) -> str:
+            if any(start <= match.start() < end for start, end in string_spans):
+                return match.group(0)
+            name = match.group("name").upper()
+            is_label = match.group("prefix") == "@"
+            placeholder = f"{'LBL' if is_label else 'CONST'}_{name}"
+            placeholders[placeholder] = ("Label" if is_label else "Constant", name)
+            return placeholder
+
+        rewritten = token_pattern.sub(replace_token, expression)
+        try:
+            tree = ast.parse(rewritten, mode="eval")
+        except SyntaxError as exc:
+            raise ValueError(f"Invalid constant expression '{expression}': {exc.msg}") from exc
+
+        operator_symbols = {
+            ast.Add: "+", ast.Sub: "-", ast.Mult: "*", ast.Div: "/", ast.FloorDiv: "//", ast.Mod: "%",
+            ast.LShift: "<<", ast.RShift: ">>", ast.BitOr: "|", ast.BitAnd: "&", ast.BitXor: "^",
+            ast.UAdd: "+", ast.USub: "-", ast.Invert: "~",
+        }
+
+        def value_of(node: ast.AST) -> Optional[int]:
+            if isinstance(node, ast.Constant) and isinstance(node.value, str) and len(node.value) != 1:
+                return None
+            subexpression = ast.unparse(node)
+            for placeholder in placeholders:
+                kind, name = placeholder.split("_", 1)
+                subexpression = re.sub(rf"\b{placeholder}\b", f"{'@' if kind == 'LBL' else '$'}{name}", subexpression)
+            try:
+                return self.evaluate_operand_expression(subexpression, labels, constants)
+            except ValueError:
+                return None
+
+        def build(node: ast.AST) -> Dict[str, object]:
+            children: List[ast.AST] = []
+            if isinstance(node, ast.BinOp):
+                entry: Dict[str, object] = {"node": "BinOp", "op": operator_symbols.get(type(node.op), type(node.op).__name__)}
+                children = [node.left, node.right]
+            elif isinstance(node, ast.UnaryOp):
+                entry = {"node": "UnaryOp", "op": operator_symbols.get(type(node.op), type(node.op).__name__)}
+                children = [node.operand]
+            elif isinstance(node, ast.Call):
+                entry = {"node": "Call", "name": ast.unparse(node.func).upper()}
+                children = list(node.args)
+            elif isinstance(node, ast.Name):
+                kind, name = placeholders.get(node.id, ("Symbol", node.id.upper()))
+                entry = {"node": kind, "name": name}
+            elif isinstance(node, ast.Constant) and isinstance(node.value, str):
+                entry = {"node": "Char" if len(node.value) == 1 else "String", "text": node.value}
+            elif isinstance(node, ast.Constant):
+                entry = {"node": "Number", "text": repr(node.value)}
+            else:
+                entry = {"node": type(node).__name__}
+            value = value_of(node)
+            if value is not None:
+                entry["value"] = value
+            if children:
+                entry["children"] = [build(child) for child in children]
+            return entry
+
+        return build(tree.body)
+
+    def dump_expression_ast(
+        self,
+        expression: str,
+        labels: Optional[Dict[str, int]] = None,
+        constants: Optional[Dict[str, int]] = None,
+    ) -> List[str]:
+        """Render expression_tree one node per line, indented by depth, with each node's value.
+
+        Nodes that cannot be evaluated on their own (string arguments, unknown names) are shown
+        without a value.
+        """
+        rendered: List[str] = []
+
+        def describe(node: Dict[str, object]) -> str:
+            kind = node["node"]
+            if kind in {"BinOp", "UnaryOp"}:
+                return f"{kind} {node['op']}"
+            if kind == "Call":
+                return f"Call {node['name']}"
+            if kind == "Label":
+                return f"Label {self.label_prefix}{node['name']}"
+            if kind == "Constant":
+                return f"Constant {self.constant_prefix}{node['name']}"
+            if kind == "Symbol":
+                return f"Symbol {node['name']}"
+            if kind in {"Char", "String"}:
+                return f"{kind} {node['text']!r}"
+            if kind == "Number":
+                return f"Number {node['text']}"
+            return str(kind)
+
+        def render(node: Dict[str, object], depth: int) -> None:
+            suffix = f" = {node['value']}" if "value" in node else ""
+            rendered.append(f"{'  ' * depth}{describe(node)}{suffix}")
+            for child in node.get("children", []):
+                render(child, depth + 1)
+
+        render(self.expression_tree(expression, labels, constants), 0)
+        return rendered
+
     def clean_lines(self, lines: List[str]) -> List[SourceLine]:
         cleaned: List[SourceLine] = []
         stripped_lines = self.strip_comments_from_lines(lines)
@@ -427,29 +719,230 @@ class AssemblyHelper:
         for source_line, line in zip(lines, stripped_lines):
             if not line:
                 continue
-            cleaned.append(SourceLine(source_line.line_number, line, source_name=source_line.source_name))
+            cleaned.append(source_line.with_text(line))
         return cleaned
 
-    def extract_constants(self, lines: List[SourceLine]) -> Tuple[Dict[str, int], List[SourceLine]]:
-        constants: Dict[str, int] = {}
+    def extract_constants(
+        self,
+        lines: List[SourceLine],
+        fail_fast: bool = False,
+        predefined: Optional[Dict[str, int]] = None,
+    ) -> Tuple[Dict[str, int], List[SourceLine]]:
+        """Split `equ` and `.set` definitions from the program; every bad one is reported unless `fail_fast`.
+
+        `predefined` constants (command-line defines) are visible to every `equ` and may not be redefined.
+        An `equ` name may be defined once; a `.set` name may be redefined by further `.set` lines, and
+        code between two of them sees the value in effect at that point. An `equ` whose value uses a
+        label has no value until layout, so its references are replaced by the parenthesized expression.
+        """
+        predefined = predefined or {}
+        constants: Dict[str, int] = dict(predefined)
         remaining_lines: List[SourceLine] = []
-
+        errors: List[str] = []
+        equ_lines: Dict[str, SourceLine] = {}
+        set_lines: Dict[str, SourceLine] = {}
+        set_counts: Dict[str, int] = {}
         for source_line in lines:
             parts = source_line.text.split(None, 2)
-            if parts and parts[0].lower() == self.constant_keyword:
-                if len(parts) < 3:
-                    raise ValueError(
-                        f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
-                        "Invalid constant definition"
-                    )
-                const_name = parts[1].upper()
-                const_value = self.evaluate_expression(parts[2], constants)
-                constants[const_name] = const_value
-            else:
-                remaining_lines.append(source_line)
+            if len(parts) == 3 and parts[0].lower() == ".set":
+                set_counts[parts[1].upper()] = set_counts.get(parts[1].upper(), 0) + 1
+        # Names set more than once get one alias per definition, so each stretch of code keeps its value.
+        set_seen: Dict[str, int] = {}
+        current_aliases: Dict[str, str] = {}
+        label_names = {name for name in (self.split_label_prefix(line.text)[0] for line in lines) if name is not None}
+        label_expressions: Dict[str, str] = {}
 
+        for source_line in lines:
+            try:
+                set_definition = self.parse_set_definition(source_line.text)
+                if set_definition is not None:
+                    const_name, const_expr = set_definition
+                    if const_name in predefined:
+                        raise ValueError(
+                            f"Constant {const_name} is already set to {predefined[const_name]} by a command-line or build-matrix define"
+                        )
+                    if const_name in equ_lines:
+                        raise ValueError(
+                            f"{const_name} is an equ constant (line {self.format_line_ref(equ_lines[const_name])}); "
+                            ".set cannot redefine it"
+                        )
+                    value = self.evaluate_expression(self.strip_constant_prefixes(const_expr), constants)
+                    constants[const_name] = value
+                    set_lines.setdefault(const_name, source_line)
+                    set_seen[const_name] = set_seen.get(const_name, 0) + 1
+                    if set_counts.get(const_name, 0) > 1:
+                        alias = f"{const_name}__SET{set_seen[const_name]}"
+                        constants[alias] = value
+                        current_aliases[const_name] = alias
+                    continue
+
+                definitions = self.parse_constant_definition(source_line.text)
+                if definitions is None:
+                    if current_aliases:
+                        source_line = source_line.with_text(self.rewrite_set_references(source_line.text, current_aliases))
+                    remaining_lines.append(source_line)
+                    continue
+                for const_name, const_expr in definitions:
+                    if const_name in predefined:
+                        raise ValueError(
+                            f"Constant {const_name} is already set to {predefined[const_name]} by a command-line or build-matrix define"
+                        )
+                    if self.references_labels(const_expr, label_names | set(label_expressions), constants):
+                        first = equ_lines.get(const_name) or set_lines.get(const_name)
+                        if first is not None:
+                            raise ValueError(f"Duplicate constant definition: {const_name} (first defined on line {self.format_line_ref(first)})")
+                        if label_expressions:
+                            const_expr = self.inline_label_expressions(const_expr, label_expressions)
+                        label_expressions[const_name] = const_expr
+                        equ_lines[const_name] = source_line
+                        continue
+                    value = self.evaluate_expression(self.strip_constant_prefixes(const_expr), constants)
+                    first = equ_lines.get(const_name) or set_lines.get(const_name)
+                    if first is not None:
+                        # Shared headers pulled in by several imports repeat their equ lines; that is harmless.
+                        if const_name in equ_lines and constants[const_name] == value:
+                            continue
+                        raise ValueError(
+                            f"Duplicate constant definition: {const_name} = {value} (first defined as {constants[const_name]} "
+                            f"on line {self.format_line_ref(first)}; use .set for a redefinable symbol)"
+                        )
+                    constants[const_name] = value
+                    equ_lines[const_name] = source_line
+            except ValueError as exc:
+                error = f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): {exc}"
+                if fail_fast:
+                    raise ValueError(error) from exc
+                errors.append(error)
+
+        if errors:
+            self.raise_collected_errors(errors)
+        if label_expressions:
+            remaining_lines = [
+                SourceLine(
+                    line.line_number,
+                    self.inline_label_expressions(line.text, label_expressions),
+                    source_name=line.source_name,
+                    column=line.column,
+                )
+                for line in remaining_lines
+            ]
         return constants, remaining_lines
 
+    def parse_set_definition(self, text: str) -> Optional[Tuple[str, str]]:
+        """Return (NAME, expression) for `.set NAME expr`, None for other lines; malformed `.set` raises."""
+        parts = text.split(None, 2)
+        if not parts or parts[0].lower() != ".set":
+            return None
+        if len(parts) != 3 or not IDENTIFIER_RE.fullmatch(parts[1]):
+            raise ValueError("Invalid .set definition: expected '.set NAME value'")
+        return parts[1].upper(), parts[2].strip()
+
+    def rewrite_set_references(self, text: str, aliases: Dict[str, str]) -> str:
+        """Point references to redefined `.set` names at the definition currently in effect."""
+        pattern = re.compile(
+            r"(?<![A-Za-z0-9_@*])(\$?)(" + "|".join(re.escape(name) for name in aliases) + r")(?![A-Za-z0-9_:])",
+            re.IGNORECASE,
+        )
+        pieces: List[str] = []
+        last_end = 0
+        for literal in STRING_LITERAL_RE.finditer(text):
+            pieces.append(pattern.sub(lambda match: match.group(1) + aliases[match.group(2).upper()], text[last_end:literal.start()]))
+            pieces.append(literal.group(0))
+            last_end = literal.end()
+        pieces.append(pattern.sub(lambda match: match.group(1) + aliases[match.group(2).upper()], text[last_end:]))
+        return "".join(pieces)
+
+    def strip_constant_prefixes(self, expression: str) -> str:
+        """Drop the constant prefix from `$NAME` references outside string literals, as `equ` values name constants bare."""
+        pattern = re.compile(re.escape(self.constant_prefix) + r"(?=[A-Za-z_])")
+        pieces: List[str] = []
+        last_end = 0
+        for literal in STRING_LITERAL_RE.finditer(expression):
+            pieces.append(pattern.sub("", expression[last_end:literal.start()]))
+            pieces.append(literal.group(0))
+            last_end = literal.end()
+        pieces.append(pattern.sub("", expression[last_end:]))
+        return "".join(pieces)
+
+    def references_labels(self, expression: str, label_names: set[str], constants: Dict[str, int]) -> bool:
+        """Return True when an `equ` expression names a label, with or without the label prefix."""
+        text = STRING_LITERAL_RE.sub('""', expression)
+        if re.search(re.escape(self.label_prefix) + r"[A-Za-z_]", text):
+            return True
+        return any(
+            name.upper() in label_names and name.upper() not in constants
+            for name in re.findall(r"[A-Za-z_][A-Za-z0-9_]*", text)
+        )
+
+    def inline_label_expressions(self, text: str, expressions: Dict[str, str]) -> str:
+        """Replace references to label-valued `equ` names with their parenthesized expressions."""
+        pattern = re.compile(
+            r"(?<![A-Za-z0-9_@*])\$?(" + "|".join(re.escape(name) for name in expressions) + r")(?![A-Za-z0-9_:])",
+            re.IGNORECASE,
+        )
+        pieces: List[str] = []
+        last_end = 0
+        for literal in STRING_LITERAL_RE.finditer(text):
+            pieces.append(pattern.sub(lambda match: f"({expressions[match.group(1).upper()]})", text[last_end:literal.start()]))
+            pieces.append(literal.group(0))
+            last_end = literal.end()
+        pieces.append(pattern.sub(lambda match: f"({expressions[match.group(1).upper()]})", text[last_end:]))
+        return "".join(pieces)
+
+    def parse_constant_definition(self, text: str) -> Optional[List[Tuple[str, str]]]:
+        """Return the (NAME, expression) pairs of an `equ` line, None for other lines; malformed `equ` raises.
+
+        One line may define several constants separated by commas: `equ A 1, B 2, C 3`.
+        """
+        parts = text.split(None, 1)
+        if not parts or parts[0].lower() != self.constant_keyword:
+            return None
+        if len(parts) < 2:
+            raise ValueError(f"Invalid constant definition: expected '{self.constant_keyword} NAME value'")
+
+        pieces = self.split_top_level_commas(parts[1])
+        definitions: List[Tuple[str, str]] = []
+        for position, piece in enumerate(pieces, start=1):
+            name_and_value = piece.split(None, 1)
+            if len(name_and_value) != 2 or not IDENTIFIER_RE.fullmatch(name_and_value[0]):
+                where = f" (definition {position} of {len(pieces)}: '{piece}')" if len(pieces) > 1 else ""
+                raise ValueError(f"Invalid constant definition{where}: expected 'NAME value'")
+            definitions.append((name_and_value[0].upper(), name_and_value[1].strip()))
+        return definitions
+
+    def split_top_level_commas(self, text: str) -> List[str]:
+        """Split on commas that are outside parentheses, brackets, and quotes."""
+        pieces: List[str] = []
+        current: List[str] = []
+        depth = 0
+        quote_char: Optional[str] = None
+        escape = False
+
+        for ch in text:
+            if quote_char is not None:
+                current.append(ch)
+                if escape:
+                    escape = False
+                elif ch == "\\":
+                    escape = True
+                elif ch == quote_char:
+                    quote_char = None
+                continue
+            if ch in {'"', "'"}:
+                quote_char = ch
+            elif ch in "([":
+                depth += 1
+            elif ch in ")]":
+                depth = max(0, depth - 1)
+            elif ch == "," and depth == 0:
+                pieces.append("".join(current).strip())
+                current = []
+                continue
+            current.append(ch)
+
+        pieces.append("".join(current).strip())
+        return pieces
+
     def is_label_definition(self, text: str) -> bool:
         label_name, remainder = self.split_label_prefix(text)
         return label_name is not None and not remainder
@@ -470,6 +963,11 @@ class AssemblyHelper:
             return None, text.strip()
         return match.group(1).upper(), match.group(2).strip()
 
+    def defined_label_spelling(self, text: str) -> Optional[str]:
+        """Return the label name defined by `text` as written, before case folding."""
+        match = re.match(r"^\s*([A-Za-z_][A-Za-z0-9_]*)\:", text)
+        return match.group(1) if match else None
+
     def split_local_label_prefix(self, text: str) -> Tuple[Optional[str], str]:
         match = re.match(r"^\s*\*([A-Za-z_][A-Za-z0-9_]*)\:(.*)$", text)
         if not match:
@@ -495,6 +993,497 @@ class AssemblyHelper:
         rewritten = re.sub(r"(?<![@A-Za-z0-9_])\*([A-Za-z_][A-Za-z0-9_]*)", replace_bare_local_ref, rewritten)
         return rewritten
 
+    def extract_runtime_checks(self, lines: List[SourceLine]) -> List[SourceLine]:
+        """Replace `.assert` lines with marker labels and `.test`/`.endtest` with the block's bounds.
+
+        A marker label records the address of the next instruction, so an assert costs no ROM.
+        `.endtest` becomes a `HLT` that ends the test. Without include_tests the whole block,
+        asserts included, is left out of the build. resolve_runtime_checks turns the markers into
+        last_assertions and last_tests once labels have addresses.
+        """
+        self.pending_assertions = []
+        self.pending_tests = []
+        kept: List[SourceLine] = []
+        test_line: Optional[SourceLine] = None
+        test_name: Optional[str] = None
+        test_marker = ""
+        skipping = False
+
+        for source_line in lines:
+            label_name, instruction_text = self.split_label_prefix(source_line.text)
+            parts = instruction_text.split(None, 1)
+            directive = parts[0].lower() if parts else ""
+            if directive not in {".assert", ".test", ".endtest"}:
+                if not skipping:
+                    kept.append(source_line)
+                continue
+
+            def error(message: str) -> ValueError:
+                return ValueError(f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): {message}")
+
+            argument = parts[1].strip() if len(parts) > 1 else ""
+            if label_name is not None and not skipping:
+                kept.append(source_line.with_text(f"{label_name}:"))
+            marker = f"__CHECK{len(self.pending_assertions) + len(self.pending_tests)}"
+            if directive == ".test":
+                if test_line is not None:
+                    raise error(f".test blocks cannot nest; '{test_name}' is still open")
+                if STRING_LITERAL_RE.fullmatch(argument):
+                    argument = ast.literal_eval(argument)
+                if not argument:
+                    raise error(".test requires a test name")
+                test_line, test_name, test_marker = source_line, argument, marker
+                skipping = not self.include_tests
+                if not skipping:
+                    kept.append(source_line.with_text(f"{marker}_START:"))
+            elif directive == ".endtest":
+                if test_line is None:
+                    raise error(".endtest without a matching .test")
+                if argument:
+                    raise error(".endtest takes no arguments")
+                if not skipping:
+                    kept.append(source_line.with_text(f"{test_marker}_END: HLT"))
+                    self.pending_tests.append((test_name, f"{test_marker}_START", f"{test_marker}_END", test_line))
+                test_line, test_name, skipping = None, None, False
+            elif not skipping:
+                match = ASSERT_ARGUMENTS_RE.match(argument)
+                expression, message = (match.group("expression"), ast.literal_eval(match.group("message"))) if match else (argument, "")
+                if not expression:
+                    raise error('.assert requires an expression: .assert expr[, "message"]')
+                kept.append(source_line.with_text(f"{marker}:"))
+                self.pending_assertions.append((marker, expression, message, source_line, test_name))
+
+        if test_line is not None:
+            raise ValueError(
+                f"Error on line {self.format_line_ref(test_line)} ('{test_line.text}'): "
+                f".test '{test_name}' is missing its .endtest"
+            )
+        return kept
+
+    def resolve_runtime_checks(self, labels: Dict[str, int], constants: Dict[str, int]) -> None:
+        """Take the marker labels of extract_runtime_checks out of `labels` and check each assert parses.
+
+        Names are checked against the labels, constants, and RUNTIME_SYMBOLS, with every RAM read
+        taken as 0, so a misspelt register fails the build rather than the run.
+        """
+        for marker, expression, message, source_line, test in self.pending_assertions:
+            self.last_assertions.append(
+                RuntimeAssertion(labels.pop(marker.upper()), expression, message, source_line.source_name, source_line.line_number, test)
+            )
+        for name, start, end, source_line in self.pending_tests:
+            self.last_tests.append(
+                ProgramTest(name, labels.pop(start.upper()), labels.pop(end.upper()), source_line.source_name, source_line.line_number)
+            )
+        variables = {**constants, **labels, **{name: 0 for name in RUNTIME_SYMBOLS}}
+        errors = []
+        for _, expression, _, source_line, _ in self.pending_assertions:
+            try:
+                self.evaluate_runtime_expression(expression, variables, lambda address: 0)
+            except ValueError as exc:
+                errors.append(f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): {exc}")
+        if errors:
+            self.raise_collected_errors(errors)
+
+    def apply_checksums(self, binary_lines: List[str], labels: Dict[str, int], constants: Dict[str, int]) -> None:
+        """Fill in each `.checksum` and `.crc16` from the finished image, in source order.
+
+        A range may cover earlier checksum fields, and then sees their final values, but not its
+        own field or a later one.
+        """
+        fields = []
+        for entry in self.last_listing:
+            _, instruction_text = self.split_label_prefix(entry.source_text)
+            instruction, args = self.parse_instruction(instruction_text)
+            if instruction.upper() in CHECKSUM_SIZES and len(entry.binary_bytes) == CHECKSUM_SIZES[instruction.upper()]:
+                fields.append((entry, instruction.lower(), args))
+        for index, (entry, directive, args) in enumerate(fields):
+            where = f"Error on line {entry.source_name}:{entry.line_number} ('{entry.source_text}')"
+            start, end = self.layout_directives.parse_checksum_range(args, labels, constants, directive)
+            if end > len(binary_lines):
+                raise ValueError(f"{where}: {directive} range ends at 0x{end:04X}, past the last byte at 0x{len(binary_lines) - 1:04X}")
+            for later, _, _ in fields[index:]:
+                if start < later.address + len(later.binary_bytes) and later.address < end:
+                    which = "its own" if later is entry else f"a later checksum's ({later.source_name}:{later.line_number})"
+                    raise ValueError(f"{where}: {directive} range 0x{start:04X}-0x{end:04X} covers {which} field at 0x{later.address:04X}")
+            data = bytes(int(line, 2) for line in binary_lines[start:end])
+            values = [checksum8(data)] if directive == ".checksum" else list(crc16(data).to_bytes(2, "little"))
+            for offset, value in enumerate(values):
+                binary_lines[entry.address + offset] = f"{value:08b}\n"
+                entry.binary_bytes[offset] = f"{value:08b}"
+
+    def evaluate_runtime_expression(self, expression: str, variables: Dict[str, int], read_ram: Callable[[int], int]) -> int:
+        """Evaluate an expression over machine state, replacing each `[expr]` by `read_ram(expr)`."""
+        previous = None
+        while previous != expression:
+            previous = expression
+            expression = RAM_READ_RE.sub(
+                lambda match: str(read_ram(self.evaluate_expression(match.group(1), variables) & 0xFFFF)),
+                expression,
+            )
+        return self.evaluate_expression(expression, variables)
+
+    def extract_linkage(self, lines: List[SourceLine]) -> Tuple[List[SourceLine], List[str], List[str]]:
+        """Drop `.global NAME, ...` and `.extern NAME, ...` lines; return (lines, globals, externs)."""
+        kept: List[SourceLine] = []
+        declared: Dict[str, List[str]] = {".global": [], ".extern": []}
+        for source_line in lines:
+            parts = source_line.text.split(None, 1)
+            directive = parts[0].lower() if parts else ""
+            if directive not in declared:
+                kept.append(source_line)
+                continue
+            names = [name.strip() for name in parts[1].split(",")] if len(parts) > 1 else []
+            if not names or not all(IDENTIFIER_RE.fullmatch(name) for name in names):
+                raise ValueError(
+                    f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                    f"{directive} requires one or more comma-separated names"
+                )
+            declared[directive].extend(name.upper() for name in names if name.upper() not in declared[directive])
+        return kept, declared[".global"], declared[".extern"]
+
+    def resolve_weak_labels(self, lines: List[SourceLine]) -> List[SourceLine]:
+        """Drop `.weak NAME` markers and keep a single definition for each weak label.
+
+        `.weak NAME` marks the next definition of NAME as weak. A strong definition always wins;
+        among weak definitions only the first one is kept. Discarded definitions keep their
+        instruction but lose the label.
+        """
+        kept: List[SourceLine] = []
+        pending: Dict[str, SourceLine] = {}
+        weak_indexes: set[int] = set()
+        definitions: Dict[str, List[int]] = {}
+
+        for source_line in lines:
+            parts = source_line.text.split()
+            if parts and parts[0].lower() == ".weak":
+                if len(parts) != 2 or not IDENTIFIER_RE.fullmatch(parts[1]):
+                    raise ValueError(
+                        f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                        ".weak requires exactly one label name"
+                    )
+                pending[parts[1].upper()] = source_line
+                continue
+
+            label_name, _ = self.split_label_prefix(source_line.text)
+            if label_name is not None:
+                if pending.pop(label_name, None) is not None:
+                    weak_indexes.add(len(kept))
+                definitions.setdefault(label_name, []).append(len(kept))
+            kept.append(source_line)
+
+        for name, marker_line in pending.items():
+            raise ValueError(
+                f"Error on line {self.format_line_ref(marker_line)} ('{marker_line.text}'): "
+                f".weak {name.lower()} is not followed by a definition of that label"
+            )
+
+        dropped: set[int] = set()
+        for indexes in definitions.values():
+            weak = [index for index in indexes if index in weak_indexes]
+            if not weak:
+                continue
+            strong = [index for index in indexes if index not in weak_indexes]
+            winner = strong[0] if strong else weak[0]
+            dropped.update(index for index in weak if index != winner)
+
+        resolved: List[SourceLine] = []
+        for index, source_line in enumerate(kept):
+            if index not in dropped:
+                resolved.append(source_line)
+                continue
+            _, remainder = self.split_label_prefix(source_line.text)
+            if remainder:
+                resolved.append(source_line.with_text(remainder))
+        return resolved
+
+    def extract_endianness(self, lines: List[SourceLine]) -> List[SourceLine]:
+        """Drop `.endian little|big` lines, noting in big_endian_lines each `.word` that stores high byte first.
+
+        Every program starts little-endian, the order of the CPU's own 16-bit fields.
+        """
+        self.big_endian_lines = set()
+        kept: List[SourceLine] = []
+        big = False
+        for source_line in lines:
+            label_name, instruction_text = self.split_label_prefix(source_line.text)
+            parts = instruction_text.split()
+            directive = parts[0].upper() if parts else ""
+            if directive == ".ENDIAN":
+                if len(parts) != 2 or parts[1].lower() not in {"little", "big"}:
+                    raise ValueError(
+                        f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                        ".endian takes 'little' or 'big'"
+                    )
+                big = parts[1].lower() == "big"
+                if label_name is not None:
+                    kept.append(source_line.with_text(f"{label_name}:"))
+                continue
+            if big and directive == ".WORD":
+                self.big_endian_lines.add(id(source_line))
+            kept.append(source_line)
+        return kept
+
+    def find_case_only_differences(self, lines: List[SourceLine]) -> List[str]:
+        """Warn about label and constant definitions whose names differ only in letter case.
+
+        Names are case-insensitive, so `Loop` and `LOOP` are the same symbol. A constant defined
+        twice is silently overwritten and a constant may share its name with a label; both are
+        reported here when the spellings differ. Two labels always fail as duplicates instead.
+        """
+        warnings: List[str] = []
+        first_seen: Dict[str, Tuple[str, str, SourceLine]] = {}
+
+        for source_line in lines:
+            definitions: List[Tuple[str, str]] = []
+            label_spelling = self.defined_label_spelling(source_line.text)
+            if label_spelling is not None:
+                definitions.append((label_spelling, "label"))
+            else:
+                parts = source_line.text.split(None, 1)
+                if len(parts) == 2 and parts[0].lower() == self.constant_keyword:
+                    for piece in self.split_top_level_commas(parts[1]):
+                        name = piece.split(None, 1)[0] if piece.split() else ""
+                        if IDENTIFIER_RE.fullmatch(name):
+                            definitions.append((name, "constant"))
+
+            for spelling, kind in definitions:
+                key = spelling.upper()
+                first = first_seen.get(key)
+                if first is None:
+                    first_seen[key] = (spelling, kind, source_line)
+                    continue
+                first_spelling, first_kind, first_line = first
+                if first_spelling == spelling or (kind == "label" and first_kind == "label"):
+                    continue
+                warnings.append(
+                    f"Line {self.format_line_ref(source_line)}: {kind} '{spelling}' differs only in case from "
+                    f"{first_kind} '{first_spelling}' on line {self.format_line_ref(first_line)}; "
+                    f"both name the symbol {key}"
+                )
+        return warnings
+
+    def find_case_mismatched_references(self, lines: List[SourceLine]) -> List[str]:
+        """Report label and constant references not spelled exactly as their definition.
+
+        Names still fold to one symbol; this only makes `loop` an error where `Loop:` is defined.
+        """
+        definitions: Dict[str, Tuple[str, SourceLine]] = {}
+        for source_line in lines:
+            spellings: List[str] = []
+            label_spelling = self.defined_label_spelling(source_line.text)
+            if label_spelling is not None:
+                spellings.append(label_spelling)
+            parts = source_line.text.split(None, 1)
+            if len(parts) == 2 and parts[0].lower() in {self.constant_keyword, ".set"}:
+                for piece in self.split_top_level_commas(parts[1]):
+                    name = piece.split(None, 1)[0] if piece.split() else ""
+                    if IDENTIFIER_RE.fullmatch(name):
+                        spellings.append(name)
+            for spelling in spellings:
+                definitions.setdefault(spelling.upper(), (spelling, source_line))
+
+        errors: List[str] = []
+        for source_line in lines:
+            _, instruction_text = self.split_label_prefix(source_line.text)
+            parts = instruction_text.split(None, 1)
+            if len(parts) == 2 and parts[0].lower() in {self.constant_keyword, ".set"}:
+                # Keep only the values; the names being defined were collected above.
+                pieces = [piece.split(None, 1) for piece in self.split_top_level_commas(parts[1])]
+                values = [piece[1] for piece in pieces if len(piece) == 2]
+                instruction_text = f"{parts[0]} {', '.join(values)}"
+            text = STRING_LITERAL_RE.sub('""', instruction_text)
+            # The first word is the mnemonic or directive, never a symbol reference.
+            for match in list(re.finditer(r"(?<![A-Za-z0-9_])[A-Za-z_][A-Za-z0-9_]*", text))[1:]:
+                spelling = match.group(0)
+                definition = definitions.get(spelling.upper())
+                if definition is None or definition[0] == spelling:
+                    continue
+                errors.append(
+                    f"Line {self.format_line_ref(source_line)}: '{spelling}' does not match the spelling "
+                    f"'{definition[0]}' defined on line {self.format_line_ref(definition[1])} (--strict-case)"
+                )
+        return errors
+
+    def rewrite_numeric_labels(self, lines: List[SourceLine]) -> List[SourceLine]:
+        """Rename GNU-style numeric labels: `1:` defines, `1b` / `1f` refer to the nearest one back / forward.
+
+        A numeric label may be defined any number of times. Each definition becomes a unique
+        `__N<number>_<count>` label; a definition on the same line counts as backward.
+        """
+        definitions: Dict[str, List[int]] = {}
+        for index, source_line in enumerate(lines):
+            match = NUMERIC_LABEL_DEF_RE.match(source_line.text)
+            if match is not None:
+                definitions.setdefault(str(int(match.group(1))), []).append(index)
+        if not definitions and not any(NUMERIC_LABEL_REF_RE.search(line.text) for line in lines):
+            return lines
+
+        def label_name(number: str, occurrence: int) -> str:
+            return f"__N{number}_{occurrence}"
+
+        rewritten: List[SourceLine] = []
+        for index, source_line in enumerate(lines):
+            text = source_line.text
+            prefix = ""
+            match = NUMERIC_LABEL_DEF_RE.match(text)
+            if match is not None:
+                number = str(int(match.group(1)))
+                prefix = f"{label_name(number, definitions[number].index(index))}: "
+                text = match.group(2).strip()
+
+            def replace(reference: re.Match[str]) -> str:
+                number = str(int(reference.group(1)))
+                positions = definitions.get(number, [])
+                if reference.group(2) in "bB":
+                    earlier = [position for position in positions if position <= index]
+                    if not earlier:
+                        raise ValueError(
+                            f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                            f"Numeric label reference {reference.group(0)} has no '{number}:' before it"
+                        )
+                    return label_name(number, positions.index(earlier[-1]))
+                later = [position for position in positions if position > index]
+                if not later:
+                    raise ValueError(
+                        f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                        f"Numeric label reference {reference.group(0)} has no '{number}:' after it"
+                    )
+                return label_name(number, positions.index(later[0]))
+
+            pieces: List[str] = []
+            last_end = 0
+            for literal in STRING_LITERAL_RE.finditer(text):
+                pieces.append(NUMERIC_LABEL_REF_RE.sub(replace, text[last_end:literal.start()]))
+                pieces.append(literal.group(0))
+                last_end = literal.end()
+            pieces.append(NUMERIC_LABEL_REF_RE.sub(replace, text[last_end:]))
+            rewritten.append(
+                source_line.with_text((prefix + "".join(pieces)).strip())
+            )
+        return rewritten
+
+    def register_names(self) -> List[str]:
+        """Register names of the current target, in table order."""
+        if self.target != TARGET_V2:
+            if self.v1_encoder is None:
+                self.v1_encoder = V1Encoder.load()
+            names = [name for registers in self.v1_encoder.register_sets.values() for name in registers]
+        else:
+            names = [*DESTINATIONS, *SOURCES, *PUSH_SOURCES]
+        return list(dict.fromkeys(names))
+
+    def parse_register_alias(self, text: str) -> Optional[Tuple[str, str]]:
+        """Return (NAME, REGISTER) for `.reg NAME, REGISTER`, None for other lines; malformed `.reg` raises."""
+        parts = text.split(None, 1)
+        if not parts or parts[0].lower() != ".reg":
+            return None
+        operands = [piece for piece in re.split(r"[\s,]+", parts[1].strip()) if piece] if len(parts) == 2 else []
+        if len(operands) != 2 or not all(IDENTIFIER_RE.fullmatch(operand) for operand in operands):
+            raise ValueError("Invalid .reg definition: expected '.reg NAME, REGISTER'")
+        return operands[0].upper(), operands[1].upper()
+
+    def apply_register_aliases(self, lines: List[SourceLine], fail_fast: bool = False) -> List[SourceLine]:
+        """Remove `.reg` lines and replace each alias with its register in the operands that follow.
+
+        An alias is visible from its definition to the end of the program; a later `.reg` for the same
+        name shadows it from that line on. Two aliases in effect for one register draw a warning.
+        """
+        registers = self.register_names()
+        label_lines: Dict[str, SourceLine] = {}
+        for source_line in lines:
+            label_name, _ = self.split_label_prefix(source_line.text)
+            if label_name is not None:
+                label_lines.setdefault(label_name, source_line)
+
+        aliases: Dict[str, Tuple[str, SourceLine]] = {}
+        remaining_lines: List[SourceLine] = []
+        errors: List[str] = []
+        for source_line in lines:
+            try:
+                definition = self.parse_register_alias(source_line.text)
+                if definition is None:
+                    if aliases:
+                        source_line = source_line.with_text(
+                            self.rewrite_register_aliases(source_line.text, {name: register for name, (register, _) in aliases.items()})
+                        )
+                    remaining_lines.append(source_line)
+                    continue
+
+                name, register = definition
+                if register in aliases:
+                    register = aliases[register][0]
+                if register not in registers:
+                    raise ValueError(f"Unknown register {register} for .reg {name}; expected one of: {', '.join(registers)}")
+                if name in registers or name in KNOWN_MNEMONICS:
+                    raise ValueError(f".reg name {name} is already a register or instruction name")
+                if name in label_lines:
+                    raise ValueError(
+                        f".reg name {name} is also a label (line {self.format_line_ref(label_lines[name])})"
+                    )
+                for other_name, (other_register, other_line) in aliases.items():
+                    if other_name != name and other_register == register:
+                        self.last_warnings.append(
+                            f"Line {self.format_line_ref(source_line)}: register alias {name} names {register}, "
+                            f"which is still aliased as {other_name} from line {self.format_line_ref(other_line)}"
+                        )
+                aliases[name] = (register, source_line)
+            except ValueError as exc:
+                error = f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): {exc}"
+                if fail_fast:
+                    raise ValueError(error) from exc
+                errors.append(error)
+
+        if errors:
+            self.raise_collected_errors(errors)
+        return remaining_lines
+
+    def rewrite_register_aliases(self, text: str, aliases: Dict[str, str]) -> str:
+        """Replace register aliases in the operand part of one line; mnemonics, labels, and strings are left alone."""
+        match = REGISTER_ALIAS_HEAD_RE.match(text)
+        if match is None or match.group(2).lower() in {self.constant_keyword, ".set"}:
+            return text
+        pattern = re.compile(
+            r"(?<![A-Za-z0-9_@$#.*])(" + "|".join(re.escape(name) for name in aliases) + r")(?![A-Za-z0-9_:(])",
+            re.IGNORECASE,
+        )
+        operands = match.group(3)
+        pieces: List[str] = []
+        last_end = 0
+        for literal in STRING_LITERAL_RE.finditer(operands):
+            pieces.append(pattern.sub(lambda found: aliases[found.group(1).upper()], operands[last_end:literal.start()]))
+            pieces.append(literal.group(0))
+            last_end = literal.end()
+        pieces.append(pattern.sub(lambda found: aliases[found.group(1).upper()], operands[last_end:]))
+        return match.group(1) + "".join(pieces)
+
+    def expand_location_symbols(self, lines: List[SourceLine]) -> List[SourceLine]:
+        """Replace `__LINE__` with the line number and `__FILE__` with a string literal of the file name.
+
+        Both refer to the line's original location, so code pulled in by `.include` reports the
+        included file. Occurrences inside string and character literals are left alone.
+        """
+        expanded: List[SourceLine] = []
+        for source_line in lines:
+            text = source_line.text
+            if "__" not in text:
+                expanded.append(source_line)
+                continue
+
+            file_literal = '"' + source_line.source_name.replace("\\", "\\\\").replace('"', '\\"') + '"'
+
+            def replace(match: re.Match[str]) -> str:
+                return str(source_line.line_number) if match.group(1) == "LINE" else file_literal
+
+            pieces: List[str] = []
+            last_end = 0
+            for literal in STRING_LITERAL_RE.finditer(text):
+                pieces.append(LOCATION_SYMBOL_RE.sub(replace, text[last_end:literal.start()]))
+                pieces.append(literal.group(0))
+                last_end = literal.end()
+            pieces.append(LOCATION_SYMBOL_RE.sub(replace, text[last_end:]))
+            expanded.append(source_line.with_text("".join(pieces)))
+        return expanded
+
     def rewrite_local_labels(self, lines: List[SourceLine]) -> List[SourceLine]:
         rewritten: List[SourceLine] = []
         current_scope: Optional[str] = None
@@ -514,7 +1503,7 @@ class AssemblyHelper:
                 if rewritten_remainder:
                     rewritten_text = f"{rewritten_text} {rewritten_remainder}"
                 rewritten.append(
-                    SourceLine(source_line.line_number, rewritten_text, source_name=source_line.source_name)
+                    source_line.with_text(rewritten_text)
                 )
                 continue
 
@@ -536,13 +1525,13 @@ class AssemblyHelper:
                 if rewritten_remainder:
                     rewritten_text = f"{rewritten_text} {rewritten_remainder}"
                 rewritten.append(
-                    SourceLine(source_line.line_number, rewritten_text, source_name=source_line.source_name)
+                    source_line.with_text(rewritten_text)
                 )
                 continue
 
             rewritten_text = self.rewrite_local_label_references(text, current_scope, source_line)
             rewritten.append(
-                SourceLine(source_line.line_number, rewritten_text, source_name=source_line.source_name)
+                source_line.with_text(rewritten_text)
             )
 
         return rewritten
@@ -609,9 +1598,28 @@ class AssemblyHelper:
 
         operands: List[str] = []
         for operand in raw_operands:
-            operands.extend(self.split_top_level_whitespace(operand))
+            operands.extend(self.join_operator_parts(self.split_top_level_whitespace(operand)))
         return operands
 
+    def join_operator_parts(self, parts: List[str]) -> List[str]:
+        """Rejoin whitespace-separated pieces of one expression such as `ENABLE | IRQ`.
+
+        Adjacent double-quoted strings (`"part1" "part2"`) are kept together and concatenate C-style.
+        """
+        joined: List[str] = []
+        for part in parts:
+            continues_previous = bool(joined) and (
+                joined[-1][-1] in OPERATOR_CHARS + "+-"
+                or part[0] in OPERATOR_CHARS
+                or part in {"+", "-"}
+                or (joined[-1][0] == '"' and joined[-1][-1] == '"' and part[0] == '"')
+            )
+            if continues_previous:
+                joined[-1] = f"{joined[-1]} {part}"
+            else:
+                joined.append(part)
+        return joined
+
     def split_top_level_whitespace(self, text: str) -> List[str]:
         parts: List[str] = []
         current: List[str] = []
@@ -672,14 +1680,23 @@ class AssemblyHelper:
         return parts
 
     def parse_source_line(self, source_line: SourceLine) -> ParsedLine:
+        if self.cache_parsing:
+            cached = self.parse_cache.get(source_line)
+            if cached is not None:
+                return cached
+
         _, instruction_text = self.split_label_prefix(source_line.text)
         instruction, args = self.parse_instruction(instruction_text)
-        return ParsedLine(
+        parsed = ParsedLine(
             line_number=source_line.line_number,
             raw_line=source_line.text,
             instruction=instruction,
             args=args,
+            column=source_line.column,
         )
+        if self.cache_parsing:
+            self.parse_cache[source_line] = parsed
+        return parsed
 
     def is_jump_name(self, token: str) -> bool:
         token_upper = token.upper()
@@ -730,6 +1747,29 @@ class AssemblyHelper:
         allow_unresolved: bool = False,
     ) -> ResolvedValue:
         token = token.strip()
+        if not self.cache_parsing:
+            return self.classify_base_value(token, labels, constants, allow_unresolved)
+        if constants is not self.operand_cache_constants:
+            self.operand_cache = {}
+            self.operand_cache_constants = constants
+        cached = self.operand_cache.get(token)
+        if cached is not None:
+            return cached
+        resolved = self.classify_base_value(token, labels, constants, allow_unresolved)
+        if resolved.kind in {"zero", "char", "numeric"} or (
+            resolved.kind == "constant" and token[len(self.constant_prefix) :].strip().upper() in constants
+        ):
+            # A constant assumed to be 0 under --undef-zero is not cached, so every reference is still reported.
+            self.operand_cache[token] = resolved
+        return resolved
+
+    def classify_base_value(
+        self,
+        token: str,
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        allow_unresolved: bool = False,
+    ) -> ResolvedValue:
         token_upper = token.upper()
 
         if token_upper == "ZERO":
@@ -739,43 +1779,118 @@ class AssemblyHelper:
         if char_value is not None:
             return ResolvedValue(raw_text=token, value=char_value, kind="char")
 
-        if token.startswith(self.number_prefix) or re.fullmatch(r"(0[xX][0-9a-fA-F]+|0[bB][01]+|\d+)", token):
+        expression_token = token
+        if token.startswith(self.number_prefix):
+            try:
+                return ResolvedValue(raw_text=token, value=self.to_decimal(token), kind="numeric")
+            except ValueError:
+                expression_token = token[len(self.number_prefix) :].strip()
+        elif re.fullmatch(r"(0[xX][0-9a-fA-F]+|0[bB][01]+|0[oO][0-7]+|\d+)", token):
             return ResolvedValue(raw_text=token, value=self.to_decimal(token), kind="numeric")
 
         if token_upper == "0":
             return ResolvedValue(raw_text=token, value=0, kind="zero")
 
-        if token.startswith(self.constant_prefix):
+        if token.startswith(self.constant_prefix) and IDENTIFIER_RE.fullmatch(token[len(self.constant_prefix) :].strip()):
             name = token[len(self.constant_prefix) :].strip().upper()
             if name not in constants:
-                raise ValueError(f"Undefined constant reference: {token}")
+                if self.assume_zero(name, "constant"):
+                    return ResolvedValue(raw_text=token, value=0, kind="constant")
+                raise ValueError(f"Undefined constant reference: {token}{self.undefined_symbol_hint(name, 'constant', labels, constants)}")
             return ResolvedValue(raw_text=token, value=constants[name], kind="constant")
 
-        if token.startswith(self.label_prefix):
+        if token.startswith(self.label_prefix) and IDENTIFIER_RE.fullmatch(token[len(self.label_prefix) :].strip()):
             name = token[len(self.label_prefix) :].strip().upper()
             if name not in labels:
+                if self.assume_zero(name, "label"):
+                    return ResolvedValue(raw_text=token, value=0, kind="label")
                 if allow_unresolved:
                     return ResolvedValue(raw_text=token, value=None, kind="label")
-                raise ValueError(f"Undefined label reference: {token}")
+                raise ValueError(
+                    f"Undefined label reference: {token}{self.undefined_symbol_hint(name, 'label', labels, constants, self.label_prefix)}"
+                )
             return ResolvedValue(raw_text=token, value=labels[name], kind="label")
 
         if re.fullmatch(r"[A-Za-z_][A-Za-z0-9_]*", token):
             name = token_upper
             if name in labels:
                 return ResolvedValue(raw_text=token, value=labels[name], kind="label")
+            if name not in constants and self.assume_zero(name, "label"):
+                return ResolvedValue(raw_text=token, value=0, kind="label")
             if allow_unresolved:
                 return ResolvedValue(raw_text=token, value=None, kind="label")
 
         try:
-            evaluated = self.evaluate_operand_expression(token, labels, constants, allow_unresolved=allow_unresolved)
+            evaluated = self.evaluate_operand_expression(
+                expression_token,
+                labels,
+                constants,
+                allow_unresolved=allow_unresolved,
+            )
             if evaluated is None:
                 return ResolvedValue(raw_text=token, value=None, kind="expression")
             return ResolvedValue(raw_text=token, value=evaluated, kind="expression")
-        except ValueError:
-            pass
+        except ValueError as exc:
+            if str(exc).startswith("Undefined "):
+                raise
 
+        if IDENTIFIER_RE.fullmatch(token):
+            raise ValueError(f"Unsupported operand value: {token}{self.undefined_symbol_hint(token_upper, 'symbol', labels, constants)}")
         raise ValueError(f"Unsupported operand value: {token}")
 
+    def assume_zero(self, name: str, kind: str) -> bool:
+        """Return True, recording the reference, when the undefined symbol `name` should read as 0.
+
+        That holds for external_symbols while an object is built, and for any name under undefined_as_zero.
+        """
+        if kind == "label" and name in self.defined_label_names:
+            return False
+        line = self.emitting_line
+        if name in self.external_symbols:
+            if line is not None and not any(
+                reference[:2] == (name, kind) and reference[2] is line for reference in self.last_external_references
+            ):
+                self.last_external_references.append((name, kind, line))
+            return True
+        if not self.undefined_as_zero:
+            return False
+        if line is not None:
+            reference = UndefinedReference(name, kind, line.source_name, line.line_number)
+            if reference not in self.last_undefined_references:
+                self.last_undefined_references.append(reference)
+        return True
+
+    def undefined_symbol_hint(
+        self,
+        name: str,
+        kind: str,
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        label_prefix: str = "",
+    ) -> str:
+        """Return a " (did you mean ...?)" suffix for an undefined label, constant, or bare symbol.
+
+        A name that exists as the other kind is pointed at with the right prefix; otherwise the
+        nearest user-visible name of the same kind is suggested. Internal names (containing `__`,
+        such as rewritten local labels) are never suggested.
+        """
+        name = name.upper()
+        if kind == "label" and name in constants:
+            return f" ({name} is a constant; use {self.constant_prefix}{name})"
+        if kind == "constant" and name in labels:
+            return f" ({name} is a label; use {self.label_prefix}{name})"
+
+        candidates: Dict[str, str] = {}
+        if kind in {"label", "symbol"}:
+            candidates.update({label: f"{label_prefix}{label}" for label in labels if "__" not in label})
+        if kind in {"constant", "symbol"}:
+            prefix = self.constant_prefix if kind == "constant" else ""
+            candidates.update({constant: f"{prefix}{constant}" for constant in constants if "__" not in constant})
+        suggestion = closest_match(name, candidates)
+        if suggestion is None:
+            return ""
+        return f" (did you mean {candidates[suggestion]}?)"
+
     def resolve_value(
         self,
         token: str,
@@ -880,6 +1995,10 @@ class AssemblyHelper:
         labels: Dict[str, int],
         constants: Dict[str, int],
     ) -> int:
+        if self.target != TARGET_V2:
+            layout_size = self.layout_directives.estimate_size(instruction, args, current_pc, labels, constants)
+            return 1 if layout_size is None else layout_size
+
         instruction, args = self.normalize_instruction(instruction, args)
 
         if instruction == "LDI":
@@ -932,22 +2051,148 @@ class AssemblyHelper:
 
         return 1
 
-    def build_labels(self, lines: List[SourceLine], constants: Dict[str, int]) -> Dict[str, int]:
+    def duplicate_label_error(self, label_name: str, source_line: SourceLine, first: SourceLine) -> str:
+        first_spelling = self.defined_label_spelling(first.text)
+        spelling = self.defined_label_spelling(source_line.text)
+        hint = ""
+        if first_spelling != spelling:
+            hint = (
+                f" ('{spelling}' and '{first_spelling}' on line {self.format_line_ref(first)} "
+                "differ only in case; labels are case-insensitive)"
+            )
+        return (
+            f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+            f"Duplicate label definition: {label_name}{hint}"
+        )
+
+    def find_duplicate_labels(self, lines: List[SourceLine]) -> List[str]:
+        """Return an error for every repeated label definition, so one run reports all of them."""
+        errors: List[str] = []
+        first_definitions: Dict[str, SourceLine] = {}
+        for source_line in lines:
+            label_name, _ = self.split_label_prefix(source_line.text)
+            if label_name is None:
+                continue
+            if label_name in first_definitions:
+                errors.append(self.duplicate_label_error(label_name, source_line, first_definitions[label_name]))
+            else:
+                first_definitions[label_name] = source_line
+        return errors
+
+    def raise_collected_errors(self, errors: List[str]) -> None:
+        """Leave `errors` in last_errors and raise them as one ValueError (`N errors:` for several)."""
+        self.last_errors = list(errors)
+        if len(errors) == 1:
+            raise ValueError(errors[0])
+        raise ValueError(f"{len(errors)} errors:\n" + "\n".join(errors))
+
+    def extract_data_section(
+        self,
+        lines: List[SourceLine],
+        constants: Dict[str, int],
+        data_base: int = 0,
+        fail_fast: bool = False,
+    ) -> List[SourceLine]:
+        """Split `.data` blocks out of the program and give their labels RAM addresses.
+
+        `.text` and `.data` switch sections, and a program starts in `.text`. Each section keeps its own
+        location counter across switches. `.data` counts from `data_base` in the data address space, holds
+        only labels and `.fill`/`.org`/`.padto`/`.align` reservations, and emits no ROM bytes; its labels
+        are left in `data_labels` for the code layout passes. `.text fill=BYTE` sets the byte that later
+        `.text` padding uses when it names none, recorded in `section_fill_bytes`.
+        """
+        self.data_labels = {}
+        self.section_fill_bytes = {}
+        text_lines: List[SourceLine] = []
+        errors: List[str] = []
+        section = ".text"
+        data_pc = data_base
+        text_fill = 0
+
+        for source_line in lines:
+            try:
+                parts = source_line.text.split(None, 1)
+                keyword = parts[0].lower() if parts else ""
+                if keyword in {".text", ".data"}:
+                    section = keyword
+                    if len(parts) > 1:
+                        text_fill = self.parse_section_fill(keyword, parts[1], constants)
+                    continue
+                if section == ".text":
+                    if text_fill:
+                        _, instruction_text = self.split_label_prefix(source_line.text)
+                        directive, args = self.parse_instruction(instruction_text) if instruction_text else ("", [])
+                        if directive in SECTION_FILL_DIRECTIVES and len(args) == 1:
+                            self.section_fill_bytes[id(source_line)] = text_fill
+                    text_lines.append(source_line)
+                    continue
+
+                label_name, instruction_text = self.split_label_prefix(source_line.text)
+                if label_name is not None:
+                    self.data_labels[label_name] = data_pc
+                if not instruction_text:
+                    continue
+                parsed = self.parse_source_line(source_line)
+                if parsed.instruction not in DATA_SECTION_DIRECTIVES:
+                    raise ValueError(
+                        f"{parsed.instruction} cannot appear in .data; only labels and .fill, .space, .org, .padto, and .align "
+                        "reserve space there"
+                    )
+                if len(parsed.args) > 1:
+                    raise ValueError(f"{parsed.instruction} in .data reserves uninitialized RAM and takes no fill byte")
+                data_pc += self.layout_directives.estimate_size(
+                    parsed.instruction, parsed.args, data_pc, self.data_labels, constants
+                )
+                if data_pc > 0x10000:
+                    raise ValueError(f".data section ends at 0x{data_pc:X}, past the 0xFFFF address limit")
+            except ValueError as exc:
+                error = f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): {exc}"
+                if fail_fast:
+                    raise ValueError(error) from exc
+                errors.append(error)
+
+        if errors:
+            self.raise_collected_errors(errors)
+        self.data_range = (data_base, data_pc)
+        return text_lines
+
+    def parse_section_fill(self, keyword: str, operands: str, constants: Dict[str, int]) -> int:
+        """Return the byte of a `.text fill=BYTE` switch; `.data` takes no operands."""
+        if keyword == ".data":
+            raise ValueError(".data takes no operands; its RAM is not initialized, so it has no fill byte")
+        match = re.fullmatch(r"fill\s*=\s*(\S+)", operands.strip(), re.IGNORECASE)
+        if match is None:
+            raise ValueError(f".text takes only fill=BYTE, got '{operands.strip()}'")
+        return self.layout_directives.resolve_byte(match.group(1), {}, constants, ".text fill=")
+
+    def build_labels(
+        self,
+        lines: List[SourceLine],
+        constants: Dict[str, int],
+        sizing_errors: Optional[Dict[int, str]] = None,
+    ) -> Dict[str, int]:
+        """Give every label its address, resizing until the addresses stop moving.
+
+        Without `sizing_errors` the first line that cannot be sized raises. With it, such lines count
+        as one byte and their errors are left in it, keyed by id() of the line, so the caller can
+        report them in source order with the rest.
+        """
         guess: Dict[str, int] = {}
 
         for _ in range(32):
-            labels: Dict[str, int] = {}
+            labels: Dict[str, int] = dict(self.data_labels)
+            first_definitions: Dict[str, SourceLine] = {}
             pc = 0
+            if sizing_errors is not None:
+                sizing_errors.clear()
 
             for source_line in lines:
                 label_name, instruction_text = self.split_label_prefix(source_line.text)
                 if label_name is not None:
                     if label_name in labels:
-                        raise ValueError(
-                            f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
-                            f"Duplicate label definition: {label_name}"
-                        )
+                        raise ValueError(self.duplicate_label_error(label_name, source_line, first_definitions[label_name]))
                     labels[label_name] = pc
+                    first_definitions[label_name] = source_line
                     if not instruction_text:
                         continue
 
@@ -955,9 +2200,11 @@ class AssemblyHelper:
                 try:
                     pc += self.estimate_instruction_size(parsed.instruction, parsed.args, pc, guess, constants)
                 except Exception as e:
-                    raise ValueError(
-                        f"Error on line {self.format_line_ref(source_line)} ('{parsed.raw_line}'): {e}"
-                    )
+                    error = f"Error on line {self.format_line_ref(source_line)} ('{parsed.raw_line}'): {e}"
+                    if sizing_errors is None:
+                        raise ValueError(error)
+                    sizing_errors[id(source_line)] = error
+                    pc += 1
 
             if labels == guess:
                 return labels
@@ -965,18 +2212,26 @@ class AssemblyHelper:
 
         raise ValueError("Label address stabilization failed after 32 passes")
 
-    def emit_ldi(self, parsed: ParsedLine, args: List[str], labels: Dict[str, int], constants: Dict[str, int]) -> List[str]:
+    def emit_ldi(
+        self,
+        parsed: ParsedLine,
+        args: List[str],
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        instruction: str = "LDI",
+    ) -> List[str]:
         dest, value_token = self.normalize_ldi_args(args)
         resolved = self.resolve_value(value_token, labels, constants)
         if resolved.value is None:
-            raise ValueError(f"LDI could not resolve operand {value_token}")
+            raise ValueError(f"{instruction} could not resolve operand {value_token}")
         if resolved.sliced and resolved.width != 8:
-            raise ValueError("LDI sliced operands must be exactly 8 bits wide")
+            raise ValueError(f"{instruction} sliced operands must be exactly 8 bits wide")
 
-        if not resolved.sliced and resolved.value > 0xFF:
-            self.last_warnings.append(
-                f"Line {parsed.line_number} ('{parsed.raw_line}'): "
-                f"LDI operand resolves to 0x{resolved.value:X}; only the low byte 0x{resolved.value & 0xFF:02X} is used."
+        # Negative values down to -128 load as their two's-complement byte.
+        if not resolved.sliced and not (-0x80 <= resolved.value <= 0xFF):
+            raise ValueError(
+                f"{instruction} operand {value_token} resolves to {resolved.value}, out of range (-128..255); "
+                f"use LOW()/HIGH() or a [7:0] slice to pick one byte"
             )
 
         byte_value = resolved.value & 0xFF
@@ -1083,7 +2338,15 @@ class AssemblyHelper:
                 raise ValueError(f"{instruction} does not take operands")
             return self.encoder.encode_jump(instruction)
 
-        raise ValueError(f"Unknown instruction: {instruction}")
+        elsewhere = self.targets_supporting(instruction)
+        if elsewhere:
+            raise ValueError(f"{instruction} is not an {self.target} instruction; {instruction} is supported on: {', '.join(elsewhere)}")
+        kind = "directive" if instruction.startswith(".") else "instruction"
+        candidates = [name for name in KNOWN_MNEMONICS if name.startswith(".") == (kind == "directive")]
+        suggestion = closest_match(instruction, candidates)
+        if suggestion is not None:
+            raise ValueError(f"Unknown {kind}: {instruction} (did you mean {suggestion}?)")
+        raise ValueError(f"Unknown {kind}: {instruction}")
 
     def emit_instruction(
         self,
@@ -1092,6 +2355,9 @@ class AssemblyHelper:
         labels: Dict[str, int],
         constants: Dict[str, int],
     ) -> List[str]:
+        if self.target != TARGET_V2:
+            return self.emit_v1_instruction(parsed, current_pc, labels, constants)
+
         instruction, args = self.normalize_instruction(parsed.instruction, parsed.args)
 
         if instruction == "LDI":
@@ -1104,39 +2370,354 @@ class AssemblyHelper:
             return layout_emitted
         return [self.encode_actual_instruction(instruction, args, labels, constants)]
 
+    def check_entry_point(self, lines: List[SourceLine], labels: Dict[str, int], constants: Dict[str, int]) -> None:
+        """Check that `.entry` names the first byte of an instruction.
+
+        The core always starts at 0x0000; `.entry` states where a program is entered (`.entry 0`, or
+        the label a loader jumps to) so that address cannot land in padding or inside an instruction.
+        Every directive emits data or padding, never code, so its bytes are not a valid entry point.
+        """
+        entry_line: Optional[SourceLine] = None
+        for source_line in lines:
+            _, instruction_text = self.split_label_prefix(source_line.text)
+            if not instruction_text or instruction_text.split(None, 1)[0].upper() != ".ENTRY":
+                continue
+            if entry_line is not None:
+                raise ValueError(
+                    f"Error on line {self.format_line_ref(source_line)} ('{source_line.text}'): "
+                    f".entry is already set on line {self.format_line_ref(entry_line)}"
+                )
+            entry_line = source_line
+        if entry_line is None:
+            return
+
+        where = f"Error on line {self.format_line_ref(entry_line)} ('{entry_line.text}')"
+        _, args = self.parse_instruction(self.split_label_prefix(entry_line.text)[1])
+        if len(args) != 1:
+            raise ValueError(f"{where}: .entry requires one label or address")
+        entry_name = args[0][len(self.label_prefix):] if args[0].startswith(self.label_prefix) else args[0]
+        if entry_name.upper() in self.data_labels:
+            raise ValueError(f"{where}: entry point {args[0]} is a .data label, a RAM address rather than code")
+        address = self.resolve_value(args[0], labels, constants).value
+        if address is None:
+            raise ValueError(f"{where}: could not resolve entry point {args[0]}")
+        entry_text = f"entry point {args[0]} (0x{address:04X})"
+        for entry in self.last_listing:
+            if not entry.address <= address < entry.address + len(entry.binary_bytes):
+                continue
+            _, instruction_text = self.split_label_prefix(entry.source_text)
+            mnemonic = instruction_text.split(None, 1)[0]
+            location = f"'{entry.source_text}' on line {self.format_line_ref(entry)}"
+            if mnemonic.startswith("."):
+                raise ValueError(f"{where}: {entry_text} is in the {mnemonic.lower()} bytes of {location}, not an instruction")
+            if address != entry.address:
+                raise ValueError(f"{where}: {entry_text} is inside the instruction at 0x{entry.address:04X}, {location}")
+            return
+        end = self.last_listing[-1].address + len(self.last_listing[-1].binary_bytes) if self.last_listing else 0
+        raise ValueError(f"{where}: {entry_text} is outside the program image, which ends at 0x{end:04X}")
+
+    def emit_v1_instruction(
+        self,
+        parsed: ParsedLine,
+        current_pc: int,
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+    ) -> List[str]:
+        args = [arg.strip() for arg in parsed.args]
+        layout_emitted = self.layout_directives.emit(parsed, parsed.instruction, args, current_pc, labels, constants)
+        if layout_emitted is not None:
+            return layout_emitted
+        if self.v1_encoder is None:
+            self.v1_encoder = V1Encoder.load()
+        elsewhere = [] if parsed.instruction in self.v1_encoder.instructions else self.targets_supporting(parsed.instruction)
+        if elsewhere:
+            raise ValueError(
+                f"{parsed.instruction} is not an {self.target} instruction; {parsed.instruction} is supported on: {', '.join(elsewhere)}"
+            )
+        return [
+            self.v1_encoder.encode(
+                parsed.instruction,
+                args,
+                lambda token: self.resolve_value(token, labels, constants).value,
+            )
+        ]
+
+    def targets_supporting(self, instruction: str) -> List[str]:
+        """Other targets whose instruction set has `instruction`, in TARGETS order."""
+        instructions = {TARGET_V2: KNOWN_MNEMONICS | set(self.pseudo_instructions)}
+        try:
+            if self.v1_encoder is None:
+                self.v1_encoder = V1Encoder.load()
+            instructions[TARGET_V1] = set(self.v1_encoder.instructions)
+        except ValueError:
+            pass
+        return [
+            target
+            for target in TARGETS
+            if target != self.target and instruction in instructions.get(target, ()) and not instruction.startswith(".")
+        ]
+
+    def require_target_v2(self, feature: str) -> None:
+        """Reject features that read emitted bytes back through the v2 disassembler."""
+        if self.target != TARGET_V2:
+            raise ValueError(f"{feature} is only available for the {TARGET_V2} target, not {self.target}")
+
     def convert_to_machine_code(
+        self,
+        raw_lines: List[str],
+        source_name: str = "<input>",
+        **options,
+    ) -> Tuple[List[str], Dict[str, int], Dict[str, int]]:
+        """Assemble source lines into binary text lines; see assemble_lines for the options.
+
+        Every warning and error is also left in `last_diagnostics` as a structured Diagnostic,
+        including when assembly fails.
+        """
+        self.last_diagnostics = []
+        self.last_labels = {}
+        self.last_constants = {}
+        try:
+            result = self.assemble_lines(raw_lines, source_name, **options)
+        except ValueError as exc:
+            self.last_diagnostics = self.build_diagnostics(source_name, self.last_errors or [str(exc)])
+            raise
+        self.last_diagnostics = self.build_diagnostics(source_name, self.last_errors)
+        binary_lines, self.last_labels, self.last_constants = result
+        return (binary_lines, *self.exported_symbols(self.last_labels, self.last_constants))
+
+    @staticmethod
+    def exported_symbols(labels: Dict[str, int], constants: Dict[str, int]) -> Tuple[Dict[str, int], Dict[str, int]]:
+        """Drop the assembler's internal names (see INTERNAL_LABEL_RE) from a build's symbol tables."""
+        return (
+            {name: value for name, value in labels.items() if not INTERNAL_LABEL_RE.fullmatch(name)},
+            {name: value for name, value in constants.items() if not INTERNAL_CONSTANT_RE.fullmatch(name)},
+        )
+
+    def build_diagnostics(self, source_name: str, errors: List[str]) -> List[Diagnostic]:
+        # Lines the preprocessor read, then the lines laid out (which for a link come from objects).
+        columns = {**self.preprocessor.statement_columns, **self.statement_columns}
+        return collect_diagnostics(errors, self.last_warnings, source_name, columns)
+
+    def assemble_lines(
         self,
         raw_lines: List[str],
         source_name: str = "<input>",
         optimize: bool = False,
+        verify_roundtrip: bool = False,
+        check_reachability: bool = False,
+        defines: Optional[Dict[str, int]] = None,
+        suggest_optimize: bool = False,
+        partial_placeholder: Optional[int] = None,
+        fail_fast: bool = False,
+        undefined_as_zero: bool = False,
+        warn_symbol_case: bool = False,
+        strict_case: bool = False,
+        max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH,
+        max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH,
+        data_base: int = 0,
     ) -> Tuple[List[str], Dict[str, int], Dict[str, int]]:
+        """Assemble source lines into binary text lines (convert_to_machine_code adds diagnostics).
+
+        Encoding errors are collected across the whole program and raised together at the end;
+        `fail_fast` stops at the first one instead. With `partial_placeholder` set, lines that fail
+        to encode are replaced by that byte (repeated to the line's estimated size so later addresses
+        stay put), and the errors are left in `last_errors` instead of aborting the build.
+        `undefined_as_zero` assembles undefined label and constant references as 0, with a warning
+        for every reference. `warn_symbol_case` warns about label and constant names that differ
+        only in letter case; `strict_case` makes those, and references spelled differently from
+        their definition, errors. `max_include_depth` and `max_macro_depth` bound how deeply `.include`
+        and macro invocations may nest. `data_base` is the first address of the `.data` section.
+        """
+        self.begin_build()
+        constants, lines = self.prepare_source(
+            raw_lines,
+            source_name,
+            defines=defines,
+            fail_fast=fail_fast,
+            warn_symbol_case=warn_symbol_case,
+            strict_case=strict_case,
+            max_include_depth=max_include_depth,
+            max_macro_depth=max_macro_depth,
+        )
+        return self.assemble_prepared(
+            lines,
+            constants,
+            source_name=source_name,
+            optimize=optimize,
+            verify_roundtrip=verify_roundtrip,
+            check_reachability=check_reachability,
+            suggest_optimize=suggest_optimize,
+            partial_placeholder=partial_placeholder,
+            fail_fast=fail_fast,
+            undefined_as_zero=undefined_as_zero,
+            data_base=data_base,
+        )
+
+    def begin_build(self) -> None:
+        """Forget the warnings, errors, and listing of the previous build."""
         self.last_warnings = []
+        self.last_errors = []
         self.last_listing = []
-        expanded_lines = self.preprocessor.expand(raw_lines, source_name=source_name)
+        self.last_assertions = []
+        self.last_tests = []
+        self.last_undefined_references = []
+        self.last_external_references = []
+        self.parse_cache = {}
+        self.operand_cache = {}
+        self.operand_cache_constants = None
+        self.statement_columns = {}
+
+    def prepare_source(
+        self,
+        raw_lines: List[str],
+        source_name: str = "<input>",
+        defines: Optional[Dict[str, int]] = None,
+        fail_fast: bool = False,
+        warn_symbol_case: bool = False,
+        strict_case: bool = False,
+        max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH,
+        max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH,
+    ) -> Tuple[Dict[str, int], List[SourceLine]]:
+        """Run the passes that need only one source file and return (constants, lines).
+
+        This covers preprocessing, imports, local and numeric labels, register aliases, and
+        constants; an object file stores exactly this result.
+        """
+        initial_defines = {name.upper(): value for name, value in (defines or {}).items()}
+        self.preprocessor.macro_expansion_count = 0
+        self.preprocessor.statement_columns = {}
+        expanded_lines = self.preprocessor.expand(
+            raw_lines,
+            source_name=source_name,
+            defines=dict(initial_defines),
+            max_include_depth=max_include_depth,
+            max_macro_depth=max_macro_depth,
+            macros=dict(self.pseudo_instructions),
+        )
         expanded_lines = self.import_resolver.resolve_imports(expanded_lines)
         lines = self.clean_source_lines(expanded_lines)
+        lines = self.expand_location_symbols(lines)
         lines = self.rewrite_local_labels(lines)
-        constants, lines = self.extract_constants(lines)
+        lines = self.rewrite_numeric_labels(lines)
+        lines = self.apply_register_aliases(lines, fail_fast=fail_fast)
+        if strict_case:
+            case_errors = self.find_case_only_differences(lines) + self.find_case_mismatched_references(lines)
+            if case_errors:
+                self.raise_collected_errors(case_errors[:1] if fail_fast else case_errors)
+        elif warn_symbol_case:
+            self.last_warnings.extend(self.find_case_only_differences(lines))
+        return self.extract_constants(lines, fail_fast=fail_fast, predefined=initial_defines)
+
+    def assemble_prepared(
+        self,
+        lines: List[SourceLine],
+        constants: Dict[str, int],
+        source_name: str = "<input>",
+        optimize: bool = False,
+        verify_roundtrip: bool = False,
+        check_reachability: bool = False,
+        suggest_optimize: bool = False,
+        partial_placeholder: Optional[int] = None,
+        fail_fast: bool = False,
+        undefined_as_zero: bool = False,
+        data_base: int = 0,
+    ) -> Tuple[List[str], Dict[str, int], Dict[str, int]]:
+        """Lay out and encode prepared lines: weak labels, sections, label addresses, then bytes.
+
+        The linker calls this with the lines of every object file joined in link order.
+        """
+        self.undefined_as_zero = undefined_as_zero
+        for line in lines:
+            self.statement_columns.setdefault((line.source_name, line.line_number), line.column)
+        try:
+            result = self.layout_and_encode(
+                lines,
+                constants,
+                optimize=optimize,
+                verify_roundtrip=verify_roundtrip,
+                check_reachability=check_reachability,
+                suggest_optimize=suggest_optimize,
+                partial_placeholder=partial_placeholder,
+                fail_fast=fail_fast,
+                data_base=data_base,
+            )
+        finally:
+            self.undefined_as_zero = False
+            self.emitting_line = None
+            self.last_warnings = [reference.describe() for reference in self.last_undefined_references] + self.last_warnings
+        return result
 
+    def layout_and_encode(
+        self,
+        lines: List[SourceLine],
+        constants: Dict[str, int],
+        optimize: bool = False,
+        verify_roundtrip: bool = False,
+        check_reachability: bool = False,
+        suggest_optimize: bool = False,
+        partial_placeholder: Optional[int] = None,
+        fail_fast: bool = False,
+        data_base: int = 0,
+    ) -> Tuple[List[str], Dict[str, int], Dict[str, int]]:
+        # Linkage only matters to object files; see Linker.build_object.
+        lines, _, _ = self.extract_linkage(lines)
+        lines = self.extract_runtime_checks(lines)
+        lines = self.resolve_weak_labels(lines)
+        lines = self.extract_endianness(lines)
+        duplicate_errors = self.find_duplicate_labels(lines)
+        if duplicate_errors:
+            self.raise_collected_errors(duplicate_errors[:1] if fail_fast else duplicate_errors)
+        lines = self.extract_data_section(lines, constants, data_base=data_base, fail_fast=fail_fast)
+        self.defined_label_names = set(self.data_labels) | {
+            name for name in (self.split_label_prefix(line.text)[0] for line in lines) if name is not None
+        }
+
+        if optimize and partial_placeholder is not None:
+            raise ValueError("Partial builds are only supported in canonical mode")
         if optimize:
-            # Validate the canonical path first so optimize mode never hides real assembly errors.
-            self.build_labels(lines, constants)
-            binary_lines, labels, listing_rows = self.optimizer.optimize(lines, constants)
-            for source_line, address, binary_bytes in listing_rows:
-                self.last_listing.append(
-                    ListingEntry(
-                        source_name=source_line.source_name,
-                        line_number=source_line.line_number,
-                        address=address,
-                        binary_bytes=list(binary_bytes),
-                        source_text=source_line.text,
+            self.require_target_v2("Optimize mode")
+        if verify_roundtrip:
+            self.require_target_v2("Round-trip verification")
+        if check_reachability:
+            self.require_target_v2("The reachability check")
+        if suggest_optimize:
+            self.require_target_v2("Optimization suggestions")
+
+        # Lines that cannot even be sized are reported with the encoding errors, not instead of them.
+        sizing_errors: Optional[Dict[int, str]] = None if fail_fast and partial_placeholder is None else {}
+        labels = self.build_labels(lines, constants, sizing_errors)
+        # The optimizer stops at its first error and knows no line for it. When it fails, or some lines
+        # cannot be sized, the canonical pass below reports every bad line with its location instead.
+        optimize_error: Optional[ValueError] = None
+        if optimize and not sizing_errors:
+            try:
+                binary_lines, labels, listing_rows = self.optimizer.optimize(lines, constants)
+            except ValueError as e:
+                optimize_error = e
+                self.emitting_line = None
+            else:
+                for source_line, address, binary_bytes in listing_rows:
+                    self.last_listing.append(
+                        ListingEntry(
+                            source_name=source_line.source_name,
+                            line_number=source_line.line_number,
+                            address=address,
+                            binary_bytes=list(binary_bytes),
+                            source_text=source_line.text,
+                            expansion=source_line.expansion,
+                        )
                     )
-                )
-            return binary_lines, labels, constants
-
-        labels = self.build_labels(lines, constants)
+                self.apply_checksums(binary_lines, labels, constants)
+                if verify_roundtrip:
+                    self.verify_roundtrip(binary_lines)
+                if check_reachability:
+                    self.last_warnings.extend(self.reachability_checker.find_unreachable(self.last_listing, labels, constants))
+                self.resolve_runtime_checks(labels, constants)
+                self.check_entry_point(lines, labels, constants)
+                return binary_lines, labels, constants
 
         binary_lines: List[str] = []
+        canonical_sizes: Dict[int, int] = {}
         pc = 0
         for source_line in lines:
             _, instruction_text = self.split_label_prefix(source_line.text)
@@ -1147,7 +2728,19 @@ class AssemblyHelper:
 
             parsed = self.parse_source_line(source_line)
             try:
-                encoded_lines = self.emit_instruction(parsed, pc, labels, constants)
+                if sizing_errors and id(source_line) in sizing_errors:
+                    # Sized as one byte by build_labels; keep it that size so later addresses agree.
+                    self.last_errors.append(sizing_errors[id(source_line)])
+                    encoded_lines = [format((partial_placeholder or 0) & 0xFF, "08b")]
+                else:
+                    self.emitting_line = source_line
+                    try:
+                        encoded_lines = self.emit_instruction(parsed, pc, labels, constants)
+                    except Exception as e:
+                        if fail_fast and partial_placeholder is None:
+                            raise
+                        self.last_errors.append(f"Error on line {self.format_line_ref(source_line)} ('{parsed.raw_line}'): {e}")
+                        encoded_lines = self.placeholder_bytes(parsed, pc, labels, constants, partial_placeholder or 0)
                 binary_lines.extend(f"{binary}\n" for binary in encoded_lines)
                 if encoded_lines:
                     self.last_listing.append(
@@ -1157,20 +2750,98 @@ class AssemblyHelper:
                             address=pc,
                             binary_bytes=list(encoded_lines),
                             source_text=source_line.text,
+                            expansion=source_line.expansion,
                         )
                     )
+                canonical_sizes[id(source_line)] = len(encoded_lines)
                 pc += len(encoded_lines)
             except Exception as e:
                 raise ValueError(
                     f"Error on line {self.format_line_ref(source_line)} ('{parsed.raw_line}'): {e}"
                 )
-
+        self.emitting_line = None
+
+        if self.last_errors and partial_placeholder is None:
+            self.raise_collected_errors(self.last_errors)
+        if optimize_error is not None:
+            # Every line encodes on its own, so the failure is in optimized layout itself.
+            raise optimize_error
+
+        self.apply_checksums(binary_lines, labels, constants)
+        if verify_roundtrip:
+            self.verify_roundtrip(binary_lines)
+        if check_reachability:
+            self.last_warnings.extend(self.reachability_checker.find_unreachable(self.last_listing, labels, constants))
+        if suggest_optimize:
+            self.last_warnings.extend(self.optimizer.suggest_savings(lines, constants, canonical_sizes))
+        self.resolve_runtime_checks(labels, constants)
+        self.check_entry_point(lines, labels, constants)
         return binary_lines, labels, constants
 
-    def format_listing(self, mode: str = "hex") -> List[str]:
+    def placeholder_bytes(
+        self,
+        parsed: ParsedLine,
+        current_pc: int,
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        placeholder: int,
+    ) -> List[str]:
+        try:
+            size = self.estimate_instruction_size(parsed.instruction, parsed.args, current_pc, labels, constants)
+        except Exception:
+            size = 1
+        return [format(placeholder & 0xFF, "08b")] * size
+
+    def verify_roundtrip(self, binary_lines: List[str]) -> None:
+        """Disassemble emitted bytes, assemble the mnemonics again, and require identical output."""
+        original = [binary.strip() for binary in binary_lines]
+        disassembled = [self.disassemble(binary) for binary in original]
+
+        checker = AssemblyHelper(
+            comment_char=self.comment_char,
+            block_comment_start=self.block_comment_start,
+            block_comment_end=self.block_comment_end,
+            label_char=self.label_char,
+            constant_keyword=self.constant_keyword,
+            number_prefix=self.number_prefix,
+            constant_prefix=self.constant_prefix,
+            label_prefix=self.label_prefix,
+        )
+        try:
+            reassembled, _, _ = checker.convert_to_machine_code(disassembled, source_name="<roundtrip>")
+        except ValueError as exc:
+            raise ValueError(f"Round-trip verification failed: disassembly does not reassemble: {exc}") from exc
+
+        reassembled = [binary.strip() for binary in reassembled]
+        for address, (expected, actual) in enumerate(zip(original, reassembled)):
+            if expected != actual:
+                raise ValueError(
+                    f"Round-trip verification failed at 0x{address:04X}: emitted {int(expected, 2):02X} "
+                    f"disassembles to '{disassembled[address]}' which reassembles to {int(actual, 2):02X}"
+                )
+        if len(original) != len(reassembled):
+            raise ValueError(
+                f"Round-trip verification failed: {len(original)} bytes emitted but {len(reassembled)} reassembled"
+            )
+
+    def instruction_histogram(self) -> List[Tuple[str, int]]:
+        """Count source mnemonics in the last listing, most frequent first; directives are skipped."""
+        counts: Dict[str, int] = {}
+        for entry in self.last_listing:
+            _, instruction_text = self.split_label_prefix(entry.source_text)
+            instruction, _ = self.parse_instruction(instruction_text)
+            if instruction.startswith("."):
+                continue
+            counts[instruction] = counts.get(instruction, 0) + 1
+        return sorted(counts.items(), key=lambda item: (-item[1], item[0]))
+
+    def format_listing(self, mode: str = "hex", group_every: Optional[int] = None, group_separator: str = "_") -> List[str]:
+        """Render the last listing; `group_every` adds a digit-grouped binary column to the asm view."""
         mode = mode.lower()
-        if mode not in {"hex", "asm", "both"}:
-            raise ValueError("Listing mode must be one of: hex, asm, both")
+        if mode not in {"hex", "asm", "both", "bitfields"}:
+            raise ValueError("Listing mode must be one of: hex, asm, both, bitfields")
+        if mode != "hex":
+            self.require_target_v2(f"The {mode} listing mode")
 
         lines: List[str] = []
         current_source: Optional[str] = None
@@ -1182,6 +2853,9 @@ class AssemblyHelper:
                 current_source = entry.source_name
 
             source_line = f"[{entry.line_number}] {entry.source_text}"
+            symbol_values = self.listing_symbol_values(entry.source_text)
+            if symbol_values:
+                source_line = f"{source_line}  ; {', '.join(symbol_values)}"
 
             if mode in {"hex", "both"}:
                 hex_bytes = " ".join(entry.hex_bytes)
@@ -1193,20 +2867,119 @@ class AssemblyHelper:
                     lines.append(f"{entry.address:04X}  {source_line}\n")
                 for offset, binary in enumerate(entry.binary_bytes):
                     byte_addr = entry.address + offset
-                    lines.append(f"      {byte_addr:04X}  {int(binary, 2):02X}  {self.disassemble(binary)}\n")
+                    binary_column = f"{group_digits(binary, group_every, group_separator)}  " if group_every else ""
+                    lines.append(f"      {byte_addr:04X}  {int(binary, 2):02X}  {binary_column}{self.disassemble(binary)}\n")
+
+            if mode == "bitfields":
+                lines.append(f"{entry.address:04X}  {source_line}\n")
+                for offset, binary in enumerate(entry.binary_bytes):
+                    byte_addr = entry.address + offset
+                    lines.append(f"      {byte_addr:04X}  {self.format_bitfields(binary):<28}  {self.disassemble(binary)}\n")
         return lines
 
+    def listing_symbol_values(self, source_text: str) -> List[str]:
+        """Return `NAME=value` for each label or constant the line's operands reference, in order."""
+        _, instruction_text = self.split_label_prefix(source_text)
+        parts = STRING_LITERAL_RE.sub('""', instruction_text).split(None, 1)
+        if len(parts) < 2:
+            return []
+
+        values: List[str] = []
+        for match in re.finditer(r"(?<![A-Za-z0-9_])([@$]?)([A-Za-z_][A-Za-z0-9_]*)", parts[1]):
+            prefix, name = match.group(1), match.group(2).upper()
+            if prefix != "@" and name in self.last_constants:
+                value = self.last_constants[name]
+                text = f"{prefix}{name}={value}" if value < 0 else f"{prefix}{name}=0x{value:0{2 if value <= 0xFF else 4}X}"
+            elif prefix != "$" and name in self.last_labels:
+                text = f"{prefix}{name}=0x{self.last_labels[name]:04X}"
+            else:
+                continue
+            if text not in values:
+                values.append(text)
+        return values
+
+    def program_document(self, source_name: str) -> Dict[str, object]:
+        """Describe the last successful build as JSON-ready data: symbols and one entry per emitted statement.
+
+        Each statement carries its location, address, optional label, mnemonic, bytes, and operands;
+        expression operands include their expression_tree.
+        """
+        statements: List[Dict[str, object]] = []
+        for entry in self.last_listing:
+            label, instruction_text = self.split_label_prefix(entry.source_text)
+            instruction, args = self.parse_instruction(instruction_text)
+            statement: Dict[str, object] = {"file": entry.source_name, "line": entry.line_number, "address": entry.address}
+            if label is not None:
+                statement["label"] = label
+            statement["mnemonic"] = instruction
+            statement["operands"] = [self.describe_operand(arg) for arg in args]
+            statement["bytes"] = entry.hex_bytes
+            statements.append(statement)
+        labels, constants = self.exported_symbols(self.last_labels, self.last_constants)
+        return {
+            "source": source_name,
+            "labels": dict(sorted(labels.items(), key=lambda item: (item[1], item[0]))),
+            "constants": dict(sorted(constants.items())),
+            "statements": statements,
+        }
+
+    def source_map_document(self, source_name: str) -> Dict[str, object]:
+        """Map each emitted statement's address range to its source line and macro expansion stack.
+
+        `file`/`line` is where the statement appears in the program; for macro output that is the
+        outermost invocation, and `macros` lists each macro body line it came through, outermost first.
+        """
+        mappings: List[Dict[str, object]] = []
+        for entry in self.last_listing:
+            mappings.append({
+                "address": entry.address,
+                "size": len(entry.binary_bytes),
+                "file": entry.source_name,
+                "line": entry.line_number,
+                "text": entry.source_text,
+                "macros": [{"macro": macro, "file": file, "line": line} for macro, file, line in entry.expansion],
+            })
+        return {"version": 1, "source": source_name, "mappings": mappings}
+
+    def describe_operand(self, token: str) -> Dict[str, object]:
+        text = token.strip()
+        upper = text.upper()
+        if upper in DESTINATIONS or upper in SOURCES or upper == "ZERO":
+            return {"text": text, "kind": "register"}
+        if text.startswith(":"):
+            return {"text": text, "kind": "modifier"}
+        if STRING_LITERAL_RE.fullmatch(text) and text.startswith('"'):
+            return {"text": text, "kind": "string"}
+
+        operand: Dict[str, object] = {"text": text, "kind": "expression"}
+        expression = text
+        slice_match = SLICE_RE.match(text)
+        if slice_match is not None:
+            operand.update(kind="slice", hi=int(slice_match.group("hi")), lo=int(slice_match.group("lo")))
+            expression = slice_match.group("base")
+        try:
+            operand["tree"] = self.expression_tree(expression, self.last_labels, self.last_constants)
+        except ValueError:
+            pass
+        return operand
+
+    def format_bitfields(self, binary: str) -> str:
+        """Render one encoded byte as `op:10 dest:000 src:001` using the opcode table's field layout."""
+        mnemonic = self.disassemble(binary).split()[0]
+        fields = split_fields(binary, FIELD_LAYOUTS.get(mnemonic))
+        return " ".join(f"{name}:{bits}" for name, bits in fields)
+
     def disassemble(self, binary_code: str) -> str:
         binary_code = binary_code.strip()
         if len(binary_code) != 8 or any(bit not in "01" for bit in binary_code):
             raise ValueError(f"Invalid binary code: {binary_code}")
 
-        if binary_code.startswith("11"):
+        if binary_code.startswith(OPCODES["LDL"]):
             dest = "RD" if binary_code[2] == "1" else "RA"
             immediate = int(binary_code[3:], 2)
             return f"LDL {dest}, #{immediate}"
 
-        if binary_code.startswith("10"):
+        if binary_code.startswith(OPCODES["MOV"]):
             dest_bits = binary_code[2:5]
             src_bits = binary_code[5:8]
             dest = next((name for name, bits in DESTINATIONS.items() if bits == dest_bits), None)
@@ -1215,54 +2988,37 @@ class AssemblyHelper:
                 return f"??? {binary_code}"
             return f"MOV {dest}, {src}"
 
-        if binary_code == "00000000":
-            return "NOP"
-        if binary_code == "00000001":
-            return "HLT"
-        if binary_code == "00000110":
-            return "JGT"
-        if binary_code == "00000111":
-            return "JAL"
-        if binary_code.startswith("0000001"):
-            return f"INC #{int(binary_code[-1], 2) + 1}"
-        if binary_code.startswith("0000010"):
-            return f"DEC #{int(binary_code[-1], 2) + 1}"
-        if binary_code.startswith("00011"):
+        for mnemonic in ("NOP", "HLT", "JGT", "JAL"):
+            if binary_code == OPCODES[mnemonic]:
+                return mnemonic
+        for mnemonic in ("INC", "DEC"):
+            if binary_code.startswith(OPCODES[mnemonic]):
+                return f"{mnemonic} #{int(binary_code[-1], 2) + 1}"
+        if binary_code.startswith(OPCODES["JMP"]):
             cond_bits = binary_code[5:8]
             name = next((mnemonic for mnemonic, bits in JUMP_CONDITIONS.items() if bits == cond_bits), None)
             return name or f"??? {binary_code}"
-        if binary_code.startswith("00100"):
+        if binary_code.startswith(OPCODES["PUSH"]):
             src_bits = binary_code[5:8]
             src = next((name for name, bits in PUSH_SOURCES.items() if bits == src_bits), None)
             return f"PUSH {src}" if src else f"??? {binary_code}"
-        if binary_code.startswith("00101"):
+        if binary_code.startswith(OPCODES["POP"]):
             dest_bits = binary_code[5:8]
             dest = next((name for name, bits in DESTINATIONS.items() if bits == dest_bits), None)
             return f"POP {dest}" if dest else f"??? {binary_code}"
-        if binary_code.startswith("0011"):
+        if binary_code.startswith(OPCODES["LDH"]):
             dest = "RD" if binary_code[4] == "1" else "RA"
             immediate = int(binary_code[5:8], 2)
             return f"LDH {dest}, #{immediate}"
 
-        source_forms = {
-            "01000": "ADD",
-            "01010": "ADC",
-            "01011": "NOT",
-            "01100": "SUB",
-            "01110": "SBC",
-            "01111": "CMP",
-            "00001": "XOR",
-            "00010": "AND",
-        }
-        for prefix, mnemonic in source_forms.items():
-            if binary_code.startswith(prefix):
+        for mnemonic in SOURCE_OPERATIONS:
+            if binary_code.startswith(OPCODES[mnemonic]):
                 src_bits = binary_code[5:8]
                 src = next((name for name, bits in SOURCES.items() if bits == src_bits), None)
                 return f"{mnemonic} {src}" if src else f"??? {binary_code}"
 
-        if binary_code.startswith("01001"):
-            return f"ADDI #{int(binary_code[5:8], 2)}"
-        if binary_code.startswith("01101"):
-            return f"SUBI #{int(binary_code[5:8], 2)}"
+        for mnemonic in IMMEDIATE_OPERATIONS:
+            if binary_code.startswith(OPCODES[mnemonic]):
+                return f"{mnemonic} #{int(binary_code[5:8], 2)}"
 
         return f"??? {binary_code}"
@@ -0,0 +1,87 @@
+"""
+BitFields: split encoded instruction bytes into the named fields of the opcode table.
+
+Field layouts come from the `encoding` strings in config.json, for example `10 ddd sss`
+or `11 Ds0 imm5`: runs of 0/1 are opcode bits, `ddd`/`Ds0` select a destination, `sss`
+a source, `ccc` a jump condition, and `iii`, `immN`, or `x` are immediate bits. The same
+strings supply the opcode bits the encoder and disassembler use, so config.json is the one
+place an opcode is assigned.
+"""
+
+from __future__ import annotations
+
+import re
+from typing import Dict, List, Optional, Tuple
+
+
+FIELD_TOKEN_RE = re.compile(r"[01]+|imm(\d+)|Ds0|ddd|sss|ccc|i+|x+")
+OPCODE_BITS_RE = re.compile(r"[01]+")
+FIELD_NAMES = {"Ds0": "dest", "ddd": "dest", "sss": "src", "ccc": "cond"}
+
+
+def parse_field_layout(encoding: str) -> Optional[List[Tuple[str, int]]]:
+    """Return [(field_name, width), ...] for an 8-bit encoding string, or None for pseudoinstructions."""
+    compact = encoding.replace(" ", "")
+    layout: List[Tuple[str, int]] = []
+    position = 0
+    while position < len(compact):
+        match = FIELD_TOKEN_RE.match(compact, position)
+        if match is None:
+            return None
+        token = match.group(0)
+        if match.group(1):
+            layout.append(("imm", int(match.group(1))))
+        elif token[0] in "01":
+            layout.append(("op", len(token)))
+        elif token in FIELD_NAMES:
+            layout.append((FIELD_NAMES[token], 1 if token == "Ds0" else len(token)))
+        else:
+            layout.append(("imm", len(token)))
+        position = match.end()
+
+    if sum(width for _, width in layout) != 8:
+        return None
+    return layout
+
+
+def split_fields(binary: str, layout: Optional[List[Tuple[str, int]]]) -> List[Tuple[str, str]]:
+    """Cut an 8-bit binary string into (field_name, bits) pairs; unknown layouts yield one raw field."""
+    if layout is None:
+        return [("raw", binary)]
+    fields: List[Tuple[str, str]] = []
+    position = 0
+    for name, width in layout:
+        fields.append((name, binary[position:position + width]))
+        position += width
+    return fields
+
+
+def build_field_layouts(instructions: Dict[str, Dict[str, str]], jump_names: List[str]) -> Dict[str, List[Tuple[str, int]]]:
+    """Collect layouts for every real instruction; conditional jumps share one `op + cond` layout."""
+    layouts: Dict[str, List[Tuple[str, int]]] = {}
+    for name, spec in instructions.items():
+        layout = parse_field_layout(spec.get("encoding", ""))
+        if layout is not None:
+            layouts[name.upper()] = layout
+    jump_layout = parse_field_layout("00011 ccc")
+    for name in jump_names:
+        layouts[name.upper()] = jump_layout
+    return layouts
+
+
+def opcode_bits(encoding: str) -> Optional[str]:
+    """Return the fixed leading bits of an encoding (`01000` for `01000 sss`), or None for pseudoinstructions."""
+    if parse_field_layout(encoding) is None:
+        return None
+    match = OPCODE_BITS_RE.match(encoding.replace(" ", ""))
+    return match.group(0) if match else None
+
+
+def build_opcode_table(instructions: Dict[str, Dict[str, str]]) -> Dict[str, str]:
+    """Map every real instruction to its opcode bits so the encoder and disassembler share one source."""
+    opcodes: Dict[str, str] = {}
+    for name, spec in instructions.items():
+        bits = opcode_bits(spec.get("encoding", ""))
+        if bits is not None:
+            opcodes[name.upper()] = bits
+    return opcodes
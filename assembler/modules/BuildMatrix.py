@@ -0,0 +1,83 @@
+"""
+BuildMatrix: parse define-set files that describe several ROM variants of one source.
+
+Each non-empty line names an output file followed by NAME=value defines:
+
+    ; output          defines
+    rom_release.txt   DEBUG=0
+    rom_debug.txt     DEBUG=1 UART_BAUD=9600
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass, field
+from typing import Callable, Dict, List, Tuple
+
+
+DEFINE_NAME_RE = re.compile(r"^[A-Za-z_][A-Za-z0-9_]*$")
+
+
+@dataclass
+class BuildVariant:
+    output_file: str
+    defines: Dict[str, int] = field(default_factory=dict)
+    line_number: int = 0
+
+
+def parse_define(token: str, expression_evaluator: Callable[[str], int]) -> Tuple[str, int]:
+    """Split one NAME=value define into the upper-cased name and its evaluated value."""
+    name, sep, expr = token.partition("=")
+    if not sep or not expr:
+        raise ValueError(f"define must be NAME=value, got '{token}'")
+    if not DEFINE_NAME_RE.match(name):
+        raise ValueError(f"invalid define name '{name}'")
+    return name.upper(), expression_evaluator(expr)
+
+
+def parse_build_matrix(
+    lines: List[str],
+    expression_evaluator: Callable[[str], int],
+    source_name: str = "<matrix>",
+    comment_char: str = ";",
+) -> List[BuildVariant]:
+    """Parse a define-set file into build variants.
+
+    Args:
+        lines: Raw lines of the matrix file
+        expression_evaluator: Evaluates the value side of each NAME=value define
+        source_name: Matrix file name used in error messages
+        comment_char: Start of a line comment
+    """
+    variants: List[BuildVariant] = []
+    seen_outputs: Dict[str, int] = {}
+
+    for index, raw_line in enumerate(lines):
+        line_number = index + 1
+        text = raw_line.split(comment_char, 1)[0].strip()
+        if not text:
+            continue
+
+        output_file, *define_tokens = text.split()
+        if "=" in output_file:
+            raise ValueError(f"Error on line {source_name}:{line_number}: define-set must start with an output file name")
+        if output_file in seen_outputs:
+            raise ValueError(
+                f"Error on line {source_name}:{line_number}: output '{output_file}' "
+                f"already used on line {seen_outputs[output_file]}"
+            )
+        seen_outputs[output_file] = line_number
+
+        defines: Dict[str, int] = {}
+        for token in define_tokens:
+            try:
+                name, value = parse_define(token, expression_evaluator)
+            except ValueError as exc:
+                raise ValueError(f"Error on line {source_name}:{line_number}: {exc}") from exc
+            defines[name] = value
+
+        variants.append(BuildVariant(output_file=output_file, defines=defines, line_number=line_number))
+
+    if not variants:
+        raise ValueError(f"Build matrix {source_name} does not list any define-sets")
+    return variants
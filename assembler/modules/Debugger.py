@@ -0,0 +1,199 @@
+"""
+Debugger: an interactive session on top of the emulator, driven by the `debug` command.
+
+Each command line goes through `Debugger.execute`, which returns the lines to print, so the same
+session can be scripted from a file or a test. Addresses and watch expressions use the assembler's
+expression syntax with code and data labels, the registers (`RA`, `ACC`, `MARL`, ...), the 16-bit
+pairs `MAR`, `PR`, and `LR`, `PC`, `SP`, and the flags `Z`, `N`, `C`, `V`. `[expr]` reads the RAM
+byte at `expr`, so `watch [counter]` and `watch [MAR] + 1` work.
+
+The current source line comes from a source map: the last build when the program was assembled
+from source, or a `--source-map` file written alongside an image.
+"""
+
+from __future__ import annotations
+
+import json
+from typing import Collection, Dict, List, Optional
+
+from .Emulator import DEFAULT_MAX_STEPS, Emulator, read_state_file
+
+
+PROMPT = "(adbg) "
+HELP_LINES = [
+    "break|b <label|addr>   stop before the instruction at a label or address",
+    "delete|d [label|addr]  remove a breakpoint, or all of them",
+    "breaks                 list breakpoints",
+    "step|s [N]             execute N instructions (default 1)",
+    "continue|c             run until a breakpoint, HLT, or an idle loop",
+    "regs|r                 show registers, flags, PC, SP, and MAR",
+    "mem|x <addr> [count]   dump RAM (count defaults to 16)",
+    "watch|w <expr>         print an expression after every stop",
+    "unwatch <N>            remove watch number N",
+    "where|l                show the current instruction and source line",
+    "print|p <expr>         evaluate an expression once",
+    "save <path>            write a machine state snapshot",
+    "restore <path>         resume from a snapshot of this program",
+    "quit|q                 leave the debugger",
+]
+
+
+def read_source_map(path: str) -> List[Dict[str, object]]:
+    """Return the mappings of a `--source-map` file."""
+    with open(path, "r", encoding="utf-8") as f:
+        try:
+            document = json.load(f)
+        except json.JSONDecodeError as exc:
+            raise ValueError(f"{path} is not a source map: {exc.msg} at line {exc.lineno}") from exc
+    if not isinstance(document, dict) or not isinstance(document.get("mappings"), list):
+        raise ValueError(f"{path} is not a source map")
+    return document["mappings"]
+
+
+class Debugger:
+    def __init__(
+        self,
+        emulator: Emulator,
+        labels: Optional[Dict[str, int]] = None,
+        mappings: Optional[List[Dict[str, object]]] = None,
+        data_labels: Collection[str] = (),
+        max_steps: int = DEFAULT_MAX_STEPS,
+    ) -> None:
+        self.emulator = emulator
+        self.labels = {name.upper(): address for name, address in (labels or {}).items()}
+        # Data labels are RAM addresses, so only code labels name ROM locations.
+        data_names = {name.upper() for name in data_labels}
+        self.names: Dict[int, str] = {}
+        for name, address in sorted(self.labels.items(), reverse=True):
+            if name not in data_names:
+                self.names[address] = name
+        self.locations: Dict[int, Dict[str, object]] = {}
+        for mapping in mappings or []:
+            for offset in range(max(int(mapping.get("size", 1)), 1)):
+                self.locations.setdefault(int(mapping["address"]) + offset, mapping)
+        self.max_steps = max_steps
+        self.breakpoints: Dict[int, str] = {}
+        self.watches: List[str] = []
+        self.finished = False
+
+    def evaluate(self, expression: str) -> int:
+        return self.emulator.evaluate(expression, {**self.emulator.symbols, **self.labels})
+
+    def describe_address(self, address: int) -> str:
+        name = self.names.get(address)
+        return f"0x{address:04X} <{name}>" if name else f"0x{address:04X}"
+
+    def where(self) -> List[str]:
+        emulator = self.emulator
+        text = emulator.helper.disassemble(f"{emulator.rom[emulator.pc]:08b}")
+        lines = [f"{self.describe_address(emulator.pc)}  {text}"]
+        location = self.locations.get(emulator.pc)
+        if location is not None:
+            lines.append(f"  {location['file']}:{location['line']}: {str(location['text']).strip()}")
+            lines.extend(
+                f"    in macro {frame['macro']} at {frame['file']}:{frame['line']}"
+                for frame in location.get("macros", [])
+            )
+        return lines
+
+    def watch_lines(self) -> List[str]:
+        lines = []
+        for number, expression in enumerate(self.watches, start=1):
+            try:
+                value = self.evaluate(expression)
+                lines.append(f"  watch {number}: {expression} = {value} (0x{value & 0xFFFF:02X})")
+            except ValueError as exc:
+                lines.append(f"  watch {number}: {expression} = <error: {exc}>")
+        return lines
+
+    def stop_lines(self, reason: str) -> List[str]:
+        return [f"Stopped: {reason}"] + self.where() + self.watch_lines()
+
+    def execute(self, line: str) -> List[str]:
+        command, _, argument = line.strip().partition(" ")
+        command, argument = command.lower(), argument.strip()
+        try:
+            return self.dispatch(command, argument)
+        except ValueError as exc:
+            return [f"Error: {exc}"]
+
+    def dispatch(self, command: str, argument: str) -> List[str]:
+        emulator = self.emulator
+        if not command:
+            return []
+        if command in {"help", "h", "?"}:
+            return list(HELP_LINES)
+        if command in {"quit", "q", "exit"}:
+            self.finished = True
+            return []
+        if command in {"break", "b"}:
+            address = self.evaluate(self.require(argument, "break")) & 0xFFFF
+            self.breakpoints[address] = argument
+            return [f"Breakpoint at {self.describe_address(address)}"]
+        if command in {"delete", "d"}:
+            if not argument:
+                self.breakpoints.clear()
+                return ["Deleted all breakpoints"]
+            address = self.evaluate(argument) & 0xFFFF
+            if self.breakpoints.pop(address, None) is None:
+                raise ValueError(f"No breakpoint at 0x{address:04X}")
+            return [f"Deleted breakpoint at {self.describe_address(address)}"]
+        if command == "breaks":
+            if not self.breakpoints:
+                return ["No breakpoints"]
+            return [f"  {self.describe_address(address)}" for address in sorted(self.breakpoints)]
+        if command in {"step", "s"}:
+            count = self.evaluate(argument) if argument else 1
+            if count < 1:
+                raise ValueError("step requires a positive count")
+            for _ in range(count):
+                if emulator.halted:
+                    break
+                emulator.step()
+            reason = f"HLT at 0x{emulator.pc:04X}" if emulator.halted else f"step at 0x{emulator.pc:04X}"
+            return self.stop_lines(reason)
+        if command in {"continue", "c"}:
+            if emulator.halted:
+                return self.stop_lines(f"HLT at 0x{emulator.pc:04X}")
+            result = emulator.run(self.max_steps, self.breakpoints)
+            return self.stop_lines(f"{result.reason} after {result.steps} steps")
+        if command in {"regs", "r"}:
+            return emulator.format_state()
+        if command in {"mem", "x"}:
+            start_text, _, count_text = argument.partition(" ")
+            start = self.evaluate(self.require(start_text, "mem")) & 0xFFFF
+            count = self.evaluate(count_text) if count_text.strip() else 16
+            if count < 1:
+                raise ValueError("mem requires a positive count")
+            return emulator.format_ram(start, count)
+        if command in {"watch", "w"}:
+            self.evaluate(self.require(argument, "watch"))
+            self.watches.append(argument)
+            return [f"Watch {len(self.watches)}: {argument}"] + self.watch_lines()[-1:]
+        if command == "unwatch":
+            number = self.evaluate(self.require(argument, "unwatch"))
+            if not 1 <= number <= len(self.watches):
+                raise ValueError(f"No watch number {number}")
+            return [f"Removed watch {number}: {self.watches.pop(number - 1)}"]
+        if command in {"where", "l"}:
+            return self.where()
+        if command == "save":
+            with open(self.require(argument, "save"), "w", encoding="utf-8") as f:
+                json.dump(emulator.save_state(), f)
+            return [f"Saved state to {argument}"]
+        if command == "restore":
+            try:
+                emulator.restore_state(read_state_file(self.require(argument, "restore")))
+            except FileNotFoundError:
+                raise ValueError(f"Snapshot file '{argument}' not found")
+            return [f"Restored state from {argument}"] + self.where()
+        if command in {"print", "p"}:
+            value = self.evaluate(self.require(argument, "print"))
+            return [f"{argument} = {value} (0x{value & 0xFFFF:02X})"]
+        raise ValueError(f"Unknown command '{command}'; type 'help' for a list")
+
+    @staticmethod
+    def require(argument: str, command: str) -> str:
+        if not argument:
+            raise ValueError(f"{command} requires an argument")
+        return argument
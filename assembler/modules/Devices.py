@@ -0,0 +1,148 @@
+"""
+Devices: models of the SoC peripherals for the emulator, after verilog/rtl/peripherals.
+
+    emulator.attach(UartDevice(b"hi"), 0x0900, 0x09FF)
+
+Each device sees the offset within its range, as the RTL peripherals see `mem_addr[7:0]`. The
+models keep the register behaviour programs depend on and drop the timing: the UART transmits a
+byte as soon as it is written and receives from a fixed input buffer.
+"""
+
+from __future__ import annotations
+
+from typing import Callable, Dict, List, Tuple
+
+from .Emulator import Device
+
+
+# uart_peripheral.sv register offsets and status/control bits.
+UART_RX_DATA = 0x00
+UART_RX_VALID = 0x01
+UART_TX_DATA = 0x10
+UART_TX_READY = 0x11
+UART_TX_EMPTY = 0x13
+UART_BAUD_SEL = 0x20
+UART_STATUS = 0x30
+UART_CONTROL = 0x40
+UART_EN = 0x41
+UART_RX_EN = 0x42
+UART_TX_EN = 0x43
+UART_CLEAR_RX = 0x44
+STATUS_RX_VALID, STATUS_TX_READY, STATUS_TX_EMPTY = 0x01, 0x08, 0x20
+CONTROL_UART_EN, CONTROL_RX_EN, CONTROL_TX_EN = 0x01, 0x02, 0x04
+ENABLE_BITS = {UART_EN: CONTROL_UART_EN, UART_RX_EN: CONTROL_RX_EN, UART_TX_EN: CONTROL_TX_EN}
+
+
+class UartDevice(Device):
+    """The SoC UART: bytes written to TX_DATA collect in `output`, RX_DATA reads from `input`."""
+
+    name = "uart"
+
+    def __init__(self, input_bytes: bytes = b"") -> None:
+        self.input = bytearray(input_bytes)
+        self.output = bytearray()
+        self.control = 0
+        self.baud_select = 0
+
+    def enabled(self, bit: int) -> bool:
+        return bool(self.control & CONTROL_UART_EN) and bool(self.control & bit)
+
+    def status(self) -> int:
+        status = 0
+        if self.enabled(CONTROL_RX_EN) and self.input:
+            status |= STATUS_RX_VALID
+        if self.enabled(CONTROL_TX_EN):
+            status |= STATUS_TX_READY | STATUS_TX_EMPTY
+        return status
+
+    def read(self, offset: int) -> int:
+        status = self.status()
+        if offset == UART_RX_DATA:
+            return self.input.pop(0) if status & STATUS_RX_VALID else 0
+        if offset == UART_RX_VALID:
+            return int(bool(status & STATUS_RX_VALID))
+        if offset == UART_TX_READY:
+            return int(bool(status & STATUS_TX_READY))
+        if offset == UART_TX_EMPTY:
+            return int(bool(status & STATUS_TX_EMPTY))
+        if offset == UART_BAUD_SEL:
+            return self.baud_select
+        if offset == UART_STATUS:
+            return status
+        if offset == UART_CONTROL:
+            return self.control
+        bit = ENABLE_BITS.get(offset)
+        return int(bool(self.control & bit)) if bit else 0
+
+    def write(self, offset: int, value: int) -> None:
+        if offset == UART_TX_DATA:
+            if self.enabled(CONTROL_TX_EN):
+                self.output.append(value)
+        elif offset == UART_BAUD_SEL:
+            self.baud_select = value & 0x07
+        elif offset == UART_CONTROL:
+            self.control = value
+        elif offset in ENABLE_BITS:
+            bit = ENABLE_BITS[offset]
+            self.control = (self.control | bit) if value & 1 else (self.control & ~bit)
+        elif offset == UART_CLEAR_RX and value & 1:
+            self.input.clear()
+
+    def report(self) -> List[str]:
+        return [f"UART output ({len(self.output)} bytes): {self.output.decode('latin-1')!r}"]
+
+    def save_state(self) -> Dict[str, object]:
+        return {"input": self.input.hex(), "output": self.output.hex(), "control": self.control, "baud_select": self.baud_select}
+
+    def restore_state(self, state: Dict[str, object]) -> None:
+        self.input, self.output = bytearray.fromhex(state["input"]), bytearray.fromhex(state["output"])
+        self.control, self.baud_select = state["control"], state["baud_select"]
+
+
+class LedDevice(Device):
+    """The system LED register at offset 0 of the SYS block; `history` holds every value written."""
+
+    name = "led"
+
+    def __init__(self) -> None:
+        self.value = 0
+        self.history: List[int] = []
+
+    def read(self, offset: int) -> int:
+        return self.value if offset == 0 else 0
+
+    def write(self, offset: int, value: int) -> None:
+        if offset == 0:
+            self.value = value
+            self.history.append(value)
+
+    def report(self) -> List[str]:
+        return [f"LED: 0x{self.value:02X} ({len(self.history)} writes)"]
+
+    def save_state(self) -> Dict[str, object]:
+        return {"value": self.value, "history": list(self.history)}
+
+    def restore_state(self, state: Dict[str, object]) -> None:
+        self.value, self.history = state["value"], list(state["history"])
+
+
+# Name -> (factory, default range) for `run --device NAME[@ADDR]`, at the SoC memory map addresses.
+DEVICE_TYPES: Dict[str, Tuple[Callable[[], Device], int, int]] = {
+    "uart": (UartDevice, 0x0900, 0x09FF),
+    "led": (LedDevice, 0x0C00, 0x0CFF),
+}
+
+
+def parse_device_spec(spec: str) -> Tuple[str, int, int]:
+    """Parse `NAME[@START[-END]]` into a device name and inclusive range."""
+    name, _, where = spec.partition("@")
+    name = name.lower()
+    if name not in DEVICE_TYPES:
+        raise ValueError(f"Unknown device '{name}'; expected one of: {', '.join(sorted(DEVICE_TYPES))}")
+    _, start, end = DEVICE_TYPES[name]
+    if where:
+        start_text, _, end_text = where.partition("-")
+        size = end - start
+        start = int(start_text, 0)
+        end = int(end_text, 0) if end_text else start + size
+    return name, start, end
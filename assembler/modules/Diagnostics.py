@@ -0,0 +1,75 @@
+"""
+Diagnostics: structured records for the assembler's warning and error messages.
+
+Messages keep their existing text; these records add the severity, file, line, and column that
+editor integrations need. The column is 1-based and points at the start of the statement in the
+original source line (after indentation), as the assembler recorded it while reading the source;
+it is 1 for lines it has no record of.
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple
+
+
+ERROR_RE = re.compile(r"^Error (?:on line|in) (?P<file>.+?):(?P<line>\d+) \('(?P<text>.*?)'\): (?P<message>.*)$", re.DOTALL)
+RANGE_RE = re.compile(r"^Line (?P<file>.+?):(?P<line>\d+)(?:-\d+)?: (?P<message>.*)$", re.DOTALL)
+BARE_LINE_RE = re.compile(r"^Line (?P<line>\d+) \('(?P<text>.*?)'\): (?P<message>.*)$", re.DOTALL)
+FILE_ONLY_RE = re.compile(r"^Error in (?P<file>.+?): (?P<message>.*)$", re.DOTALL)
+
+
+@dataclass(frozen=True)
+class Diagnostic:
+    severity: str
+    file: str
+    line: int
+    column: int
+    message: str
+
+    def __str__(self) -> str:
+        location = f"{self.file}:{self.line}:{self.column}" if self.line else self.file
+        return f"{location}: {self.severity}: {self.message}"
+
+
+def parse_diagnostic(
+    text: str,
+    severity: str,
+    default_file: str,
+    columns: Optional[Dict[Tuple[str, int], int]] = None,
+) -> Diagnostic:
+    """Split one formatted warning or error into a Diagnostic.
+
+    Args:
+        text: Message as stored in last_warnings / last_errors or raised
+        severity: "error" or "warning"
+        default_file: File used for messages that only carry a line number
+        columns: Statement column of each (file, line) the assembler read
+    """
+    match = ERROR_RE.match(text)
+    if match is not None:
+        file, line, message = match["file"], int(match["line"]), match["message"]
+    elif (match := RANGE_RE.match(text)) is not None:
+        file, line, message = match["file"], int(match["line"]), match["message"]
+    elif (match := BARE_LINE_RE.match(text)) is not None:
+        file, line, message = default_file, int(match["line"]), match["message"]
+    elif (match := FILE_ONLY_RE.match(text)) is not None:
+        file, line, message = match["file"], 0, match["message"]
+    else:
+        file, line, message = default_file, 0, text
+
+    column = (columns or {}).get((file, line), 1) if line else 0
+    return Diagnostic(severity=severity, file=file, line=line, column=column, message=message)
+
+
+def collect_diagnostics(
+    errors: List[str],
+    warnings: List[str],
+    default_file: str,
+    columns: Optional[Dict[Tuple[str, int], int]] = None,
+) -> List[Diagnostic]:
+    """Errors first, then warnings, each in the order the assembler reported them."""
+    diagnostics = [parse_diagnostic(error, "error", default_file, columns) for error in errors]
+    diagnostics.extend(parse_diagnostic(warning, "warning", default_file, columns) for warning in warnings)
+    return diagnostics
@@ -0,0 +1,181 @@
+"""
+Disassembler: turn a ROM image back into readable ArniComp assembly.
+
+Images are read as Intel HEX (a file starting with ':'), binary text (one 8-bit `0`/`1` line per
+byte, as `assemble` writes), or raw bytes such as a `createbin` image or an EEPROM dump. Each byte
+is printed with its address and hex value. With a symbol file from `--symbols`, labels are printed
+at their addresses and jump targets are named.
+
+A jump goes through `PRH:PRL`, so the target is recovered by following the `LDL`/`LDH` loads into
+`RA`/`RD` and the `MOV PRL`/`MOV PRH` copies that precede it. Anything else that may write those
+registers forgets their value, and so does every label, since control can arrive there from elsewhere.
+"""
+
+from __future__ import annotations
+
+import json
+import re
+from typing import Dict, List, Optional, TYPE_CHECKING
+
+
+if TYPE_CHECKING:
+    from .AssemblyHelper import AssemblyHelper
+
+
+BINARY_TEXT_RE = re.compile(r"^[01]{8}$")
+SYMBOL_LINE_RE = re.compile(r"^(?P<address>[0-9A-Fa-f]{1,4})\s+(?P<name>[A-Za-z_.][A-Za-z0-9_.]*)$")
+JUMP_MNEMONICS = {"JMP", "JAL", "JEQ", "JNE", "JCS", "JCC", "JMI", "JVS", "JLT", "JGT"}
+DEFAULT_MIN_RUN = 16
+
+
+def parse_intel_hex(text: str, source_name: str = "<image>") -> Dict[int, int]:
+    """Read data records (00) with extended segment (02) and linear (04) addresses until EOF (01)."""
+    image: Dict[int, int] = {}
+    base = 0
+    for line_number, line in enumerate(text.splitlines(), start=1):
+        line = line.strip()
+        if not line:
+            continue
+        where = f"{source_name}:{line_number}"
+        if not line.startswith(":"):
+            raise ValueError(f"Intel HEX record on line {where} does not start with ':'")
+        try:
+            record = bytes.fromhex(line[1:])
+        except ValueError as exc:
+            raise ValueError(f"Intel HEX record on line {where} is not hex") from exc
+        if len(record) < 5 or len(record) != record[0] + 5:
+            raise ValueError(f"Intel HEX record on line {where} has the wrong length")
+        if sum(record) & 0xFF:
+            raise ValueError(f"Intel HEX record on line {where} has a bad checksum")
+        address, record_type, data = (record[1] << 8) | record[2], record[3], record[4:-1]
+        if record_type == 0x00:
+            for offset, value in enumerate(data):
+                image[base + address + offset] = value
+        elif record_type == 0x01:
+            break
+        elif record_type == 0x02:
+            base = ((data[0] << 8) | data[1]) << 4
+        elif record_type == 0x04:
+            base = ((data[0] << 8) | data[1]) << 16
+    return image
+
+
+def read_image(path: str) -> Dict[int, int]:
+    """Return address -> byte for an Intel HEX, binary text, or raw image file."""
+    with open(path, "rb") as f:
+        data = f.read()
+    try:
+        text = data.decode("ascii")
+    except UnicodeDecodeError:
+        text = None
+    if text is not None and text.lstrip().startswith(":"):
+        return parse_intel_hex(text, path)
+    if text is not None:
+        lines = [line.strip() for line in text.splitlines() if line.strip()]
+        if lines and all(BINARY_TEXT_RE.match(line) for line in lines):
+            return {address: int(line, 2) for address, line in enumerate(lines)}
+    return dict(enumerate(data))
+
+
+def read_symbol_file(path: str) -> Dict[int, List[str]]:
+    """Read code labels from a `--symbols` file, text (`ADDRESS NAME`) or JSON; `.data` labels are skipped."""
+    with open(path, "r", encoding="utf-8") as f:
+        text = f.read()
+    symbols: Dict[int, List[str]] = {}
+    if text.lstrip().startswith("{"):
+        for entry in json.loads(text).get("symbols", []):
+            if entry.get("section", ".text") == ".text":
+                symbols.setdefault(int(entry["address"]), []).append(str(entry["name"]))
+        return symbols
+    for line_number, line in enumerate(text.splitlines(), start=1):
+        line = line.strip()
+        if not line or line.startswith(";") or line.startswith("#"):
+            continue
+        match = SYMBOL_LINE_RE.match(line)
+        if match is None:
+            raise ValueError(f"Invalid symbol on line {path}:{line_number}: expected 'ADDRESS NAME', got '{line}'")
+        symbols.setdefault(int(match.group("address"), 16), []).append(match.group("name"))
+    return symbols
+
+
+class JumpTargetTracker:
+    """Follow the constant values loaded into RA, RD, PRL, and PRH between labels."""
+
+    def __init__(self) -> None:
+        self.registers: Dict[str, Optional[int]] = {}
+
+    def forget(self) -> None:
+        self.registers = {}
+
+    def target(self) -> Optional[int]:
+        low, high = self.registers.get("PRL"), self.registers.get("PRH")
+        return None if low is None or high is None else (high << 8) | low
+
+    def step(self, text: str) -> None:
+        mnemonic, _, operand_text = text.partition(" ")
+        operands = [operand.strip() for operand in operand_text.split(",")] if operand_text else []
+        if mnemonic == "LDL":
+            self.registers[operands[0]] = int(operands[1].lstrip("#"))
+        elif mnemonic == "LDH":
+            low = self.registers.get(operands[0])
+            self.registers[operands[0]] = None if low is None else (low & 0x1F) | (int(operands[1].lstrip("#")) << 5)
+        elif mnemonic == "MOV":
+            self.registers[operands[0]] = self.registers.get(operands[1]) if operands[1] in {"RA", "RD"} else None
+        elif mnemonic not in JUMP_MNEMONICS and mnemonic not in {"NOP", "PUSH"}:
+            # ALU results, POP, and anything unrecognized may change RA or RD.
+            self.registers.pop("RA", None)
+            self.registers.pop("RD", None)
+
+
+def disassemble_image(
+    helper: "AssemblyHelper",
+    image: Dict[int, int],
+    symbols: Optional[Dict[int, List[str]]] = None,
+    min_run: int = DEFAULT_MIN_RUN,
+) -> List[str]:
+    """Render `image` as assembly lines: `ADDR  HH  MNEMONIC`, with labels and named jump targets.
+
+    Runs of at least `min_run` identical bytes that no label falls inside print as one `.fill`.
+    """
+    symbols = symbols or {}
+    lines: List[str] = []
+    tracker = JumpTargetTracker()
+    addresses = sorted(image)
+    index = 0
+    while index < len(addresses):
+        address = addresses[index]
+        if index and addresses[index - 1] != address - 1:
+            lines.append("\n")
+        if (index == 0 and address != 0) or (index and addresses[index - 1] != address - 1):
+            lines.append(f".org 0x{address:04X}\n")
+            tracker.forget()
+        if address in symbols:
+            tracker.forget()
+            lines.extend(f"{name}:\n" for name in symbols[address])
+
+        value = image[address]
+        run = 1
+        while (
+            index + run < len(addresses)
+            and addresses[index + run] == address + run
+            and image[address + run] == value
+            and address + run not in symbols
+        ):
+            run += 1
+        if run >= min_run:
+            lines.append(f"{address:04X}  {value:02X}  .fill {run}, #0x{value:02X}\n")
+            tracker.forget()
+            index += run
+            continue
+
+        text = helper.disassemble(f"{value:08b}")
+        comment = ""
+        if text.split(" ", 1)[0] in JUMP_MNEMONICS:
+            target = tracker.target()
+            if target is not None:
+                names = symbols.get(target)
+                comment = f"  ; -> {names[0]}" if names else f"  ; -> 0x{target:04X}"
+        tracker.step(text)
+        lines.append(f"{address:04X}  {value:02X}  {text}{comment}\n")
+        index += 1
+    return lines
@@ -0,0 +1,511 @@
+"""
+Emulator: run an arnicomp-v2 ROM image in software and report the final machine state.
+
+Instructions are decoded by the built-in disassembler, so the emulator reads the same
+config/config.json opcode table as the encoder. Execution follows the RTL in verilog/rtl:
+
+- the ALU computes `RD op source` into ACC and sets Z, N, C, and V on every ALU instruction;
+  CMP sets flags without writing ACC, and C after SUB/SBC/CMP is "no borrow"
+- `LDL` loads a 5-bit value; `LDH` replaces bits 7..5 and keeps the low five
+- jumps go to `PRH:PRL`; `JAL` also sets `LRH:LRL` to the address after it
+- `PUSH` writes RAM at SP and increments SP; `POP` decrements SP and then reads
+- `INC`/`DEC` step the 16-bit `MARH:MARL` address; `M` is RAM at that address
+
+Every instruction costs the `cycles` given for it in config/config.json; a jump that is taken costs
+its `taken_cycles` instead, since the core flushes the instruction fetched behind it with a NOP
+bubble (verilog/rtl/top/arnicomp_top.sv). Cycles are also counted per instruction address so a run
+can report where its time went.
+
+With a `tracer` set, every executed instruction is passed to it as a record of its PC, opcode,
+decoded text, cost, the registers, flags, and SP it changed (`name: [old, new]`), and its data
+writes; `format_trace_record` renders one as a log line.
+
+`save_state` captures everything a run changes (registers, flags, SP, PC, RAM, cycle counts, and
+each device's state) as JSON-ready data, and `restore_state` resumes from it. ROM is not saved; the
+snapshot records its CRC-32 and only restores onto the same program.
+
+`.assert` directives of the build, set in `assertions` by address, are evaluated before the
+instruction at their address executes; a false one stops the run with the reason and the values of
+the registers and flags it names. `evaluate` reads the same expressions as the debugger: labels and
+constants from `symbols`, the registers, `MAR`, `PR`, `LR`, `PC`, `SP`, the flags, and `[expr]`
+for a RAM byte.
+
+Program ROM and data RAM are separate 64 KiB spaces, and RAM starts zeroed. Devices attached to an
+address range take every data access there (`M`, `PUSH`, and `POP`) in place of RAM, so peripherals
+such as the UART in modules/Devices.py can be modeled. A run stops at `HLT`,
+at the step limit, or at an idle loop: a jump to a target with every register and flag unchanged,
+and no RAM written, since the previous time it was taken, such as `end: JMP end`.
+"""
+
+from __future__ import annotations
+
+import base64
+import bisect
+import json
+import zlib
+from dataclasses import dataclass, field
+from typing import Callable, Collection, Dict, List, Optional, Tuple, TYPE_CHECKING
+
+from .AssemblyHelper import IDENTIFIER_RE, JUMP_CONDITIONS, RUNTIME_SYMBOLS, RuntimeAssertion, config
+
+
+if TYPE_CHECKING:
+    from .AssemblyHelper import AssemblyHelper
+
+
+STATE_FORMAT = "arnicomp-emulator-state"
+STATE_VERSION = 1
+DEFAULT_MAX_STEPS = 1_000_000
+# The SoC top level (verilog/rtl/top/arnicomp_soc_top.sv) resets SP to 0x0D00.
+DEFAULT_STACK_BASE = 0x0D00
+REGISTER_NAMES = ("RA", "RD", "RB", "ACC", "MARL", "MARH", "PRL", "PRH", "LRL", "LRH")
+JUMPS = set(JUMP_CONDITIONS) | {"JGT", "JAL"}
+FLAG_NAMES = ("Z", "N", "C", "V")
+# Mnemonic -> (cycles, cycles when a jump is taken); pseudo-instructions have no entry.
+CYCLE_COSTS: Dict[str, Tuple[int, int]] = {
+    name.upper(): (int(spec["cycles"]), int(spec.get("taken_cycles", spec["cycles"])))
+    for name, spec in config["instructions"].items()
+    if "cycles" in spec
+}
+
+
+@dataclass
+class Flags:
+    zero: bool = False
+    negative: bool = False
+    carry: bool = False
+    overflow: bool = False
+
+    def __str__(self) -> str:
+        return " ".join(f"{name}={int(value)}" for name, value in (
+            ("Z", self.zero), ("N", self.negative), ("C", self.carry), ("V", self.overflow)
+        ))
+
+
+class Device:
+    """A memory-mapped peripheral; `offset` is the address relative to the start of its range."""
+
+    # Saved in snapshots so a resumed run can recreate the device, e.g. "uart" for `--device uart`.
+    name = "device"
+
+    def read(self, offset: int) -> int:
+        return 0
+
+    def write(self, offset: int, value: int) -> None:
+        pass
+
+    def report(self) -> List[str]:
+        """Lines describing the device state, printed after a `run`."""
+        return []
+
+    def save_state(self) -> Dict[str, object]:
+        return {}
+
+    def restore_state(self, state: Dict[str, object]) -> None:
+        pass
+
+
+@dataclass
+class RunResult:
+    steps: int
+    reason: str
+    pc: int
+
+
+@dataclass
+class Emulator:
+    """An arnicomp-v2 CPU with its ROM, RAM, registers, flags, and stack pointer."""
+
+    helper: "AssemblyHelper"
+    rom: bytearray = field(default_factory=lambda: bytearray(0x10000))
+    ram: bytearray = field(default_factory=lambda: bytearray(0x10000))
+    registers: Dict[str, int] = field(default_factory=lambda: {name: 0 for name in REGISTER_NAMES})
+    flags: Flags = field(default_factory=Flags)
+    pc: int = 0
+    sp: int = DEFAULT_STACK_BASE
+    halted: bool = False
+    ram_writes: int = 0
+    decode_table: List[Tuple[str, List[str]]] = field(default_factory=list)
+    devices: List[Tuple[int, int, Device]] = field(default_factory=list)
+    cycles: int = 0
+    steps: int = 0
+    tracer: Optional[Callable[[Dict[str, object]], None]] = None
+    step_writes: List[Tuple[int, int]] = field(default_factory=list)
+    address_cycles: Dict[int, int] = field(default_factory=dict)
+    address_steps: Dict[int, int] = field(default_factory=dict)
+    assertions: Dict[int, List[RuntimeAssertion]] = field(default_factory=dict)
+    symbols: Dict[str, int] = field(default_factory=dict)
+    failed_assertion: Optional[RuntimeAssertion] = None
+
+    def __post_init__(self) -> None:
+        if not self.decode_table:
+            for value in range(256):
+                mnemonic, _, operand_text = self.helper.disassemble(f"{value:08b}").partition(" ")
+                operands = [operand.strip() for operand in operand_text.split(",")] if operand_text else []
+                self.decode_table.append((mnemonic, operands))
+
+    def load(self, image: Dict[int, int]) -> None:
+        for address, value in image.items():
+            self.rom[address & 0xFFFF] = value
+
+    def attach(self, device: Device, start: int, end: int) -> None:
+        """Map `device` at RAM addresses `start`..`end` inclusive."""
+        if not 0 <= start <= end <= 0xFFFF:
+            raise ValueError(f"Invalid device range 0x{start:04X}-0x{end:04X}")
+        for other_start, other_end, other in self.devices:
+            if start <= other_end and other_start <= end:
+                raise ValueError(
+                    f"Device range 0x{start:04X}-0x{end:04X} overlaps {type(other).__name__} "
+                    f"at 0x{other_start:04X}-0x{other_end:04X}"
+                )
+        self.devices.append((start, end, device))
+
+    def find_device(self, address: int) -> Optional[Tuple[int, Device]]:
+        for start, end, device in self.devices:
+            if start <= address <= end:
+                return start, device
+        return None
+
+    @property
+    def mar(self) -> int:
+        return (self.registers["MARH"] << 8) | self.registers["MARL"]
+
+    def set_mar(self, value: int) -> None:
+        self.registers["MARL"], self.registers["MARH"] = value & 0xFF, (value >> 8) & 0xFF
+
+    def read_source(self, name: str) -> int:
+        if name == "ZERO":
+            return 0
+        if name == "M":
+            return self.read_ram(self.mar)
+        return self.registers[name]
+
+    def write_destination(self, name: str, value: int) -> None:
+        if name == "M":
+            self.write_ram(self.mar, value)
+        else:
+            self.registers[name] = value & 0xFF
+
+    def read_ram(self, address: int) -> int:
+        address &= 0xFFFF
+        mapped = self.find_device(address)
+        if mapped is not None:
+            start, device = mapped
+            return device.read(address - start) & 0xFF
+        return self.ram[address]
+
+    def write_ram(self, address: int, value: int) -> None:
+        address &= 0xFFFF
+        mapped = self.find_device(address)
+        if mapped is not None:
+            start, device = mapped
+            device.write(address - start, value & 0xFF)
+        else:
+            self.ram[address] = value & 0xFF
+        self.ram_writes += 1
+        self.step_writes.append((address, value & 0xFF))
+
+    def alu(self, operation: str, operand: int) -> int:
+        """Compute `RD operation operand` and set the flags like verilog/rtl/blocks/alu.sv."""
+        a = self.registers["RD"]
+        carry = overflow = False
+        if operation in {"ADD", "ADDI", "ADC"}:
+            carry_in = int(self.flags.carry) if operation == "ADC" else 0
+            total = a + operand + carry_in
+            result = total & 0xFF
+            carry = total > 0xFF
+            addend = (operand + carry_in) & 0xFF
+            overflow = not ((a ^ addend) & 0x80) and bool((a ^ result) & 0x80)
+        elif operation in {"SUB", "SUBI", "SBC", "CMP"}:
+            borrow_in = 0 if operation != "SBC" else 1 - int(self.flags.carry)
+            difference = a - operand - borrow_in
+            result = difference & 0xFF
+            carry = difference >= 0
+            subtrahend = (operand + borrow_in) & 0xFF
+            overflow = bool((a ^ subtrahend) & 0x80) and bool((a ^ result) & 0x80)
+        elif operation == "AND":
+            result = a & operand
+        elif operation == "XOR":
+            result = a ^ operand
+        else:
+            result = ~operand & 0xFF
+        self.flags = Flags(zero=result == 0, negative=bool(result & 0x80), carry=carry, overflow=overflow)
+        return result
+
+    def jump_taken(self, mnemonic: str) -> bool:
+        flags = self.flags
+        return {
+            "JMP": True,
+            "JAL": True,
+            "JEQ": flags.zero,
+            "JNE": not flags.zero,
+            "JCS": flags.carry,
+            "JCC": not flags.carry,
+            "JMI": flags.negative,
+            "JVS": flags.overflow,
+            "JLT": flags.negative != flags.overflow,
+            "JGT": not flags.zero and flags.negative == flags.overflow,
+        }[mnemonic]
+
+    def flag_values(self) -> Dict[str, int]:
+        flags = (self.flags.zero, self.flags.negative, self.flags.carry, self.flags.overflow)
+        return dict(zip(FLAG_NAMES, map(int, flags)))
+
+    def add_assertions(self, assertions: Collection[RuntimeAssertion]) -> None:
+        for assertion in assertions:
+            self.assertions.setdefault(assertion.address, []).append(assertion)
+
+    def machine_variables(self) -> Dict[str, int]:
+        registers = self.registers
+        return {
+            **registers,
+            "PC": self.pc,
+            "SP": self.sp,
+            "MAR": self.mar,
+            "PR": (registers["PRH"] << 8) | registers["PRL"],
+            "LR": (registers["LRH"] << 8) | registers["LRL"],
+            **self.flag_values(),
+        }
+
+    def evaluate(self, expression: str, symbols: Optional[Dict[str, int]] = None) -> int:
+        variables = {**(self.symbols if symbols is None else symbols), **self.machine_variables()}
+        return self.helper.evaluate_runtime_expression(expression, variables, lambda address: self.ram[address])
+
+    def check_assertions(self) -> Optional[str]:
+        """Return why an assertion at PC fails, naming the state it reads, or None if all hold."""
+        for assertion in self.assertions.get(self.pc, []):
+            try:
+                holds = bool(self.evaluate(assertion.expression))
+            except ValueError as exc:
+                holds, detail = False, f"error: {exc}"
+            else:
+                variables = self.machine_variables()
+                names = dict.fromkeys(
+                    name.upper() for name in IDENTIFIER_RE.findall(assertion.expression) if name.upper() in RUNTIME_SYMBOLS
+                )
+                detail = ", ".join(f"{name}=0x{variables[name]:02X}" for name in names)
+            if not holds:
+                self.failed_assertion = assertion
+                reason = f"assertion failed at 0x{self.pc:04X}: {assertion.describe()}"
+                return f"{reason} [{detail}]" if detail else reason
+        return None
+
+    def traced_state(self) -> Dict[str, int]:
+        return {**self.registers, "SP": self.sp, **self.flag_values()}
+
+    def step(self) -> None:
+        address = self.pc
+        mnemonic, operands = self.decode_table[self.rom[address]]
+        before = self.traced_state() if self.tracer is not None else {}
+        self.step_writes = []
+        self.pc = (address + 1) & 0xFFFF
+
+        if mnemonic == "HLT":
+            self.pc = address
+            self.halted = True
+        elif mnemonic == "LDL":
+            self.registers[operands[0]] = int(operands[1].lstrip("#"))
+        elif mnemonic == "LDH":
+            low = self.registers[operands[0]] & 0x1F
+            self.registers[operands[0]] = (int(operands[1].lstrip("#")) << 5) | low
+        elif mnemonic == "MOV":
+            self.write_destination(operands[0], self.read_source(operands[1]))
+        elif mnemonic in {"ADDI", "SUBI"}:
+            self.registers["ACC"] = self.alu(mnemonic, int(operands[0].lstrip("#")))
+        elif mnemonic == "CMP":
+            self.alu(mnemonic, self.read_source(operands[0]))
+        elif mnemonic in {"ADD", "ADC", "SUB", "SBC", "AND", "XOR", "NOT"}:
+            self.registers["ACC"] = self.alu(mnemonic, self.read_source(operands[0]))
+        elif mnemonic == "PUSH":
+            self.write_ram(self.sp, self.read_source(operands[0]))
+            self.sp = (self.sp + 1) & 0xFFFF
+        elif mnemonic == "POP":
+            self.sp = (self.sp - 1) & 0xFFFF
+            self.write_destination(operands[0], self.read_ram(self.sp))
+        elif mnemonic in {"INC", "DEC"}:
+            delta = int(operands[0].lstrip("#"))
+            self.set_mar(self.mar + (delta if mnemonic == "INC" else -delta))
+        elif mnemonic in JUMPS:
+            if mnemonic == "JAL":
+                self.registers["LRL"], self.registers["LRH"] = self.pc & 0xFF, self.pc >> 8
+            if self.jump_taken(mnemonic):
+                self.pc = (self.registers["PRH"] << 8) | self.registers["PRL"]
+        elif mnemonic != "NOP":
+            raise ValueError(f"Undefined instruction 0x{self.rom[address]:02X} at 0x{address:04X}")
+
+        cycles, taken_cycles = CYCLE_COSTS.get(mnemonic, (1, 1))
+        cost = taken_cycles if mnemonic in JUMPS and self.pc != (address + 1) & 0xFFFF else cycles
+        self.cycles += cost
+        self.address_cycles[address] = self.address_cycles.get(address, 0) + cost
+        self.address_steps[address] = self.address_steps.get(address, 0) + 1
+        self.steps += 1
+        if self.tracer is not None:
+            after = self.traced_state()
+            self.tracer({
+                "step": self.steps,
+                "pc": address,
+                "opcode": self.rom[address],
+                "text": f"{mnemonic} {', '.join(operands)}".strip(),
+                "cycles": cost,
+                "changes": {name: [before[name], after[name]] for name in after if after[name] != before[name]},
+                "writes": [{"address": target, "value": value} for target, value in self.step_writes],
+            })
+
+    @staticmethod
+    def format_trace_record(record: Dict[str, object]) -> str:
+        """One trace log line: step, PC, opcode, instruction, then changes and data writes."""
+        effects = []
+        for name, (old, new) in record["changes"].items():
+            if name in FLAG_NAMES:
+                effects.append(f"{name}={old}->{new}")
+            else:
+                digits = 4 if name == "SP" else 2
+                effects.append(f"{name}={old:0{digits}X}->{new:0{digits}X}")
+        effects.extend(f"[{write['address']:04X}]={write['value']:02X}" for write in record["writes"])
+        return f"{record['step']:8d}  {record['pc']:04X}  {record['opcode']:02X}  {record['text']:16s}  {' '.join(effects)}".rstrip()
+
+    def save_state(self) -> Dict[str, object]:
+        return {
+            "format": STATE_FORMAT,
+            "version": STATE_VERSION,
+            "rom_crc32": zlib.crc32(self.rom),
+            "pc": self.pc,
+            "sp": self.sp,
+            "halted": self.halted,
+            "registers": dict(self.registers),
+            "flags": self.flag_values(),
+            "cycles": self.cycles,
+            "steps": self.steps,
+            "ram_writes": self.ram_writes,
+            "ram": base64.b64encode(zlib.compress(bytes(self.ram))).decode("ascii"),
+            "devices": [
+                {"device": device.name, "start": start, "end": end, "state": device.save_state()}
+                for start, end, device in self.devices
+            ],
+            "profile": [[address, cycles, self.address_steps[address]] for address, cycles in sorted(self.address_cycles.items())],
+        }
+
+    def restore_state(self, state: Dict[str, object]) -> None:
+        """Resume from `save_state` data; devices must already be attached at the saved ranges."""
+        if zlib.crc32(self.rom) != state["rom_crc32"]:
+            raise ValueError("The snapshot was saved from a different program (ROM CRC-32 does not match)")
+        attached = {(start, end): device for start, end, device in self.devices}
+        for saved in state["devices"]:
+            device = attached.get((saved["start"], saved["end"]))
+            if device is None or device.name != saved["device"]:
+                raise ValueError(
+                    f"The snapshot has a {saved['device']} device at 0x{saved['start']:04X}-0x{saved['end']:04X} "
+                    "that is not attached"
+                )
+            device.restore_state(saved["state"])
+        try:
+            ram = zlib.decompress(base64.b64decode(state["ram"]))
+        except (ValueError, zlib.error) as exc:
+            raise ValueError(f"The snapshot RAM is corrupt: {exc}") from exc
+        if len(ram) != len(self.ram):
+            raise ValueError(f"The snapshot RAM is {len(ram)} bytes; expected {len(self.ram)}")
+        self.ram[:] = ram
+        self.pc, self.sp, self.halted = state["pc"], state["sp"], state["halted"]
+        self.registers = {name: int(state["registers"][name]) for name in REGISTER_NAMES}
+        flags = state["flags"]
+        self.flags = Flags(bool(flags["Z"]), bool(flags["N"]), bool(flags["C"]), bool(flags["V"]))
+        self.cycles, self.steps, self.ram_writes = state["cycles"], state["steps"], state["ram_writes"]
+        self.address_cycles = {address: cycles for address, cycles, _ in state["profile"]}
+        self.address_steps = {address: steps for address, _, steps in state["profile"]}
+
+    def snapshot(self) -> Tuple[object, ...]:
+        return (tuple(self.registers.values()), str(self.flags), self.sp, self.ram_writes)
+
+    def run(self, max_steps: int = DEFAULT_MAX_STEPS, breakpoints: Collection[int] = ()) -> RunResult:
+        """Run until HLT, an idle loop, `max_steps`, a failed assertion, or a breakpoint after the first step.
+
+        An assertion that stopped the previous run at the starting PC is not checked again, so a
+        run can continue past it.
+        """
+        jump_states: Dict[int, Tuple[object, ...]] = {}
+        steps = 0
+        resumed_from = self.failed_assertion.address if self.failed_assertion is not None else None
+        self.failed_assertion = None
+        while steps < max_steps:
+            if self.halted:
+                return RunResult(steps, f"HLT at 0x{self.pc:04X}", self.pc)
+            if steps and self.pc in breakpoints:
+                return RunResult(steps, f"breakpoint at 0x{self.pc:04X}", self.pc)
+            if self.pc in self.assertions and (steps or self.pc != resumed_from):
+                failure = self.check_assertions()
+                if failure is not None:
+                    return RunResult(steps, failure, self.pc)
+            address = self.pc
+            mnemonic = self.decode_table[self.rom[address]][0]
+            self.step()
+            steps += 1
+            if mnemonic in JUMPS and self.pc != (address + 1) & 0xFFFF:
+                state = self.snapshot()
+                if jump_states.get(self.pc) == state:
+                    return RunResult(steps, f"idle loop at 0x{self.pc:04X}", self.pc)
+                jump_states[self.pc] = state
+        if self.halted:
+            return RunResult(steps, f"HLT at 0x{self.pc:04X}", self.pc)
+        return RunResult(steps, f"step limit of {max_steps} reached", self.pc)
+
+    def format_state(self, result: Optional[RunResult] = None) -> List[str]:
+        lines: List[str] = []
+        if result is not None:
+            lines.append(f"Stopped: {result.reason} after {result.steps} steps")
+        lines.append(f"PC: 0x{self.pc:04X}  SP: 0x{self.sp:04X}  MAR: 0x{self.mar:04X}  PR: 0x{self.registers['PRH']:02X}{self.registers['PRL']:02X}  LR: 0x{self.registers['LRH']:02X}{self.registers['LRL']:02X}")
+        lines.append("  ".join(f"{name}: 0x{self.registers[name]:02X}" for name in ("RA", "RD", "RB", "ACC")))
+        lines.append(f"Flags: {self.flags}")
+        lines.append(f"Cycles: {self.cycles}")
+        return lines
+
+    def format_timing_report(self, labels: Dict[str, int], limit: Optional[int] = None) -> List[str]:
+        """Cycles spent under each code label, hottest first; code before the first label is `(unlabeled)`.
+
+        An instruction counts toward the nearest label at or before it, and `entries` is how many
+        times execution reached the label's own address.
+        """
+        starts = sorted((address, name) for name, address in labels.items())
+        start_addresses = [address for address, _ in starts]
+        totals: Dict[str, List[int]] = {}
+        for address, cost in self.address_cycles.items():
+            index = bisect.bisect_right(start_addresses, address) - 1
+            owner = starts[index][1] if index >= 0 else "(unlabeled)"
+            entry = totals.setdefault(owner, [0, 0, 0])
+            entry[0] += cost
+            entry[1] += self.address_steps[address]
+        for name, address in labels.items():
+            if name in totals:
+                totals[name][2] = self.address_steps.get(address, 0)
+
+        steps = sum(self.address_steps.values())
+        lines = [f"Timing: {self.cycles} cycles, {steps} instructions", "", "  cycles       %   instrs  entries  label"]
+        ranked = sorted(totals.items(), key=lambda item: (-item[1][0], item[0]))
+        for name, (cycles, count, entries) in ranked[:limit]:
+            share = cycles * 100 / self.cycles if self.cycles else 0.0
+            where = f" (0x{labels[name]:04X})" if name in labels else ""
+            lines.append(f"{cycles:8d}  {share:5.1f}%  {count:7d}  {entries:7d}  {name}{where}")
+        if limit is not None and len(ranked) > limit:
+            lines.append(f"  ... {len(ranked) - limit} more label(s)")
+        return lines
+
+    def format_ram(self, start: int, count: int) -> List[str]:
+        lines: List[str] = []
+        for row in range(start, start + count, 16):
+            values = [self.ram[address & 0xFFFF] for address in range(row, min(row + 16, start + count))]
+            text = "".join(chr(value) if 32 <= value < 127 else "." for value in values)
+            lines.append(f"{row & 0xFFFF:04X}: {' '.join(f'{value:02X}' for value in values):47s}  |{text}|")
+        return lines
+
+
+def read_state_file(path: str) -> Dict[str, object]:
+    """Load a snapshot written from `Emulator.save_state`."""
+    try:
+        with open(path, "r", encoding="utf-8") as f:
+            state = json.load(f)
+    except json.JSONDecodeError as exc:
+        raise ValueError(f"{path} is not an emulator snapshot: {exc.msg} at line {exc.lineno}") from exc
+    if not isinstance(state, dict) or state.get("format") != STATE_FORMAT:
+        raise ValueError(f"{path} is not an {STATE_FORMAT} file")
+    if state.get("version") != STATE_VERSION:
+        raise ValueError(f"{path} has snapshot version {state.get('version')}; this emulator reads version {STATE_VERSION}")
+    return state
@@ -11,12 +11,12 @@ class FunctionImportResolver:
     def __init__(
         self,
         comment_char: str,
-        constant_keyword: str,
+        constant_parser: Callable[[str], Optional[List[Tuple[str, str]]]],
         source_line_factory: Callable[[int, str, str], object],
         preprocessor_expand: Callable[[List[str], str], List[object]],
     ) -> None:
         self.comment_char = comment_char
-        self.constant_keyword = constant_keyword.lower()
+        self.constant_parser = constant_parser
         self.source_line_factory = source_line_factory
         self.preprocessor_expand = preprocessor_expand
         self.import_keyword = ".import"
@@ -72,11 +72,7 @@ class FunctionImportResolver:
         return self.strip_comments(text).lower() == self.endfunc_keyword
 
     def is_constant_line(self, text: str) -> bool:
-        stripped = self.strip_comments(text)
-        if not stripped:
-            return False
-        parts = stripped.split(None, 1)
-        return bool(parts and parts[0].lower() == self.constant_keyword)
+        return self.constant_parser(self.strip_comments(text)) is not None
 
     def extract_library_sections(
         self,
@@ -139,7 +135,11 @@ class FunctionImportResolver:
                 current_block.append(source_line)
                 continue
 
-            if self.is_constant_line(text):
+            try:
+                is_constant = self.is_constant_line(text)
+            except ValueError as exc:
+                raise ValueError(f"Error in {library_source}:{source_line.line_number} ('{text}'): {exc}") from exc
+            if is_constant:
                 prelude_lines.append(source_line)
 
         if inside_func:
@@ -0,0 +1,245 @@
+"""
+GdbStub: a minimal GDB remote serial protocol server for the emulator, driven by `gdbserver`.
+
+    python main.py gdbserver program.asm --port 1234
+    (gdb) target remote :1234
+
+GDB sees one address space, so, as for other Harvard CPUs, program ROM is at 0x0000-0xFFFF and data
+RAM at DATA_BASE (0x10000) onward. The register file, described to GDB by `target.xml`, is the ten
+8-bit registers in Emulator order, an 8-bit FLAGS (Z, N, C, V in bits 0-3), and 16-bit SP and PC:
+
+    0 RA  1 RD  2 RB  3 ACC  4 MARL  5 MARH  6 PRL  7 PRH  8 LRL  9 LRH  10 FLAGS  11 SP  12 PC
+
+Supported packets: `?`, `g`/`G`, `p`/`P`, `m`/`M`, `c`, `s`, `Z0`/`z0` and `Z1`/`z1` breakpoints,
+`qSupported`, `qXfer:features:read`, thread queries for a single thread, `D`, and `k`. Every stop,
+including `HLT` and an idle loop, is reported as SIGTRAP (`S05`) so the state stays inspectable,
+and Ctrl-C interrupts a `c`. Anything else gets the empty "unsupported" reply.
+"""
+
+from __future__ import annotations
+
+import select
+import socket
+from typing import Callable, List, Optional, Set, Tuple
+
+from .Emulator import FLAG_NAMES, REGISTER_NAMES, Emulator, Flags
+
+
+DATA_BASE = 0x10000
+DEFAULT_PORT = 1234
+# Steps run between checks for a Ctrl-C from the client while continuing.
+CONTINUE_SLICE = 10_000
+SIGTRAP_REPLY = "S05"
+REGISTER_LAYOUT: List[Tuple[str, int]] = [(name, 1) for name in REGISTER_NAMES] + [("FLAGS", 1), ("SP", 2), ("PC", 2)]
+TARGET_XML = (
+    '<?xml version="1.0"?>\n'
+    '<!DOCTYPE target SYSTEM "gdb-target.dtd">\n'
+    '<target version="1.0">\n'
+    '  <feature name="org.arnicomp.core">\n'
+    + "".join(
+        f'    <reg name="{name.lower()}" bitsize="{size * 8}" type="{"code_ptr" if name == "PC" else "int"}" regnum="{number}"/>\n'
+        for number, (name, size) in enumerate(REGISTER_LAYOUT)
+    )
+    + "  </feature>\n"
+    "</target>\n"
+)
+
+
+def checksum(payload: str) -> int:
+    return sum(payload.encode("latin-1")) & 0xFF
+
+
+def frame(payload: str) -> bytes:
+    """Wrap a reply as `$payload#cs`, escaping the protocol's special characters."""
+    escaped = "".join(f"}}{chr(ord(char) ^ 0x20)}" if char in "$#}*" else char for char in payload)
+    return f"${escaped}#{checksum(escaped):02x}".encode("latin-1")
+
+
+class GdbStub:
+    def __init__(self, emulator: Emulator) -> None:
+        self.emulator = emulator
+        self.breakpoints: Set[int] = set()
+        self.detached = False
+
+    def read_register(self, name: str) -> int:
+        emulator = self.emulator
+        if name == "FLAGS":
+            return sum(value << bit for bit, value in enumerate(emulator.flag_values().values()))
+        if name == "SP":
+            return emulator.sp
+        if name == "PC":
+            return emulator.pc
+        return emulator.registers[name]
+
+    def write_register(self, name: str, value: int) -> None:
+        emulator = self.emulator
+        if name == "FLAGS":
+            emulator.flags = Flags(*(bool(value >> bit & 1) for bit in range(len(FLAG_NAMES))))
+        elif name == "SP":
+            emulator.sp = value & 0xFFFF
+        elif name == "PC":
+            emulator.pc = value & 0xFFFF
+            emulator.halted = False
+        else:
+            emulator.registers[name] = value & 0xFF
+
+    def encode_register(self, number: int) -> str:
+        name, size = REGISTER_LAYOUT[number]
+        return self.read_register(name).to_bytes(size, "little").hex()
+
+    def memory(self, address: int) -> Tuple[bytearray, int]:
+        if address >= DATA_BASE:
+            return self.emulator.ram, (address - DATA_BASE) & 0xFFFF
+        return self.emulator.rom, address & 0xFFFF
+
+    def read_memory(self, address: int, length: int) -> str:
+        values = bytearray()
+        for offset in range(length):
+            space, index = self.memory(address + offset)
+            values.append(space[index])
+        return values.hex()
+
+    def write_memory(self, address: int, data: bytes) -> None:
+        for offset, value in enumerate(data):
+            space, index = self.memory(address + offset)
+            space[index] = value
+
+    def resume(self, interrupted: Callable[[], bool]) -> str:
+        emulator = self.emulator
+        while True:
+            result = emulator.run(CONTINUE_SLICE, self.breakpoints)
+            if not result.reason.startswith("step limit") or emulator.pc in self.breakpoints or interrupted():
+                return SIGTRAP_REPLY
+
+    def handle_packet(self, packet: str, interrupted: Callable[[], bool] = lambda: False) -> Optional[str]:
+        """Return the reply payload for one packet, or None when the session should end."""
+        command, body = packet[:1], packet[1:]
+        if command == "?":
+            return SIGTRAP_REPLY
+        if command == "g":
+            return "".join(self.encode_register(number) for number in range(len(REGISTER_LAYOUT)))
+        if command == "G":
+            data = bytes.fromhex(body)
+            offset = 0
+            for name, size in REGISTER_LAYOUT:
+                self.write_register(name, int.from_bytes(data[offset:offset + size], "little"))
+                offset += size
+            return "OK"
+        if command == "p":
+            number = int(body, 16)
+            return self.encode_register(number) if number < len(REGISTER_LAYOUT) else "E01"
+        if command == "P":
+            number_text, _, value_text = body.partition("=")
+            number = int(number_text, 16)
+            if number >= len(REGISTER_LAYOUT):
+                return "E01"
+            self.write_register(REGISTER_LAYOUT[number][0], int.from_bytes(bytes.fromhex(value_text), "little"))
+            return "OK"
+        if command == "m":
+            address_text, _, length_text = body.partition(",")
+            return self.read_memory(int(address_text, 16), int(length_text, 16))
+        if command == "M":
+            location, _, data_text = body.partition(":")
+            self.write_memory(int(location.partition(",")[0], 16), bytes.fromhex(data_text))
+            return "OK"
+        if command == "c":
+            if body:
+                self.write_register("PC", int(body, 16))
+            return self.resume(interrupted)
+        if command == "s":
+            if body:
+                self.write_register("PC", int(body, 16))
+            if not self.emulator.halted:
+                self.emulator.step()
+            return SIGTRAP_REPLY
+        if command in {"Z", "z"} and body[:2] in {"0,", "1,"}:
+            address = int(body[2:].partition(",")[0], 16) & 0xFFFF
+            if command == "Z":
+                self.breakpoints.add(address)
+            else:
+                self.breakpoints.discard(address)
+            return "OK"
+        if command in {"H", "T"}:
+            # There is one thread; selecting it or asking whether it is alive always succeeds.
+            return "OK"
+        if command == "D":
+            self.detached = True
+            return "OK"
+        if command == "k":
+            return None
+        if packet.startswith("qSupported"):
+            return "PacketSize=4000;qXfer:features:read+"
+        if packet.startswith("qXfer:features:read:target.xml:"):
+            offset_text, _, length_text = packet.rsplit(":", 1)[1].partition(",")
+            offset, length = int(offset_text, 16), int(length_text, 16)
+            chunk = TARGET_XML[offset:offset + length]
+            return ("m" if offset + length < len(TARGET_XML) else "l") + chunk
+        if packet == "qAttached":
+            return "1"
+        if packet == "qC":
+            return "QC1"
+        if packet == "qfThreadInfo":
+            return "m1"
+        if packet == "qsThreadInfo":
+            return "l"
+        return ""
+
+    def serve_connection(self, connection: socket.socket) -> None:
+        buffer = bytearray()
+
+        def fill() -> bool:
+            data = connection.recv(4096)
+            buffer.extend(data)
+            return bool(data)
+
+        def interrupted() -> bool:
+            if not select.select([connection], [], [], 0)[0]:
+                return False
+            if not fill():
+                return True
+            if b"\x03" in buffer:
+                del buffer[:buffer.index(b"\x03") + 1]
+                return True
+            return False
+
+        while not self.detached:
+            start = buffer.find(b"$")
+            if start < 0:
+                # Acks and stray interrupts between packets carry nothing to answer.
+                buffer.clear()
+            end = buffer.find(b"#", start + 1) if start >= 0 else -1
+            if end < 0 or len(buffer) < end + 3:
+                if not fill():
+                    return
+                continue
+            payload, sent_checksum = bytes(buffer[start + 1:end]).decode("latin-1"), bytes(buffer[end + 1:end + 3])
+            del buffer[:end + 3]
+            try:
+                intact = int(sent_checksum, 16) == checksum(payload)
+            except ValueError:
+                # A checksum that is not hex digits is as wrong as one that does not match.
+                intact = False
+            if not intact:
+                connection.sendall(b"-")
+                continue
+            connection.sendall(b"+")
+            try:
+                reply = self.handle_packet(payload, interrupted)
+            except (ValueError, IndexError):
+                reply = "E01"
+            if reply is None:
+                return
+            connection.sendall(frame(reply))
+
+    def serve(self, host: str = "127.0.0.1", port: int = DEFAULT_PORT, announce: Callable[[str], None] = print) -> None:
+        """Accept one debugger connection and serve it until it detaches, kills, or disconnects."""
+        with socket.create_server((host, port)) as server:
+            announce(f"Listening for GDB on {host}:{server.getsockname()[1]}")
+            connection, peer = server.accept()
+            with connection:
+                announce(f"Debugger attached from {peer[0]}:{peer[1]}")
+                try:
+                    self.serve_connection(connection)
+                except ConnectionError:
+                    pass
+            announce("Debugger detached")
@@ -1,34 +1,67 @@
 """
 HexConverter: Intel HEX file generation for Digital circuit simulator
+
+Records hold at most 16 data bytes from one run of consecutive addresses, so gaps between
+`.org` regions are simply absent from the file. Addresses past 0xFFFF get an extended linear
+address record, although ArniComp ROM images never reach them.
 """
 
-from intelhex import IntelHex
-from six import StringIO
+from typing import Dict, List
+
+
+RECORD_DATA_BYTES = 16
+
+
+def intel_hex_record(address: int, record_type: int, data: bytes = b"") -> str:
+    """One record: byte count, 16-bit address, type, data, and the two's complement of their sum."""
+    fields = bytes([len(data), (address >> 8) & 0xFF, address & 0xFF, record_type]) + data
+    return f":{fields.hex().upper()}{-sum(fields) & 0xFF:02X}"
 
 
-def save_intelHexFile(filename: str, lines: list, line_type: str = 'hex'):
+def format_intel_hex(image: Dict[int, int]) -> List[str]:
+    """Intel HEX records for a sparse {address: byte} image, ending with the end-of-file record."""
+    records: List[str] = []
+    addresses = sorted(image)
+    upper = 0
+    index = 0
+    while index < len(addresses):
+        start = addresses[index]
+        if start >> 16 != upper:
+            upper = start >> 16
+            records.append(intel_hex_record(0, 0x04, upper.to_bytes(2, "big")))
+        end = index + 1
+        while (
+            end < len(addresses)
+            and end - index < RECORD_DATA_BYTES
+            and addresses[end] == addresses[end - 1] + 1
+            and addresses[end] >> 16 == upper
+        ):
+            end += 1
+        records.append(intel_hex_record(start & 0xFFFF, 0x00, bytes(image[address] & 0xFF for address in addresses[index:end])))
+        index = end
+    records.append(intel_hex_record(0, 0x01))
+    return [f"{record}\n" for record in records]
+
+
+def save_intelHexFile(filename: str, lines: list, line_type: str = 'hex', newline: str = '\n'):
     """Write a sequential list of byte values to an Intel HEX file.
 
     Args:
         filename: Output .hex file path
         lines: List of strings representing byte values in the given base (hex/bin)
         line_type: 'hex' or 'bin' - determines how to parse each element in lines
+        newline: Line ending written to the file, independent of the platform default
     
     The Intel HEX format is used by Digital circuit simulator for ROM input.
     """
     number_base = 16 if line_type == 'hex' else 2
-    ih = IntelHex()
+    image = {}
     for i, line in enumerate(lines):
         if isinstance(line, bytes):
             line = line.decode('utf-8')
-        value = int(str(line).strip(), number_base) & 0xFF
-        ih[i] = value
-    sio = StringIO()
-    ih.write_hex_file(sio)
-    hexstr = sio.getvalue()
-    with open(filename, 'w') as f:
-        f.write(hexstr)
-    sio.close()
+        image[i] = int(str(line).strip(), number_base) & 0xFF
+    with open(filename, 'w', newline=newline) as f:
+        f.writelines(format_intel_hex(image))
 
 
 def save_intelHexFile_from_pairs(
@@ -37,6 +70,7 @@ def save_intelHexFile_from_pairs(
     addr_base: str = 'bin',
     data_base: str = 'bin',
     sep: str = None,
+    newline: str = '\n',
 ):
     """Write address-aware pairs to Intel HEX.
 
@@ -49,6 +83,7 @@ def save_intelHexFile_from_pairs(
         addr_base: One of 'bin' | 'hex' | 'dec'
         data_base: One of 'bin' | 'hex' | 'dec'
         sep: Optional explicit separator; defaults to any whitespace
+        newline: Line ending written to the file, independent of the platform default
     """
     base_map = {
         'bin': 2,
@@ -90,16 +125,10 @@ def save_intelHexFile_from_pairs(
             continue
         pairs.append((addr, data))
 
-    # Sort by address
-    pairs.sort(key=lambda t: t[0])
-
-    ih = IntelHex()
+    # Later pairs for the same address win, as they did when assigned one by one.
+    image = {}
     for addr, data in pairs:
-        ih[addr] = data
-
-    sio = StringIO()
-    ih.write_hex_file(sio)
-    hexstr = sio.getvalue()
-    with open(filename, 'w') as f:
-        f.write(hexstr)
-    sio.close()
+        image[addr] = data
+
+    with open(filename, 'w', newline=newline) as f:
+        f.writelines(format_intel_hex(image))
@@ -7,8 +7,20 @@ if TYPE_CHECKING:
     from .AssemblyHelper import AssemblyHelper, ParsedLine
 
 
+# Bytes each checksum directive emits: an 8-bit checksum, or a CRC-16 stored low byte first.
+CHECKSUM_SIZES = {".CHECKSUM": 1, ".CRC16": 2}
+# Bytes per value of the data directives; words are stored low byte first unless `.endian big` is in effect.
+DATA_VALUE_SIZES = {".BYTE": 1, ".WORD": 2}
+STRING_DIRECTIVES = {".ASCII", ".ASCIIZ"}
+
+
 class LayoutDirectiveHandler:
-    """Handle layout and padding directives such as .org, .align, and .fill."""
+    """Handle layout and padding directives such as .org, .padto, .align, and .fill.
+
+    `.checksum` and `.crc16` reserve their bytes here; AssemblyHelper.apply_checksums fills them in
+    once the whole image is known. The data directives `.byte`, `.word`, `.ascii`, `.asciiz`, and
+    `.space` place literal bytes in ROM.
+    """
 
     def __init__(self, helper: "AssemblyHelper") -> None:
         self.helper = helper
@@ -23,16 +35,31 @@ class LayoutDirectiveHandler:
     ) -> Optional[int]:
         instruction = instruction.upper()
 
-        if instruction == ".FILL":
-            count, _ = self.parse_fill_args(args, labels, constants)
+        if instruction == ".ENTRY":
+            return 0
+
+        if instruction in {".FILL", ".SPACE"}:
+            count, _ = self.parse_fill_args(args, labels, constants, instruction.lower())
             return count
 
+        if instruction in DATA_VALUE_SIZES:
+            self.require_operands(args, instruction.lower())
+            return DATA_VALUE_SIZES[instruction] * len(args)
+
+        if instruction in STRING_DIRECTIVES:
+            return len(self.string_bytes(instruction, args))
+
         if instruction == ".ORG":
             target, _ = self.parse_layout_target(args, labels, constants, ".org")
             if target < current_pc:
                 raise ValueError(f".org target 0x{target:04X} is behind current address 0x{current_pc:04X}")
             return target - current_pc
 
+        if instruction == ".PADTO":
+            target, _ = self.parse_layout_target(args, labels, constants, ".padto")
+            self.check_padto_target(target, current_pc)
+            return target - current_pc
+
         if instruction == ".ALIGN":
             boundary, _ = self.parse_layout_target(args, labels, constants, ".align")
             if boundary <= 0:
@@ -40,6 +67,9 @@ class LayoutDirectiveHandler:
             remainder = current_pc % boundary
             return 0 if remainder == 0 else boundary - remainder
 
+        if instruction in CHECKSUM_SIZES:
+            return CHECKSUM_SIZES[instruction]
+
         return None
 
     def emit(
@@ -53,16 +83,39 @@ class LayoutDirectiveHandler:
     ) -> Optional[List[str]]:
         instruction = instruction.upper()
 
-        if instruction == ".FILL":
-            count, fill_byte = self.parse_fill_args(args, labels, constants)
+        if instruction == ".ENTRY":
+            # Emits nothing; AssemblyHelper.check_entry_point checks the address once the image is laid out.
+            return []
+
+        if instruction in {".FILL", ".SPACE"}:
+            count, fill_byte = self.parse_fill_args(args, labels, constants, instruction.lower())
             return [f"{fill_byte:08b}" for _ in range(count)]
 
+        if instruction in DATA_VALUE_SIZES:
+            self.require_operands(args, instruction.lower())
+            emitted: List[str] = []
+            order = list(range(DATA_VALUE_SIZES[instruction]))
+            if id(self.helper.emitting_line) in self.helper.big_endian_lines:
+                order.reverse()
+            for token in args:
+                value = self.resolve_data_value(token, labels, constants, instruction)
+                emitted.extend(f"{(value >> (8 * index)) & 0xFF:08b}" for index in order)
+            return emitted
+
+        if instruction in STRING_DIRECTIVES:
+            return [f"{byte:08b}" for byte in self.string_bytes(instruction, args)]
+
         if instruction == ".ORG":
             target, fill_byte = self.parse_layout_target(args, labels, constants, ".org")
             if target < current_pc:
                 raise ValueError(f".org target 0x{target:04X} is behind current address 0x{current_pc:04X}")
             return [f"{fill_byte:08b}" for _ in range(target - current_pc)]
 
+        if instruction == ".PADTO":
+            target, fill_byte = self.parse_layout_target(args, labels, constants, ".padto")
+            self.check_padto_target(target, current_pc)
+            return [f"{fill_byte:08b}" for _ in range(target - current_pc)]
+
         if instruction == ".ALIGN":
             boundary, fill_byte = self.parse_layout_target(args, labels, constants, ".align")
             if boundary <= 0:
@@ -71,21 +124,86 @@ class LayoutDirectiveHandler:
             padding = 0 if remainder == 0 else boundary - remainder
             return [f"{fill_byte:08b}" for _ in range(padding)]
 
+        if instruction in CHECKSUM_SIZES:
+            self.parse_checksum_range(args, labels, constants, instruction.lower())
+            return ["00000000"] * CHECKSUM_SIZES[instruction]
+
         return None
 
+    def check_padto_target(self, target: int, current_pc: int) -> None:
+        if target < current_pc:
+            raise ValueError(
+                f".padto target 0x{target:04X} is already past: current address is 0x{current_pc:04X} "
+                f"({current_pc - target} byte(s) over)"
+            )
+
     def parse_fill_args(
         self,
         args: List[str],
         labels: Dict[str, int],
         constants: Dict[str, int],
+        directive: str = ".fill",
     ) -> tuple[int, int]:
         if len(args) not in {1, 2}:
-            raise ValueError(".fill requires count and optional fill byte")
+            raise ValueError(f"{directive} requires count and optional fill byte")
 
-        count = self.resolve_non_negative(args[0], labels, constants, ".fill")
-        fill_byte = 0 if len(args) == 1 else self.resolve_byte(args[1], labels, constants, ".fill")
+        count = self.resolve_non_negative(args[0], labels, constants, directive)
+        fill_byte = self.section_fill() if len(args) == 1 else self.resolve_byte(args[1], labels, constants, directive)
         return count, fill_byte
 
+    def require_operands(self, args: List[str], directive: str) -> None:
+        if not args or any(not arg.strip() for arg in args):
+            raise ValueError(f"{directive} requires a comma-separated list of values")
+
+    def resolve_data_value(
+        self,
+        token: str,
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        instruction: str,
+    ) -> int:
+        directive = instruction.lower()
+        resolved = self.helper.resolve_value(token, labels, constants)
+        if resolved.value is None:
+            raise ValueError(f"{directive} could not resolve operand {token}")
+        bits = 8 * DATA_VALUE_SIZES[instruction]
+        if not (-(1 << (bits - 1)) <= resolved.value < (1 << bits)):
+            raise ValueError(
+                f"{directive} value {token} resolves to {resolved.value}, out of range "
+                f"({-(1 << (bits - 1))}..{(1 << bits) - 1})"
+            )
+        return resolved.value & ((1 << bits) - 1)
+
+    def string_bytes(self, instruction: str, args: List[str]) -> List[int]:
+        """Return the bytes of `.ascii` strings; `.asciiz` ends each string with a zero byte."""
+        directive = instruction.lower()
+        if not args:
+            raise ValueError(f"{directive} requires at least one string literal")
+        data: List[int] = []
+        for token in args:
+            for char in self.helper.macro_expander.parse_string_literal(token, directive):
+                if ord(char) > 0xFF:
+                    raise ValueError(f"{directive} character {char!r} does not fit in one byte")
+                data.append(ord(char))
+            if instruction == ".ASCIIZ":
+                data.append(0)
+        return data
+
+    def parse_checksum_range(
+        self,
+        args: List[str],
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+        directive: str,
+    ) -> tuple[int, int]:
+        if len(args) != 2:
+            raise ValueError(f"{directive} requires a start address and an end address")
+        start = self.resolve_non_negative(args[0], labels, constants, directive)
+        end = self.resolve_non_negative(args[1], labels, constants, directive)
+        if end <= start:
+            raise ValueError(f"{directive} range 0x{start:04X}-0x{end:04X} is empty; the end address is exclusive")
+        return start, end
+
     def parse_layout_target(
         self,
         args: List[str],
@@ -96,9 +214,13 @@ class LayoutDirectiveHandler:
         if len(args) not in {1, 2}:
             raise ValueError(f"{directive} requires target and optional fill byte")
         target = self.resolve_non_negative(args[0], labels, constants, directive)
-        fill_byte = 0 if len(args) == 1 else self.resolve_byte(args[1], labels, constants, directive)
+        fill_byte = self.section_fill() if len(args) == 1 else self.resolve_byte(args[1], labels, constants, directive)
         return target, fill_byte
 
+    def section_fill(self) -> int:
+        """Return the `.text fill=` byte for the line being emitted, 0x00 when none is set."""
+        return self.helper.section_fill_bytes.get(id(self.helper.emitting_line), 0)
+
     def resolve_non_negative(
         self,
         token: str,
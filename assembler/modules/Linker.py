@@ -0,0 +1,219 @@
+"""
+Linker: relocatable object files and the `link` step that turns several of them into one ROM.
+
+An object file is JSON written by `assemble -c`. It holds one source file after the passes that
+need only that file (preprocessing, includes, macros, local and numeric labels, register aliases,
+and constants), plus its symbol table:
+
+    {
+        "format": "arnicomp-object",
+        "version": 2,
+        "source": "uart.asm",
+        "target": "arnicomp-v2",
+        "constants": {"UART_DATA": 241},
+        "symbols": ["UART_PUTC"],
+        "locals": ["WAIT"],
+        "externs": ["DELAY"],
+        "relocations": [{"symbol": "DELAY", "kind": "label", "statement": 4, "file": "uart.asm", "line": 12}],
+        "lines": [{"file": "uart.asm", "line": 3, "text": "uart_putc: MOV MARL, RA"}]
+    }
+
+A label is local to its file unless the file exports it with `.global NAME`; `symbols` lists the
+exported labels and `locals` the rest. A file names what it uses from other files with
+`.extern NAME`, a label or a constant. References to those names are the relocations: each gives
+the symbol, whether it was used as a label or as a `$constant`, and the index in `lines` of the
+statement that refers to it. Any other undefined name fails `assemble -c` as it would a normal build.
+
+Instruction sizes on ArniComp depend on the values they load, so objects keep statements instead
+of bytes, and a relocation points at a statement rather than a byte offset. Linking joins the
+objects in the order given, renames each object's local labels apart, checks that every
+relocation is exported by some object and that shared constants agree, then runs the normal
+layout and encoding over the whole program.
+"""
+
+from __future__ import annotations
+
+import json
+import re
+from typing import Dict, List, Optional
+
+from .AssemblyHelper import STRING_LITERAL_RE, AssemblyHelper, SourceLine
+from .Preprocessor import DEFAULT_MAX_INCLUDE_DEPTH, DEFAULT_MAX_MACRO_DEPTH
+from .Targets import normalize_target
+
+
+OBJECT_FORMAT = "arnicomp-object"
+OBJECT_VERSION = 2
+
+
+def build_object(
+    helper: AssemblyHelper,
+    raw_lines: List[str],
+    source_name: str,
+    defines: Optional[Dict[str, int]] = None,
+    fail_fast: bool = False,
+    warn_symbol_case: bool = False,
+    strict_case: bool = False,
+    max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH,
+    max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH,
+) -> Dict[str, object]:
+    """Prepare one source file and record the labels it exports and the external symbols it uses."""
+    helper.begin_build()
+    constants, lines = helper.prepare_source(
+        raw_lines,
+        source_name,
+        defines=defines,
+        fail_fast=fail_fast,
+        warn_symbol_case=warn_symbol_case,
+        strict_case=strict_case,
+        max_include_depth=max_include_depth,
+        max_macro_depth=max_macro_depth,
+    )
+    warnings = list(helper.last_warnings)
+    lines, exported, external = helper.extract_linkage(lines)
+    labels = list(dict.fromkeys(
+        label for label in (helper.split_label_prefix(line.text)[0] for line in lines) if label is not None
+    ))
+
+    errors = [f"Error in {source_name}: .global {name} is not defined in this file" for name in exported if name not in labels]
+    errors.extend(
+        f"Error in {source_name}: .extern {name} is defined in this file"
+        for name in external
+        if name in labels or name in constants
+    )
+    if errors:
+        helper.raise_collected_errors(errors)
+
+    # Assemble once with the externs reading as 0; every use of one is recorded as it is encoded.
+    helper.begin_build()
+    helper.external_symbols = set(external)
+    try:
+        helper.assemble_prepared(lines, dict(constants), source_name=source_name, fail_fast=fail_fast)
+    finally:
+        helper.external_symbols = set()
+
+    statements = {id(line): index for index, line in enumerate(lines)}
+    relocations = [
+        {"symbol": name, "kind": kind, "statement": statements[id(line)], "file": line.source_name, "line": line.line_number}
+        for name, kind, line in helper.last_external_references
+    ]
+    helper.last_warnings = warnings + helper.last_warnings
+    return {
+        "format": OBJECT_FORMAT,
+        "version": OBJECT_VERSION,
+        "source": source_name,
+        "target": helper.target,
+        "constants": constants,
+        "symbols": exported,
+        "locals": [label for label in labels if label not in exported],
+        "externs": external,
+        "relocations": relocations,
+        "lines": [object_line(line) for line in lines],
+    }
+
+
+def object_line(line: SourceLine) -> Dict[str, object]:
+    entry: Dict[str, object] = {"file": line.source_name, "line": line.line_number, "text": line.text}
+    if line.expansion:
+        entry["expansion"] = [list(frame) for frame in line.expansion]
+    if line.column != 1:
+        entry["column"] = line.column
+    return entry
+
+
+def load_object(path: str) -> Dict[str, object]:
+    try:
+        with open(path, "r", encoding="utf-8") as f:
+            data = json.load(f)
+    except json.JSONDecodeError as exc:
+        raise ValueError(f"{path} is not an object file: {exc.msg} at line {exc.lineno}") from exc
+    if not isinstance(data, dict) or data.get("format") != OBJECT_FORMAT:
+        raise ValueError(f"{path} is not an {OBJECT_FORMAT} file")
+    if data.get("version") != OBJECT_VERSION:
+        raise ValueError(
+            f"{path} has object format version {data.get('version')}; this assembler reads version {OBJECT_VERSION} "
+            "(rebuild it with assemble -c)"
+        )
+    data.setdefault("source", path)
+    return data
+
+
+def rename_labels(text: str, renames: Dict[str, str]) -> str:
+    """Rename label definitions and references in one statement, leaving `$constants` and strings alone."""
+    if not renames:
+        return text
+    pattern = re.compile(
+        r"(?<![A-Za-z0-9_$*])(" + "|".join(re.escape(name) for name in renames) + r")(?![A-Za-z0-9_])",
+        re.IGNORECASE,
+    )
+    pieces: List[str] = []
+    last_end = 0
+    for literal in STRING_LITERAL_RE.finditer(text):
+        pieces.append(pattern.sub(lambda match: renames[match.group(1).upper()], text[last_end:literal.start()]))
+        pieces.append(literal.group(0))
+        last_end = literal.end()
+    pieces.append(pattern.sub(lambda match: renames[match.group(1).upper()], text[last_end:]))
+    return "".join(pieces)
+
+
+def link_objects(
+    helper: AssemblyHelper,
+    objects: List[Dict[str, object]],
+    **options,
+):
+    """Join objects in order, check cross-file symbols, and assemble the result; `options` go to assemble_prepared."""
+    if not objects:
+        raise ValueError("link requires at least one object file")
+
+    targets = {normalize_target(str(obj.get("target"))) for obj in objects}
+    if len(targets) > 1:
+        raise ValueError(f"Objects were built for different targets: {', '.join(sorted(targets))}")
+    helper.target = targets.pop()
+
+    constants: Dict[str, int] = {}
+    constant_sources: Dict[str, str] = {}
+    exported: Dict[str, str] = {}
+    lines: List[SourceLine] = []
+    errors: List[str] = []
+    for index, obj in enumerate(objects):
+        source = str(obj["source"])
+        for name, value in obj["constants"].items():
+            if name in constants and constants[name] != value:
+                errors.append(
+                    f"Constant {name} is {value} in {source} but {constants[name]} in {constant_sources[name]}"
+                )
+                continue
+            constants.setdefault(name, value)
+            constant_sources.setdefault(name, source)
+        for name in obj["symbols"]:
+            exported.setdefault(name, source)
+        # Every object starts in .text, whatever section the previous one ended in.
+        lines.append(SourceLine(0, ".text", source_name=source))
+        # Labels a file does not export are its own, so each object's copies get distinct names.
+        renames = {name: f"__O{index}_{name}" for name in obj["locals"]}
+        lines.extend(
+            SourceLine(
+                int(entry["line"]),
+                rename_labels(str(entry["text"]), renames),
+                source_name=str(entry["file"]),
+                expansion=tuple((str(macro), str(file), int(line)) for macro, file, line in entry.get("expansion", ())),
+                column=int(entry.get("column", 1)),
+            )
+            for entry in obj["lines"]
+        )
+
+    for obj in objects:
+        for relocation in obj["relocations"]:
+            symbol, where = relocation["symbol"], f"Error on line {relocation['file']}:{relocation['line']}"
+            if relocation["kind"] == "constant" and symbol not in constants:
+                errors.append(f"{where}: Undefined constant reference: ${symbol} (no linked object defines it)")
+            elif relocation["kind"] == "label" and symbol not in exported:
+                errors.append(
+                    f"{where}: Undefined label reference: {symbol} (no linked object exports it with .global)"
+                )
+    if errors:
+        helper.raise_collected_errors(errors)
+
+    helper.begin_build()
+    binary_lines, labels, constants = helper.assemble_prepared(lines, constants, source_name=str(objects[0]["source"]), **options)
+    return (binary_lines, *helper.exported_symbols(labels, constants))
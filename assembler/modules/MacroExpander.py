@@ -214,18 +214,42 @@ class MacroExpander:
             if label_name in labels:
                 from .AssemblyHelper import ResolvedValue
 
-                return ResolvedValue(raw_text=token, value=labels[label_name], kind="label")
-            if allow_unresolved:
+                resolved = ResolvedValue(raw_text=token, value=labels[label_name], kind="label")
+            elif self.helper.assume_zero(label_name, "label"):
                 from .AssemblyHelper import ResolvedValue
 
-                return ResolvedValue(raw_text=token, value=None, kind="label")
-            raise ValueError(f"Undefined label reference: {token}")
+                resolved = ResolvedValue(raw_text=token, value=0, kind="label")
+            elif allow_unresolved:
+                from .AssemblyHelper import ResolvedValue
 
-        resolved = self.helper.resolve_value(token, labels, constants, allow_unresolved=allow_unresolved)
-        if resolved.sliced:
-            raise ValueError(f"{instruction} expects an unsliced address operand, got {token}")
+                return ResolvedValue(raw_text=token, value=None, kind="label")
+            else:
+                raise ValueError(
+                    f"Undefined label reference: {token}{self.helper.undefined_symbol_hint(label_name, 'label', labels, constants)}"
+                )
+        else:
+            resolved = self.helper.resolve_value(token, labels, constants, allow_unresolved=allow_unresolved)
+            if resolved.sliced:
+                raise ValueError(f"{instruction} expects an unsliced address operand, got {token}")
+        if resolved.value is not None and not (0 <= resolved.value <= 0xFFFF):
+            raise ValueError(f"{instruction} target address {token} resolves to {resolved.value}, out of range (0x0000-0xFFFF)")
+        self.warn_data_target(stripped, instruction)
         return resolved
 
+    def warn_data_target(self, token: str, instruction: str) -> None:
+        """Warn once per line when a jump or call names a `.data` label, which is a RAM address."""
+        name = token[len(self.helper.label_prefix):] if token.startswith(self.helper.label_prefix) else token
+        name = name.upper()
+        line = self.helper.emitting_line
+        if line is None or name not in self.helper.data_labels:
+            return
+        warning = (
+            f"Line {self.helper.format_line_ref(line)}: {instruction.removesuffix('_TARGET')} target {name} is a .data label "
+            f"(RAM 0x{self.helper.data_labels[name]:04X}); code runs from ROM, so this jumps to ROM 0x{self.helper.data_labels[name]:04X}"
+        )
+        if warning not in self.helper.last_warnings:
+            self.helper.last_warnings.append(warning)
+
     def parse_call_args(self, args: List[str]) -> Tuple[str, str]:
         core_args, temp_reg = self.parse_temp_register_suffix(args, "CALL")
         if len(core_args) != 1:
@@ -592,7 +616,7 @@ class MacroExpander:
         if instruction == "PUSHI":
             value_token, temp_reg = self.parse_pushi_args(args)
             pseudo_parsed = parsed
-            emitted = self.helper.emit_ldi(pseudo_parsed, [temp_reg, value_token], labels, constants)
+            emitted = self.helper.emit_ldi(pseudo_parsed, [temp_reg, value_token], labels, constants, "PUSHI")
             emitted.append(self.encoder.encode_push_source(temp_reg))
             return emitted
 
@@ -602,12 +626,12 @@ class MacroExpander:
             emitted: List[str] = []
 
             for token in reversed(trailing_values):
-                emitted.extend(self.helper.emit_ldi(parsed, [temp_reg, token], labels, constants))
+                emitted.extend(self.helper.emit_ldi(parsed, [temp_reg, token], labels, constants, "PUSHSTR"))
                 emitted.append(self.encoder.encode_push_source(temp_reg))
 
             for ch in reversed(literal):
                 char_token = repr(ch)
-                emitted.extend(self.helper.emit_ldi(parsed, [temp_reg, char_token], labels, constants))
+                emitted.extend(self.helper.emit_ldi(parsed, [temp_reg, char_token], labels, constants, "PUSHSTR"))
                 emitted.append(self.encoder.encode_push_source(temp_reg))
 
             return emitted
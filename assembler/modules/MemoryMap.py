@@ -0,0 +1,111 @@
+"""
+MemoryMap: the `.map` report of where a build placed everything.
+
+The map lists section extents, ROM use against the ROM size, the free blocks left in ROM, and
+every label with its address. Padding emitted by `.org`, `.padto`, and `.align` counts as free:
+it holds no code or data and would be reclaimed by moving the directive.
+"""
+
+from __future__ import annotations
+
+from typing import Dict, List, TYPE_CHECKING, Tuple
+
+from .ReachabilityChecker import LAYOUT_DIRECTIVES
+
+
+if TYPE_CHECKING:
+    from .AssemblyHelper import AssemblyHelper
+
+
+PADDING_DIRECTIVES = LAYOUT_DIRECTIVES - {".FILL", ".SPACE", ".CHECKSUM", ".CRC16", ".BYTE", ".WORD", ".ASCII", ".ASCIIZ"}
+
+
+def used_rom_ranges(helper: "AssemblyHelper") -> List[Tuple[int, int]]:
+    """Return merged [start, end) ranges of ROM that hold code or `.fill` and data-directive bytes in the last build."""
+    ranges: List[Tuple[int, int]] = []
+    for entry in helper.last_listing:
+        _, instruction_text = helper.split_label_prefix(entry.source_text)
+        parts = instruction_text.split(None, 1)
+        if parts and parts[0].upper() in PADDING_DIRECTIVES:
+            continue
+        start, end = entry.address, entry.address + len(entry.binary_bytes)
+        if ranges and ranges[-1][1] >= start:
+            ranges[-1] = (ranges[-1][0], max(ranges[-1][1], end))
+        else:
+            ranges.append((start, end))
+    return ranges
+
+
+def free_rom_ranges(used: List[Tuple[int, int]], rom_size: int) -> List[Tuple[int, int]]:
+    free: List[Tuple[int, int]] = []
+    cursor = 0
+    for start, end in used:
+        if start > cursor:
+            free.append((cursor, min(start, rom_size)))
+        cursor = max(cursor, end)
+        if cursor >= rom_size:
+            break
+    if cursor < rom_size:
+        free.append((cursor, rom_size))
+    return [(start, end) for start, end in free if end > start]
+
+
+def format_range(start: int, end: int) -> str:
+    return f"0x{start:04X}-0x{end - 1:04X}" if end > start else "(empty)"
+
+
+def format_memory_map(
+    helper: "AssemblyHelper",
+    labels: Dict[str, int],
+    image_size: int,
+    rom_size: int,
+    source_name: str,
+    crc_bytes: int = 0,
+) -> List[str]:
+    """Render the map of the last build; `image_size` is the length of the emitted binary.
+
+    `crc_bytes` are the bytes `--append-crc` adds after the program; they occupy ROM like code.
+    """
+    used = used_rom_ranges(helper)
+    if crc_bytes:
+        if used and used[-1][1] >= image_size:
+            used[-1] = (used[-1][0], image_size + crc_bytes)
+        else:
+            used.append((image_size, image_size + crc_bytes))
+    free = free_rom_ranges(used, rom_size)
+    used_bytes = sum(end - start for start, end in used)
+    free_bytes = sum(end - start for start, end in free)
+    data_start, data_end = helper.data_range
+
+    lines = [
+        f"Memory map: {source_name}",
+        f"ROM size: {rom_size} bytes ({format_range(0, rom_size)})",
+        "",
+        "Sections:",
+        f"  .text  {format_range(0, image_size):13s}  {image_size:6d} bytes ({image_size + crc_bytes - used_bytes} padding)",
+        f"  .data  {format_range(data_start, data_end):13s}  {data_end - data_start:6d} bytes (RAM)",
+    ]
+    if crc_bytes:
+        lines.append(f"  crc    {format_range(image_size, image_size + crc_bytes):13s}  {crc_bytes:6d} bytes (--append-crc)")
+    lines += [
+        "",
+        f"ROM used: {used_bytes} of {rom_size} bytes ({used_bytes * 100 / rom_size:.1f}%)",
+        f"ROM free: {free_bytes} bytes",
+    ]
+    if image_size + crc_bytes > rom_size:
+        lines.append(f"ROM overflow: the program is {image_size + crc_bytes - rom_size} bytes larger than the ROM")
+    if free:
+        start, end = max(free, key=lambda block: (block[1] - block[0], -block[0]))
+        lines.append(f"Largest free block: {format_range(start, end)} ({end - start} bytes)")
+        lines.append("")
+        lines.append("Free blocks:")
+        lines.extend(f"  {format_range(start, end):13s}  {end - start:6d} bytes" for start, end in free)
+    else:
+        lines.append("Largest free block: none")
+
+    lines.append("")
+    lines.append("Labels:")
+    for name, address in sorted(labels.items(), key=lambda item: (item[1], item[0])):
+        section = ".data" if name in helper.data_labels else ".text"
+        lines.append(f"  0x{address:04X}  {section}  {name}")
+    return [f"{line}\n" for line in lines]
@@ -323,13 +323,37 @@ class Optimizer:
         listing_rows: List[Tuple["SourceLine", int, List[str]]] = []
         for index, node in enumerate(nodes):
             start_pc = final_state.starts[index]
+            self.helper.emitting_line = node.source_line
             emitted = node.emit(self.helper, start_pc, final_state.labels, constants)
             binary_lines.extend(f"{byte}\n" for byte in emitted)
             if emitted:
                 listing_rows.append((node.source_line, start_pc, emitted))
+        self.helper.emitting_line = None
 
         return binary_lines, final_state.labels, listing_rows
 
+    def suggest_savings(
+        self,
+        lines: List["SourceLine"],
+        constants: Dict[str, int],
+        canonical_sizes: Dict[int, int],
+    ) -> List[str]:
+        """Report lines that relaxation would encode in fewer bytes than the canonical build.
+
+        `canonical_sizes` maps id(source_line) to the number of bytes the canonical path emitted.
+        """
+        _, _, listing_rows = self.optimize(lines, constants)
+        suggestions: List[str] = []
+        for source_line, _, emitted in listing_rows:
+            canonical_size = canonical_sizes.get(id(source_line))
+            if canonical_size is None or len(emitted) >= canonical_size:
+                continue
+            suggestions.append(
+                f"Line {self.helper.format_line_ref(source_line)}: '{source_line.text}' takes {canonical_size} byte(s); "
+                f"--optimize encodes it in {len(emitted)} (saves {canonical_size - len(emitted)})"
+            )
+        return suggestions
+
     def _build_nodes(self, lines: List["SourceLine"], constants: Dict[str, int]) -> List[LinePlanNode]:
         nodes: List[LinePlanNode] = []
         for source_line in lines:
@@ -492,7 +516,7 @@ class Optimizer:
     ) -> LayoutState:
         guess: Dict[str, int] = {}
         for _ in range(32):
-            labels: Dict[str, int] = {}
+            labels: Dict[str, int] = dict(self.helper.data_labels)
             starts: List[int] = []
             sizes: List[int] = []
             pc = 0
@@ -0,0 +1,385 @@
+"""
+OutputFormats: text renderers for assembled program images.
+"""
+
+from __future__ import annotations
+
+import base64
+import binascii
+import gzip
+import json
+import re
+from typing import Dict, List, Optional, Sequence, Tuple, TypeVar
+
+
+C_IDENTIFIER_RE = re.compile(r"^[A-Za-z_][A-Za-z0-9_]*$")
+
+T = TypeVar("T")
+
+GZIP_MAGIC = b"\x1f\x8b"
+
+# `--split FIRST,SECOND` orders: FIRST takes the bytes at even addresses and SECOND the odd ones, so
+# `hi,lo` splits big-endian 16-bit words and `lo,hi` little-endian ones.
+SPLIT_ORDERS = (("hi", "lo"), ("lo", "hi"), ("even", "odd"))
+
+
+def swap_byte_pairs(byte_values: Sequence[T]) -> List[T]:
+    """Swap each pair of adjacent bytes, for ROMs that read the image as byte-swapped 16-bit words."""
+    if len(byte_values) % 2:
+        raise ValueError(f"Byte swapping needs an even number of bytes, got {len(byte_values)}")
+    swapped: List[T] = []
+    for index in range(0, len(byte_values), 2):
+        swapped.append(byte_values[index + 1])
+        swapped.append(byte_values[index])
+    return swapped
+
+
+def parse_split(text: str) -> Tuple[str, str]:
+    """Parse a `--split` order such as `hi,lo` into the names of the even and odd halves."""
+    parts = tuple(part.strip().lower() for part in text.split(","))
+    if parts not in SPLIT_ORDERS:
+        choices = " / ".join(",".join(order) for order in SPLIT_ORDERS)
+        raise ValueError(f"--split must be one of {choices}, got '{text}'")
+    return parts
+
+
+def split_interleaved(byte_values: bytes) -> Tuple[bytes, bytes]:
+    """Return the bytes at even and at odd addresses, for ROMs built from two 8-bit EEPROMs."""
+    if len(byte_values) % 2:
+        raise ValueError(f"Splitting needs an even number of bytes, got {len(byte_values)}")
+    return bytes(byte_values[0::2]), bytes(byte_values[1::2])
+
+
+def checksum8(data: bytes) -> int:
+    """Return the byte that makes `data` plus itself sum to zero mod 256, as in Intel HEX."""
+    return -sum(data) & 0xFF
+
+
+def crc16(data: bytes) -> int:
+    """CRC-16/CCITT-FALSE: polynomial 0x1021, initial value 0xFFFF, no reflection or final XOR."""
+    return binascii.crc_hqx(data, 0xFFFF)
+
+
+def format_checksum_line(name: str, data: bytes) -> str:
+    """Describe an image by size, 16-bit byte sum (as EPROM programmers show it), and CRC-32."""
+    return f"{name}  {len(data)} bytes  sum16=0x{sum(data) & 0xFFFF:04X}  crc32=0x{binascii.crc32(data):08X}"
+
+
+def length_prefix(byte_count: int, width: int) -> List[int]:
+    """Encode a program length as a `width`-byte little-endian field for loaders that read it first."""
+    if not 1 <= width <= 4:
+        raise ValueError(f"Length prefix width must be 1 to 4 bytes, got {width}")
+    if byte_count >= 1 << (8 * width):
+        raise ValueError(f"Program length {byte_count} does not fit in a {width}-byte length prefix")
+    return [(byte_count >> (8 * index)) & 0xFF for index in range(width)]
+
+
+def parse_rom_size(text: str) -> int:
+    """Parse a ROM size such as `32768`, `0x8000`, or `32K`."""
+    value = text.strip()
+    multiplier = 1
+    if value[-1:] in {"k", "K"}:
+        value, multiplier = value[:-1], 1024
+    try:
+        size = int(value, 0) * multiplier
+    except ValueError as exc:
+        raise ValueError(f"ROM size must be a byte count such as 32768, 0x8000 or 32K, got '{text}'") from exc
+    if size <= 0:
+        raise ValueError(f"ROM size must be positive, got '{text}'")
+    return size
+
+
+def parse_fill_byte(text: str) -> int:
+    """Parse a padding byte such as `0xFF` or `255`."""
+    try:
+        value = int(text.strip(), 0)
+    except ValueError as exc:
+        raise ValueError(f"Fill byte must be a number such as 0xFF, got '{text}'") from exc
+    if not 0 <= value <= 0xFF:
+        raise ValueError(f"Fill byte must be between 0x00 and 0xFF, got '{text}'")
+    return value
+
+
+def group_digits(digits: str, every: int, separator: str = "_") -> str:
+    """Insert `separator` every `every` digits, counting from the least significant end."""
+    if every <= 0:
+        raise ValueError(f"Digit group size must be positive, got {every}")
+    head_length = len(digits) % every or every
+    groups = [digits[:head_length]]
+    groups.extend(digits[start:start + every] for start in range(head_length, len(digits), every))
+    return separator.join(groups)
+
+
+def format_c_array(byte_values: List[int], array_name: str = "rom", source_name: str = "", per_line: int = 12) -> List[str]:
+    """Render program bytes as a C header with a const array and a length macro.
+
+    Args:
+        byte_values: Assembled program bytes
+        array_name: C identifier used for the array; the length macro is NAME_LEN
+        source_name: Optional source file name recorded in the header comment
+        per_line: Number of byte literals per initializer line
+    """
+    if not C_IDENTIFIER_RE.match(array_name):
+        raise ValueError(f"C array name must be a valid C identifier, got '{array_name}'")
+    if not byte_values:
+        raise ValueError("Cannot emit a C array for an empty program")
+
+    length_macro = f"{array_name.upper()}_LEN"
+    guard = f"{array_name.upper()}_H"
+
+    lines: List[str] = []
+    if source_name:
+        lines.append(f"/* Generated by the ArniComp assembler from {source_name} */\n")
+    lines.append(f"#ifndef {guard}\n")
+    lines.append(f"#define {guard}\n")
+    lines.append("\n")
+    lines.append(f"#define {length_macro} {len(byte_values)}\n")
+    lines.append("\n")
+    lines.append(f"const unsigned char {array_name}[{length_macro}] = {{\n")
+    for start in range(0, len(byte_values), per_line):
+        chunk = byte_values[start:start + per_line]
+        literals = ", ".join(f"0x{value & 0xFF:02X}" for value in chunk)
+        lines.append(f"    {literals},\n")
+    lines.append("};\n")
+    lines.append("\n")
+    lines.append(f"#endif /* {guard} */\n")
+    return lines
+
+
+def c_define_name(name: str, prefix: str = "", mangle: bool = False) -> str:
+    """Map an assembler symbol to a C macro name.
+
+    Symbols are already identifiers, but local labels (`SCOPE__NAME`) and names with a leading
+    underscore are reserved in C. `mangle` collapses underscore runs and drops leading ones;
+    without it such names are rejected unless the prefix makes them legal.
+    """
+    if mangle:
+        name = re.sub(r"_{2,}", "_", name).lstrip("_") or "_"
+    full_name = f"{prefix}{name}"
+    if not C_IDENTIFIER_RE.match(full_name):
+        raise ValueError(f"'{full_name}' is not a valid C identifier")
+    if "__" in full_name:
+        raise ValueError(f"'{full_name}' is a reserved C identifier (contains '__'); use --mangle")
+    if re.match(r"^_[A-Z_]", full_name):
+        raise ValueError(f"'{full_name}' is a reserved C identifier (leading underscore); use --mangle or --define-prefix")
+    return full_name
+
+
+def format_c_defines(
+    labels: Dict[str, int],
+    constants: Dict[str, int],
+    guard: str,
+    source_name: str = "",
+    prefix: str = "",
+    mangle: bool = False,
+) -> List[str]:
+    """Render labels and constants as `#define` lines for C code that shares the program's addresses.
+
+    Labels come first by address, as 16-bit hex; constants follow by name, in decimal.
+
+    Args:
+        labels: Label name -> address
+        constants: Constant name -> value
+        guard: Include-guard macro name
+        source_name: Optional source file name recorded in the header comment
+        prefix: Text prepended to every macro name
+        mangle: Rewrite names that are reserved in C instead of rejecting them
+    """
+    if not C_IDENTIFIER_RE.match(guard):
+        raise ValueError(f"Include guard must be a valid C identifier, got '{guard}'")
+
+    seen: Dict[str, str] = {}
+
+    def macro_name(name: str) -> str:
+        mapped = c_define_name(name, prefix, mangle)
+        if mapped in seen and seen[mapped] != name:
+            raise ValueError(f"Symbols {seen[mapped]} and {name} both map to C macro {mapped}")
+        seen[mapped] = name
+        return mapped
+
+    lines: List[str] = []
+    if source_name:
+        lines.append(f"/* Generated by the ArniComp assembler from {source_name} */\n")
+    lines.append(f"#ifndef {guard}\n")
+    lines.append(f"#define {guard}\n")
+    if labels:
+        lines.append("\n")
+        lines.append("/* Labels */\n")
+        for name, address in sorted(labels.items(), key=lambda item: (item[1], item[0])):
+            lines.append(f"#define {macro_name(name)} 0x{address:04X}\n")
+    if constants:
+        lines.append("\n")
+        lines.append("/* Constants */\n")
+        for name, value in sorted(constants.items()):
+            literal = f"({value})" if value < 0 else str(value)
+            lines.append(f"#define {macro_name(name)} {literal}\n")
+    lines.append("\n")
+    lines.append(f"#endif /* {guard} */\n")
+    return lines
+
+
+def format_symbol_file(labels: Dict[str, int], data_labels: Sequence[str] = ()) -> List[str]:
+    """Render code labels as `ADDRESS NAME` lines (4 hex digits), by address then name.
+
+    `.data` labels are RAM addresses that would alias ROM addresses here, so they are left out;
+    the JSON variant carries them with their section.
+    """
+    code_labels = [(address, name) for name, address in labels.items() if name not in data_labels]
+    return [f"{address:04X} {name}\n" for address, name in sorted(code_labels)]
+
+
+def format_symbol_json(labels: Dict[str, int], data_labels: Sequence[str] = (), source_name: str = "") -> str:
+    """Render every label as JSON objects with `name`, `address`, and `section` (`.text` or `.data`)."""
+    symbols = [
+        {"name": name, "address": address, "section": ".data" if name in data_labels else ".text"}
+        for name, address in sorted(labels.items(), key=lambda item: (item[0] in data_labels, item[1], item[0]))
+    ]
+    return json.dumps({"source": source_name, "symbols": symbols}, indent=2) + "\n"
+
+
+def format_mif(byte_values: List[int], depth: Optional[int] = None, source_name: str = "") -> List[str]:
+    """Render program bytes as an Altera/Intel Memory Initialization File (.mif).
+
+    Args:
+        byte_values: Assembled program bytes
+        depth: Memory depth in bytes; addresses past the program are set to 00 (default: program length)
+        source_name: Optional source file name recorded in the header comment
+    """
+    depth = memory_depth(byte_values, depth)
+    lines: List[str] = []
+    if source_name:
+        lines.append(f"-- Generated by the ArniComp assembler from {source_name}\n")
+    lines.append("WIDTH=8;\n")
+    lines.append(f"DEPTH={depth};\n")
+    lines.append("\n")
+    lines.append("ADDRESS_RADIX=HEX;\n")
+    lines.append("DATA_RADIX=HEX;\n")
+    lines.append("\n")
+    lines.append("CONTENT BEGIN\n")
+    for address, value in enumerate(byte_values):
+        lines.append(f"    {address:04X} : {value & 0xFF:02X};\n")
+    if depth > len(byte_values) + 1:
+        lines.append(f"    [{len(byte_values):04X}..{depth - 1:04X}] : 00;\n")
+    elif depth > len(byte_values):
+        lines.append(f"    {len(byte_values):04X} : 00;\n")
+    lines.append("END;\n")
+    return lines
+
+
+def format_coe(byte_values: List[int], depth: Optional[int] = None, source_name: str = "") -> List[str]:
+    """Render program bytes as a Xilinx coefficient file (.coe) for block memory generators.
+
+    Args:
+        byte_values: Assembled program bytes
+        depth: Memory depth in bytes; the vector is padded with 00 up to it (default: program length)
+        source_name: Optional source file name recorded in the header comment
+    """
+    depth = memory_depth(byte_values, depth)
+    padded = [value & 0xFF for value in byte_values] + [0] * (depth - len(byte_values))
+    lines: List[str] = []
+    if source_name:
+        lines.append(f"; Generated by the ArniComp assembler from {source_name}\n")
+    lines.append("memory_initialization_radix=16;\n")
+    lines.append("memory_initialization_vector=\n")
+    for index, value in enumerate(padded):
+        lines.append(f"{value:02X}{';' if index == len(padded) - 1 else ','}\n")
+    return lines
+
+
+def memory_depth(byte_values: List[int], depth: Optional[int]) -> int:
+    if not byte_values:
+        raise ValueError("Cannot emit a memory initialization file for an empty program")
+    if depth is None:
+        return len(byte_values)
+    if depth <= 0:
+        raise ValueError("--depth must be a positive integer")
+    if len(byte_values) > depth:
+        raise ValueError(f"Program has {len(byte_values)} bytes but requested depth is {depth}")
+    return depth
+
+
+def format_logisim_image(byte_values: List[int], per_line: int = 16, min_run: int = 4) -> List[str]:
+    """Render program bytes as a Logisim-evolution memory image (`v2.0 raw`).
+
+    Runs of at least `min_run` equal bytes are written as `COUNT*VALUE`. Trailing zero bytes are
+    dropped, since Logisim clears the rest of the memory when it loads an image.
+
+    Args:
+        byte_values: Assembled program bytes
+        per_line: Number of entries per line
+        min_run: Shortest run written in run-length form
+    """
+    values = [value & 0xFF for value in byte_values]
+    while values and values[-1] == 0:
+        values.pop()
+
+    entries: List[str] = []
+    index = 0
+    while index < len(values):
+        run_end = index
+        while run_end < len(values) and values[run_end] == values[index]:
+            run_end += 1
+        run_length = run_end - index
+        if run_length >= min_run:
+            entries.append(f"{run_length}*{values[index]:x}")
+        else:
+            entries.extend(f"{values[index]:x}" for _ in range(run_length))
+        index = run_end
+
+    lines = ["v2.0 raw\n"]
+    for start in range(0, len(entries), per_line):
+        lines.append(" ".join(entries[start:start + per_line]) + "\n")
+    return lines
+
+
+def encode_base64(byte_values: List[int], compress: bool = False) -> str:
+    """Encode program bytes as one base64 line, optionally gzip-compressed first."""
+    data = bytes(byte_values)
+    if compress:
+        data = gzip.compress(data, mtime=0)
+    return base64.b64encode(data).decode("ascii")
+
+
+def decode_base64(text: str) -> List[int]:
+    """Decode a blob written by encode_base64; gzip-compressed blobs are detected and inflated."""
+    try:
+        data = base64.b64decode("".join(text.split()), validate=True)
+    except binascii.Error as exc:
+        raise ValueError(f"Invalid base64 program blob: {exc}") from exc
+    if data.startswith(GZIP_MAGIC):
+        try:
+            data = gzip.decompress(data)
+        except (OSError, EOFError) as exc:
+            raise ValueError(f"Invalid gzip data in program blob: {exc}") from exc
+    return list(data)
+
+
+def format_records(
+    instructions: List[Tuple[int, List[int]]],
+    record_width: int = 4,
+    pad_byte: int = 0x00,
+) -> List[str]:
+    """Render one fixed-width record per instruction: `AAAA NN B0 B1 ...`.
+
+    Every record carries the same number of byte fields. `NN` is how many of them are program
+    bytes; the rest are `pad_byte`. Instructions longer than the record width continue on
+    further records at the following addresses.
+
+    Args:
+        instructions: (address, bytes) pairs in program order
+        record_width: Number of byte fields per record
+        pad_byte: Filler for unused byte fields
+    """
+    if record_width <= 0:
+        raise ValueError(f"Record width must be positive, got {record_width}")
+    if not 0 <= pad_byte <= 0xFF:
+        raise ValueError(f"Record pad byte must be between 0x00 and 0xFF, got {pad_byte}")
+
+    lines: List[str] = []
+    for address, byte_values in instructions:
+        for start in range(0, len(byte_values), record_width):
+            chunk = byte_values[start:start + record_width]
+            fields = [f"{value & 0xFF:02X}" for value in chunk]
+            fields.extend(f"{pad_byte:02X}" for _ in range(record_width - len(chunk)))
+            lines.append(f"{address + start:04X} {len(chunk):02X} {' '.join(fields)}\n")
+    return lines
@@ -2,11 +2,77 @@ from __future__ import annotations
 
 import os
 import re
-from typing import Callable, Dict, List, Optional, Tuple
+from dataclasses import dataclass
+from typing import Callable, Dict, Iterable, List, Optional, Tuple
 
 from .CommentStripper import CommentStripper
 
 
+DEFAULT_MAX_INCLUDE_DEPTH = 64
+DEFAULT_MAX_MACRO_DEPTH = 32
+MACRO_NAME_RE = re.compile(r"[A-Za-z_][A-Za-z0-9_]*")
+MACRO_CALL_RE = re.compile(r"^(?P<label>\s*\*?[A-Za-z_][A-Za-z0-9_]*:)?\s*(?P<name>[A-Za-z_][A-Za-z0-9_]*)(?:\s+(?P<args>.*))?$")
+MACRO_PARAMETER_RE = re.compile(r"\\(@|[A-Za-z_][A-Za-z0-9_]*)")
+
+
+@dataclass(frozen=True)
+class MacroDefinition:
+    name: str
+    parameters: Tuple[str, ...]
+    body: Tuple[str, ...]
+    source_name: str
+    line_number: int
+    # Default argument text for the trailing parameters declared `name=value`, in order.
+    defaults: Tuple[str, ...] = ()
+
+    @property
+    def required_count(self) -> int:
+        return len(self.parameters) - len(self.defaults)
+
+
+def build_pseudo_instructions(
+    table: Dict[str, object],
+    source_name: str,
+    reserved_names: Iterable[str] = (),
+) -> Dict[str, MacroDefinition]:
+    """Turn a `pseudo_instructions` table from a config file into predefined macros.
+
+    Each entry is `{"parameters": [...], "expansion": [...]}`; expansion lines use the same `\\name`
+    and `\\@` substitutions as a .macro body.
+    """
+    reserved = {name.upper() for name in reserved_names}
+    definitions: Dict[str, MacroDefinition] = {}
+    for raw_name, spec in table.items():
+        name = raw_name.upper()
+        where = f"Invalid pseudo-instruction {raw_name} in {source_name}"
+        if not MACRO_NAME_RE.fullmatch(name):
+            raise ValueError(f"{where}: not a valid name")
+        if name in reserved:
+            raise ValueError(f"{where}: name is an instruction or directive")
+        if not isinstance(spec, dict):
+            raise ValueError(f"{where}: expected an object with 'parameters' and 'expansion'")
+
+        parameters = spec.get("parameters", [])
+        expansion = spec.get("expansion")
+        if not isinstance(parameters, list) or not all(
+            isinstance(parameter, str) and MACRO_NAME_RE.fullmatch(parameter) for parameter in parameters
+        ):
+            raise ValueError(f"{where}: 'parameters' must be a list of names")
+        if len({parameter.upper() for parameter in parameters}) != len(parameters):
+            raise ValueError(f"{where}: duplicate parameter name")
+        if not isinstance(expansion, list) or not expansion or not all(isinstance(line, str) for line in expansion):
+            raise ValueError(f"{where}: 'expansion' must be a non-empty list of source lines")
+
+        definitions[name] = MacroDefinition(
+            name,
+            tuple(parameter.upper() for parameter in parameters),
+            tuple(expansion),
+            source_name,
+            0,
+        )
+    return definitions
+
+
 class Preprocessor:
     """Expand source-level constructs such as includes and repeat blocks."""
 
@@ -15,20 +81,39 @@ class Preprocessor:
         comment_char: str,
         block_comment_start: str,
         block_comment_end: str,
-        source_line_factory: Callable[[int, str, str], object],
+        source_line_factory: Callable[..., object],
         expression_evaluator: Callable[[str, Optional[Dict[str, int]]], int],
+        line_translator: Optional[Callable[[str], str]] = None,
+        argument_splitter: Optional[Callable[[str], List[str]]] = None,
+        reserved_names: Iterable[str] = (),
+        register_names: Iterable[str] = (),
     ) -> None:
         self.comment_char = comment_char
         self.block_comment_start = block_comment_start
         self.block_comment_end = block_comment_end
         self.source_line_factory = source_line_factory
         self.expression_evaluator = expression_evaluator
+        self.line_translator = line_translator
+        self.argument_splitter = argument_splitter or (lambda text: [piece.strip() for piece in text.split(",")])
+        self.reserved_names = {name.upper() for name in reserved_names}
+        self.register_names = {name.upper() for name in register_names}
         self.include_keyword = ".include"
+        # Directories searched, in order, for a relative `.include` not found next to the including file.
+        self.include_paths: List[str] = []
         self.repeat_keyword = ".repeat"
         self.define_keyword = ".define"
         self.if_keyword = ".if"
+        self.ifdef_keyword = ".ifdef"
+        self.ifndef_keyword = ".ifndef"
         self.else_keyword = ".else"
         self.endif_keyword = ".endif"
+        self.macro_keyword = ".macro"
+        self.endm_keyword = ".endm"
+        # Numbers `\@` in macro bodies; the assembler resets it before each build.
+        self.macro_expansion_count = 0
+        # 1-based column where the statement starts on each (file, line) read, for diagnostics;
+        # the assembler resets it before each build.
+        self.statement_columns: Dict[Tuple[str, int], int] = {}
 
     def strip_comments_from_lines(self, lines: List[str], source_name: str) -> List[str]:
         stripper = CommentStripper(
@@ -36,7 +121,10 @@ class Preprocessor:
             block_comment_start=self.block_comment_start,
             block_comment_end=self.block_comment_end,
         )
-        return stripper.strip_lines(lines, source_name=source_name)
+        stripped = stripper.strip_lines(lines, source_name=source_name)
+        if self.line_translator is not None:
+            stripped = [self.line_translator(line) for line in stripped]
+        return stripped
 
     def parse_include_target(self, text: str) -> Optional[str]:
         stripped = text.strip()
@@ -87,15 +175,115 @@ class Preprocessor:
             raise ValueError(f"Invalid .define name: {parts[1]}")
         return name, parts[2].strip()
 
-    def parse_if_condition(self, text: str) -> Optional[str]:
+    def parse_if_condition(self, text: str) -> Optional[Tuple[str, str]]:
+        """Return (keyword, argument) for `.if expr`, `.ifdef NAME`, or `.ifndef NAME`."""
         stripped = text.strip()
         if not stripped:
             return None
 
         parts = stripped.split(None, 1)
-        if len(parts) != 2 or parts[0].lower() != self.if_keyword:
+        keyword = parts[0].lower()
+        if keyword in {self.ifdef_keyword, self.ifndef_keyword}:
+            if len(parts) != 2 or not re.fullmatch(r"[A-Za-z_][A-Za-z0-9_]*", parts[1].strip()):
+                raise ValueError(f"{keyword} requires a single symbol name")
+            return keyword, parts[1].strip().upper()
+        if len(parts) != 2 or keyword != self.if_keyword:
             return None
-        return parts[1].strip()
+        return keyword, parts[1].strip()
+
+    def evaluate_if_condition(self, keyword: str, argument: str, defines: Dict[str, int]) -> bool:
+        if keyword == self.ifdef_keyword:
+            return argument in defines
+        if keyword == self.ifndef_keyword:
+            return argument not in defines
+        return bool(self.expression_evaluator(argument, defines))
+
+    def parse_macro_header(self, text: str) -> Optional[Tuple[str, Tuple[str, ...], Tuple[str, ...]]]:
+        """Return (NAME, PARAMETERS, DEFAULTS) for a `.macro` line, None for other lines."""
+        stripped = text.strip()
+        parts = stripped.split(None, 2)
+        if not parts or parts[0].lower() != self.macro_keyword:
+            return None
+        if len(parts) < 2:
+            raise ValueError(".macro requires a name")
+
+        name = parts[1].upper()
+        if not MACRO_NAME_RE.fullmatch(name):
+            raise ValueError(f"Invalid .macro name: {parts[1]}")
+        if name in self.reserved_names:
+            raise ValueError(f"Macro name {parts[1]} is an instruction or directive")
+        if name in self.register_names:
+            raise ValueError(f"Macro name {parts[1]} is a register")
+
+        parameters: List[str] = []
+        defaults: List[str] = []
+        if len(parts) == 3:
+            for piece in self.argument_splitter(parts[2]):
+                parameter, has_default, default = (text.strip() for text in piece.partition("="))
+                if not MACRO_NAME_RE.fullmatch(parameter):
+                    raise ValueError(f"Invalid .macro parameter name: '{parameter}'")
+                if parameter.upper() in parameters:
+                    raise ValueError(f"Duplicate .macro parameter: {parameter}")
+                if has_default:
+                    if not default:
+                        raise ValueError(f".macro parameter {parameter} has an empty default")
+                    defaults.append(default)
+                elif defaults:
+                    raise ValueError(f".macro parameter {parameter} needs a default because an earlier parameter has one")
+                parameters.append(parameter.upper())
+        return name, tuple(parameters), tuple(defaults)
+
+    def collect_macro_body(
+        self,
+        raw_lines: List[str],
+        sanitized_lines: List[str],
+        start_index: int,
+        source_name: str,
+        line_offset: int = 0,
+    ) -> Tuple[List[str], int]:
+        body: List[str] = []
+        index = start_index
+
+        while index < len(raw_lines):
+            stripped = sanitized_lines[index]
+            keyword = stripped.split(None, 1)[0].lower() if stripped.strip() else ""
+            if keyword == self.endm_keyword:
+                return body, index + 1
+            if keyword == self.macro_keyword:
+                raw_line = raw_lines[index].rstrip("\r\n")
+                raise ValueError(
+                    f"Error on line {source_name}:{line_offset + index + 1} ('{raw_line.strip()}'): "
+                    f"nested .macro definitions are not supported"
+                )
+            body.append(stripped)
+            index += 1
+
+        raise ValueError(f"Error in {source_name}: missing closing '.endm' for .macro block")
+
+    def substitute_macro_arguments(self, macro: MacroDefinition, arguments: List[str], expansion_id: int) -> List[str]:
+        supplied = len(arguments) - macro.required_count
+        values = dict(zip(macro.parameters, [*arguments, *macro.defaults[max(supplied, 0):]]))
+
+        def replace(match: re.Match) -> str:
+            name = match.group(1)
+            if name == "@":
+                return str(expansion_id)
+            return values.get(name.upper(), match.group(0))
+
+        return [MACRO_PARAMETER_RE.sub(replace, line) for line in macro.body]
+
+    def resolve_include_path(self, include_target: str, base_dir: str) -> str:
+        """Absolute path for an `.include`: next to the including file first, then each of include_paths."""
+        if os.path.isabs(include_target):
+            return include_target
+        local_path = os.path.abspath(os.path.join(base_dir, include_target))
+        if os.path.exists(local_path):
+            return local_path
+        for directory in self.include_paths:
+            candidate = os.path.abspath(os.path.join(directory, include_target))
+            if os.path.exists(candidate):
+                return candidate
+        return local_path
 
     def expand(
         self,
@@ -103,9 +291,23 @@ class Preprocessor:
         source_name: str = "<input>",
         include_stack: Optional[Tuple[str, ...]] = None,
         defines: Optional[Dict[str, int]] = None,
+        line_offset: int = 0,
+        max_include_depth: int = DEFAULT_MAX_INCLUDE_DEPTH,
+        max_macro_depth: int = DEFAULT_MAX_MACRO_DEPTH,
+        macros: Optional[Dict[str, MacroDefinition]] = None,
+        macro_stack: Tuple[str, ...] = (),
     ) -> List[object]:
+        """Expand includes, defines, conditionals, macros, and repeat blocks.
+
+        `line_offset` is the number of lines of `source_name` before `raw_lines`, so lines of an
+        `.if` or `.repeat` body keep their position in the file. Includes may nest at most
+        `max_include_depth` files below the root, and macro invocations at most `max_macro_depth`
+        deep. Macros are shared with included files and are visible from their definition
+        onwards; `macro_stack` lists the invocations being expanded.
+        """
         include_stack = include_stack or tuple()
         defines = defines if defines is not None else {}
+        macros = macros if macros is not None else {}
         normalized_source = os.path.abspath(source_name) if source_name != "<input>" else source_name
         sanitized_lines = self.strip_comments_from_lines(raw_lines, source_name)
 
@@ -120,8 +322,10 @@ class Preprocessor:
         while index < len(raw_lines):
             raw_line = raw_lines[index].rstrip("\r\n")
             sanitized_line = sanitized_lines[index]
-            line_number = index + 1
+            line_number = line_offset + index + 1
             stripped = sanitized_line
+            column = len(raw_line) - len(raw_line.lstrip()) + 1
+            self.statement_columns.setdefault((source_name, line_number), column)
 
             try:
                 include_target = self.parse_include_target(sanitized_line)
@@ -129,14 +333,27 @@ class Preprocessor:
                 raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): {exc}") from exc
 
             if include_target is not None:
-                include_path = include_target
-                if not os.path.isabs(include_path):
-                    include_path = os.path.abspath(os.path.join(base_dir, include_target))
+                include_path = self.resolve_include_path(include_target, base_dir)
+
+                if include_path == normalized_source or include_path in include_stack:
+                    chain = " -> ".join([*include_stack, normalized_source, include_path])
+                    raise ValueError(
+                        f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): "
+                        f"Recursive include detected: {chain}"
+                    )
+
+                if len(include_stack) >= max_include_depth:
+                    chain = " -> ".join([*include_stack, normalized_source, include_path])
+                    raise ValueError(
+                        f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): "
+                        f"Include depth limit of {max_include_depth} exceeded: {chain}"
+                    )
 
                 if not os.path.exists(include_path):
+                    searched = f" (also searched: {', '.join(self.include_paths)})" if self.include_paths else ""
                     raise ValueError(
                         f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): "
-                        f"Included file not found: {include_target}"
+                        f"Included file not found: {include_target}{searched}"
                     )
 
                 try:
@@ -154,6 +371,10 @@ class Preprocessor:
                         source_name=include_path,
                         include_stack=(*include_stack, normalized_source),
                         defines=defines,
+                        max_include_depth=max_include_depth,
+                        max_macro_depth=max_macro_depth,
+                        macros=macros,
+                        macro_stack=macro_stack,
                     )
                 )
                 index += 1
@@ -174,19 +395,19 @@ class Preprocessor:
                 continue
 
             try:
-                if_expr = self.parse_if_condition(sanitized_line)
+                if_condition = self.parse_if_condition(sanitized_line)
             except ValueError as exc:
                 raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): {exc}") from exc
 
-            if if_expr is not None:
-                true_lines, false_lines, next_index = self.collect_if_blocks(
+            if if_condition is not None:
+                true_lines, false_lines, false_start, next_index = self.collect_if_blocks(
                     raw_lines,
                     sanitized_lines,
                     index + 1,
                     source_name,
                 )
                 try:
-                    condition_value = self.expression_evaluator(if_expr, defines)
+                    condition_value = self.evaluate_if_condition(*if_condition, defines)
                 except ValueError as exc:
                     raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): {exc}") from exc
                 selected = true_lines if condition_value else false_lines
@@ -196,6 +417,11 @@ class Preprocessor:
                         source_name=source_name,
                         include_stack=include_stack,
                         defines=defines,
+                        max_include_depth=max_include_depth,
+                        max_macro_depth=max_macro_depth,
+                        line_offset=line_offset + (index + 1 if condition_value else false_start),
+                        macros=macros,
+                        macro_stack=macro_stack,
                     )
                 )
                 index = next_index
@@ -213,19 +439,100 @@ class Preprocessor:
                 raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): {exc}") from exc
 
             if repeat_count is not None:
-                block_lines, next_index = self.collect_repeat_block(raw_lines, sanitized_lines, index + 1, source_name, defines)
+                block_lines, next_index = self.collect_repeat_block(
+                    raw_lines, sanitized_lines, index + 1, source_name, defines, line_offset
+                )
                 expanded_block = self.expand(
                     block_lines,
                     source_name=source_name,
                     include_stack=include_stack,
                     defines=defines,
+                    line_offset=line_offset + index + 1,
+                    max_include_depth=max_include_depth,
+                    max_macro_depth=max_macro_depth,
+                    macros=macros,
+                    macro_stack=macro_stack,
                 )
                 for _ in range(repeat_count):
                     expanded.extend(expanded_block)
                 index = next_index
                 continue
 
-            expanded.append(self.source_line_factory(line_number, sanitized_line, source_name))
+            try:
+                macro_header = self.parse_macro_header(sanitized_line)
+            except ValueError as exc:
+                raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): {exc}") from exc
+
+            if macro_header is not None:
+                name, parameters, defaults = macro_header
+                body, next_index = self.collect_macro_body(raw_lines, sanitized_lines, index + 1, source_name, line_offset)
+                previous = macros.get(name)
+                if previous is not None:
+                    # Pseudo-instructions from a config file carry line 0.
+                    where = (
+                        f"as a pseudo-instruction in {previous.source_name}"
+                        if previous.line_number == 0
+                        else f"on line {previous.source_name}:{previous.line_number}"
+                    )
+                    raise ValueError(
+                        f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): "
+                        f"Macro {name} is already defined {where}"
+                    )
+                macros[name] = MacroDefinition(name, parameters, tuple(body), source_name, line_number, defaults)
+                index = next_index
+                continue
+
+            if stripped.strip() and stripped.split(None, 1)[0].lower() == self.endm_keyword:
+                raise ValueError(f"Error on line {source_name}:{line_number} ('{raw_line.strip()}'): unexpected .endm")
+
+            call = MACRO_CALL_RE.match(sanitized_line) if macros else None
+            if call is not None and call.group("name").upper() in macros:
+                macro = macros[call.group("name").upper()]
+                location = f"Error on line {source_name}:{line_number} ('{raw_line.strip()}')"
+                arguments = self.argument_splitter(call.group("args") or "")
+                if arguments == [""]:
+                    arguments = []
+                if not macro.required_count <= len(arguments) <= len(macro.parameters):
+                    expected = (
+                        f"{macro.required_count} to {len(macro.parameters)}" if macro.defaults else str(len(macro.parameters))
+                    )
+                    raise ValueError(f"{location}: Macro {macro.name} expects {expected} argument(s), got {len(arguments)}")
+                if len(macro_stack) >= max_macro_depth or macro.name in macro_stack:
+                    chain = " -> ".join([*macro_stack, macro.name])
+                    reason = "is recursive" if macro.name in macro_stack else f"exceeds the nesting limit of {max_macro_depth}"
+                    raise ValueError(f"{location}: Macro expansion {reason}: {chain}")
+
+                if call.group("label"):
+                    expanded.append(self.source_line_factory(line_number, call.group("label").strip(), source_name, column=column))
+                self.macro_expansion_count += 1
+                body = self.substitute_macro_arguments(macro, arguments, self.macro_expansion_count)
+                expanded_body = self.expand(
+                    body,
+                    source_name=macro.source_name,
+                    include_stack=include_stack,
+                    defines=defines,
+                    line_offset=macro.line_number,
+                    max_include_depth=max_include_depth,
+                    max_macro_depth=max_macro_depth,
+                    macros=macros,
+                    macro_stack=(*macro_stack, macro.name),
+                )
+                # Report every line of the expansion at the invocation, where the arguments are,
+                # and keep where in the macro body it came from for source maps.
+                expanded.extend(
+                    self.source_line_factory(
+                        line_number,
+                        line.text,
+                        source_name,
+                        expansion=((macro.name, line.source_name, line.line_number), *line.expansion),
+                        column=column,
+                    )
+                    for line in expanded_body
+                )
+                index += 1
+                continue
+
+            expanded.append(self.source_line_factory(line_number, sanitized_line, source_name, column=column))
             index += 1
 
         return expanded
@@ -237,6 +544,7 @@ class Preprocessor:
         start_index: int,
         source_name: str,
         defines: Dict[str, int],
+        line_offset: int = 0,
     ) -> Tuple[List[str], int]:
         block_lines: List[str] = []
         depth = 1
@@ -251,7 +559,7 @@ class Preprocessor:
                 try:
                     repeat_count = self.parse_repeat_count(stripped, defines)
                 except ValueError as exc:
-                    raise ValueError(f"Error on line {source_name}:{index + 1} ('{raw_line.strip()}'): {exc}") from exc
+                    raise ValueError(f"Error on line {source_name}:{line_offset + index + 1} ('{raw_line.strip()}'): {exc}") from exc
 
             if repeat_count is not None:
                 depth += 1
@@ -278,9 +586,11 @@ class Preprocessor:
         sanitized_lines: List[str],
         start_index: int,
         source_name: str,
-    ) -> Tuple[List[str], List[str], int]:
+    ) -> Tuple[List[str], List[str], int, int]:
+        """Split an .if body at its .else; also return where the .else body starts and the next index."""
         true_lines: List[str] = []
         false_lines: List[str] = []
+        false_start = start_index
         active = true_lines
         depth = 1
         index = start_index
@@ -289,7 +599,7 @@ class Preprocessor:
             stripped = sanitized_lines[index]
 
             if stripped:
-                if self.parse_if_condition(stripped) is not None:
+                if stripped.split(None, 1)[0].lower() in {self.if_keyword, self.ifdef_keyword, self.ifndef_keyword}:
                     depth += 1
                     active.append(stripped)
                     index += 1
@@ -298,6 +608,7 @@ class Preprocessor:
                 if stripped == self.else_keyword:
                     if depth == 1:
                         active = false_lines
+                        false_start = index + 1
                         index += 1
                         continue
                     active.append(stripped)
@@ -307,7 +618,7 @@ class Preprocessor:
                 if stripped == self.endif_keyword:
                     depth -= 1
                     if depth == 0:
-                        return true_lines, false_lines, index + 1
+                        return true_lines, false_lines, false_start, index + 1
                     active.append(stripped)
                     index += 1
                     continue
@@ -0,0 +1,63 @@
+"""
+ProgramTests: run the `.test` blocks of a program in the emulator, driven by the `test` command.
+
+    .test adds_with_carry
+        LDI #7
+        MOV RD, RA
+        ADDI #1
+        .assert ACC == 8, "7 + 1"
+    .endtest
+
+Each test runs in a fresh emulator from the first instruction of its block, with zeroed RAM and
+its own devices, so tests cannot see each other's state. A test passes when it reaches the `HLT`
+that `.endtest` assembles to. A false `.assert`, in the block or in code it calls, fails it, and
+so does any other stop: a `HLT` elsewhere, an idle loop, or the step limit.
+"""
+
+from __future__ import annotations
+
+from dataclasses import dataclass
+from typing import Callable, Collection, List
+
+from .AssemblyHelper import ProgramTest
+from .Emulator import DEFAULT_MAX_STEPS, Emulator
+
+
+@dataclass(frozen=True)
+class TestOutcome:
+    test: ProgramTest
+    passed: bool
+    reason: str
+    steps: int
+    cycles: int
+
+
+def run_tests(
+    make_emulator: Callable[[], Emulator],
+    tests: Collection[ProgramTest],
+    max_steps: int = DEFAULT_MAX_STEPS,
+) -> List[TestOutcome]:
+    outcomes: List[TestOutcome] = []
+    for test in tests:
+        emulator = make_emulator()
+        emulator.pc = test.start
+        try:
+            result = emulator.run(max_steps)
+            passed, reason = emulator.halted and emulator.pc == test.end, result.reason
+        except ValueError as exc:
+            passed, reason = False, f"emulation error at 0x{emulator.pc:04X}: {exc}"
+        outcomes.append(TestOutcome(test, passed, reason, emulator.steps, emulator.cycles))
+    return outcomes
+
+
+def format_outcomes(outcomes: Collection[TestOutcome]) -> List[str]:
+    lines = []
+    for outcome in outcomes:
+        test = outcome.test
+        if outcome.passed:
+            lines.append(f"PASS  {test.name} ({outcome.steps} steps, {outcome.cycles} cycles)")
+        else:
+            lines.append(f"FAIL  {test.name} ({test.source_name}:{test.line_number}): {outcome.reason}")
+    failed = sum(not outcome.passed for outcome in outcomes)
+    lines.append(f"{len(outcomes)} tests, {len(outcomes) - failed} passed, {failed} failed")
+    return lines
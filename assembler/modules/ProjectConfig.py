@@ -0,0 +1,132 @@
+"""
+ProjectConfig: discover and parse a per-project `.asmconfig` file.
+
+The file is JSON and may set any of:
+
+    {
+        "syntax": "gnu",
+        "comment": "//",
+        "block_comment_start": "/*",
+        "block_comment_end": "*/",
+        "optimize": true,
+        "listing_mode": "both",
+        "crlf": false,
+        "target": "arnicomp-v1",
+        "include_paths": ["lib", "../shared"],
+        "pseudo_instructions": {
+            "SETB": {"parameters": ["value"], "expansion": ["LDI \\value", "MOV RB, RA"]}
+        }
+    }
+
+Precedence is command-line flags > .asmconfig > config/config.json defaults. Explicit comment
+keys override the markers that come with "syntax". "pseudo_instructions" adds to, or replaces,
+the pseudo-instructions defined in config/config.json. Relative "include_paths" are taken from the
+directory holding the .asmconfig, not the current directory.
+
+"endianness" is rejected rather than ignored: ArniComp instructions are single bytes and the
+multi-byte fields the assembler writes (--length-prefix, --append-crc) are always little-endian,
+so there is no byte order to choose. --byteswap covers loaders that want 16-bit words swapped,
+and `.endian big` in the source covers `.word` tables.
+"""
+
+from __future__ import annotations
+
+from dataclasses import dataclass
+import json
+import os
+from typing import Dict, List, Optional
+
+from .AssemblyHelper import KNOWN_MNEMONICS
+from .Preprocessor import MacroDefinition, build_pseudo_instructions
+from .SyntaxProfiles import SYNTAX_PROFILES
+from .Targets import normalize_target
+
+
+PROJECT_CONFIG_NAME = ".asmconfig"
+STRING_KEYS = {"comment": "comment_char", "block_comment_start": "block_comment_start", "block_comment_end": "block_comment_end"}
+BOOL_KEYS = {"optimize", "crlf"}
+LISTING_MODES = {"hex", "asm", "both", "bitfields"}
+
+
+@dataclass
+class ProjectConfig:
+    path: str
+    comment_char: Optional[str] = None
+    block_comment_start: Optional[str] = None
+    block_comment_end: Optional[str] = None
+    optimize: Optional[bool] = None
+    listing_mode: Optional[str] = None
+    crlf: Optional[bool] = None
+    syntax: Optional[str] = None
+    pseudo_instructions: Optional[Dict[str, MacroDefinition]] = None
+    target: Optional[str] = None
+    include_paths: Optional[List[str]] = None
+
+
+def find_project_config(start_dir: str) -> Optional[str]:
+    """Return the nearest .asmconfig in start_dir or one of its parents."""
+    current = os.path.abspath(start_dir)
+    while True:
+        candidate = os.path.join(current, PROJECT_CONFIG_NAME)
+        if os.path.isfile(candidate):
+            return candidate
+        parent = os.path.dirname(current)
+        if parent == current:
+            return None
+        current = parent
+
+
+def load_project_config(path: str) -> ProjectConfig:
+    try:
+        with open(path, "r", encoding="utf-8") as f:
+            data = json.load(f)
+    except json.JSONDecodeError as exc:
+        raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: {exc.msg} at line {exc.lineno}") from exc
+
+    if not isinstance(data, dict):
+        raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: expected a JSON object")
+
+    config = ProjectConfig(path=path)
+    for key, value in data.items():
+        if key in STRING_KEYS:
+            if not isinstance(value, str) or not value:
+                raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: '{key}' must be a non-empty string")
+            setattr(config, STRING_KEYS[key], value)
+        elif key in BOOL_KEYS:
+            if not isinstance(value, bool):
+                raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: '{key}' must be true or false")
+            setattr(config, key, value)
+        elif key == "syntax":
+            if not isinstance(value, str) or value.lower() not in SYNTAX_PROFILES:
+                raise ValueError(
+                    f"Invalid {PROJECT_CONFIG_NAME} {path}: 'syntax' must be one of: {', '.join(SYNTAX_PROFILES)}"
+                )
+            config.syntax = value.lower()
+        elif key == "listing_mode":
+            if value not in LISTING_MODES:
+                raise ValueError(
+                    f"Invalid {PROJECT_CONFIG_NAME} {path}: 'listing_mode' must be one of: {', '.join(sorted(LISTING_MODES))}"
+                )
+            config.listing_mode = value
+        elif key == "pseudo_instructions":
+            if not isinstance(value, dict):
+                raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: 'pseudo_instructions' must be a JSON object")
+            config.pseudo_instructions = build_pseudo_instructions(value, path, KNOWN_MNEMONICS)
+        elif key == "target":
+            try:
+                config.target = normalize_target(value if isinstance(value, str) else repr(value))
+            except ValueError as exc:
+                raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: 'target': {exc}") from exc
+        elif key == "include_paths":
+            if not isinstance(value, list) or not all(isinstance(entry, str) and entry for entry in value):
+                raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: 'include_paths' must be a list of directory names")
+            config_dir = os.path.dirname(os.path.abspath(path))
+            config.include_paths = [os.path.normpath(os.path.join(config_dir, entry)) for entry in value]
+        elif key == "endianness":
+            raise ValueError(
+                f"Invalid {PROJECT_CONFIG_NAME} {path}: 'endianness' is not supported; instructions are single bytes "
+                "and multi-byte fields are always little-endian (use --byteswap to swap 16-bit words, or .endian big for .word tables)"
+            )
+        else:
+            raise ValueError(f"Invalid {PROJECT_CONFIG_NAME} {path}: unknown key '{key}'")
+    return config
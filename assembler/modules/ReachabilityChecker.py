@@ -0,0 +1,134 @@
+from __future__ import annotations
+
+import re
+from typing import Dict, List, Optional, Set, TYPE_CHECKING, Tuple
+
+
+if TYPE_CHECKING:
+    from .AssemblyHelper import AssemblyHelper, ListingEntry
+
+
+CONDITIONAL_JUMPS = {"JEQ", "JNE", "JCS", "JCC", "JMI", "JVS", "JLT", "JGT", "JLE", "JGE", "JLEU", "JGTU"}
+UNCONDITIONAL_JUMPS = {"JMP", "JMPA"}
+LAYOUT_DIRECTIVES = {
+    ".FILL", ".ORG", ".PADTO", ".ALIGN", ".CHECKSUM", ".CRC16", ".BYTE", ".WORD", ".ASCII", ".ASCIIZ", ".SPACE",
+}
+LABEL_REF_RE = re.compile(r"@?([A-Za-z_][A-Za-z0-9_]*)")
+
+
+class ReachabilityChecker:
+    """Warn about code that static control flow from address 0x0000 never reaches.
+
+    Jumps are followed through their assembler-level target operands. Bare
+    jumps through PRH:PRL and RET cannot be resolved statically, so every
+    label whose address is loaded as a value is treated as reachable too.
+    """
+
+    def __init__(self, helper: "AssemblyHelper") -> None:
+        self.helper = helper
+
+    def find_unreachable(
+        self,
+        listing: List["ListingEntry"],
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+    ) -> List[str]:
+        rows: List[Tuple["ListingEntry", str, List[str]]] = []
+        for entry in listing:
+            _, instruction_text = self.helper.split_label_prefix(entry.source_text)
+            instruction, args = self.helper.parse_instruction(instruction_text)
+            instruction, args = self.helper.normalize_instruction(instruction, args)
+            rows.append((entry, instruction, args))
+
+        index_by_address = {entry.address: index for index, (entry, _, _) in enumerate(rows)}
+        roots: Set[int] = {0}
+        successors: List[List[int]] = []
+
+        for entry, instruction, args in rows:
+            fallthrough = entry.address + len(entry.binary_bytes)
+            target, target_token = self.resolve_transfer_target(instruction, args, labels, constants)
+            roots.update(self.address_taken_labels(args, target_token, labels))
+
+            if instruction == "HLT":
+                successors.append([])
+            elif instruction in UNCONDITIONAL_JUMPS or instruction == "RET":
+                successors.append([target] if target is not None else [])
+            elif instruction in CONDITIONAL_JUMPS or instruction in {"CALL", "JAL"}:
+                successors.append([fallthrough] + ([target] if target is not None else []))
+            else:
+                successors.append([fallthrough])
+
+        reachable: Set[int] = set()
+        worklist = [index_by_address[address] for address in roots if address in index_by_address]
+        while worklist:
+            index = worklist.pop()
+            if index in reachable:
+                continue
+            reachable.add(index)
+            for address in successors[index]:
+                next_index = index_by_address.get(address)
+                if next_index is not None and next_index not in reachable:
+                    worklist.append(next_index)
+
+        warnings: List[str] = []
+        run: List["ListingEntry"] = []
+        for index, (entry, instruction, _) in enumerate(rows):
+            if run and entry.source_name != run[-1].source_name:
+                self.flush_run(run, warnings)
+                run = []
+            if index not in reachable and instruction not in LAYOUT_DIRECTIVES:
+                run.append(entry)
+                continue
+            if instruction in LAYOUT_DIRECTIVES and index not in reachable and run:
+                continue
+            self.flush_run(run, warnings)
+            run = []
+        self.flush_run(run, warnings)
+        return warnings
+
+    def resolve_transfer_target(
+        self,
+        instruction: str,
+        args: List[str],
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+    ) -> Tuple[Optional[int], Optional[str]]:
+        is_transfer = instruction in CONDITIONAL_JUMPS or instruction in UNCONDITIONAL_JUMPS or instruction == "CALL"
+        if not is_transfer or not args:
+            return None, None
+
+        core_args, _ = self.helper.macro_expander.parse_temp_register_suffix(args, instruction)
+        target_token = core_args[0]
+        try:
+            resolved = self.helper.resolve_value(target_token, labels, constants)
+        except ValueError:
+            return None, target_token
+        return resolved.value, target_token
+
+    def address_taken_labels(
+        self,
+        args: List[str],
+        target_token: Optional[str],
+        labels: Dict[str, int],
+    ) -> Set[int]:
+        addresses: Set[int] = set()
+        for arg in args:
+            if arg == target_token:
+                continue
+            for match in LABEL_REF_RE.finditer(arg):
+                name = match.group(1).upper()
+                if name in labels:
+                    addresses.add(labels[name])
+        return addresses
+
+    def flush_run(self, run: List["ListingEntry"], warnings: List[str]) -> None:
+        if not run:
+            return
+        first = run[0]
+        last = run[-1]
+        end_address = last.address + len(last.binary_bytes) - 1
+        warnings.append(
+            f"Line {first.source_name}:{first.line_number}-{last.line_number}: "
+            f"unreachable code at 0x{first.address:04X}-0x{end_address:04X} "
+            "(not reached from 0x0000 by static control flow)"
+        )
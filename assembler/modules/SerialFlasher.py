@@ -0,0 +1,61 @@
+"""
+SerialFlasher: stream a ROM image to the Arduino EEPROM programmer, driven by the `flash` command.
+
+This speaks the programmer's load protocol, the one `load` (EepromLoader) uses:
+
+    host -> programmer
+    'L'                     start a load; the programmer needs READY_DELAY to get ready
+    IMAGE[0..N-1]           the raw image from address 0x0000, with no length or framing
+
+The programmer sends no reply, so a dropped or corrupted byte cannot be detected or resent here.
+`flash` prints the size, 16-bit sum, and CRC-32 of what it sent instead, to compare with what the
+programmer or an EEPROM reader reports.
+"""
+
+from __future__ import annotations
+
+import time
+from typing import Callable, Dict, Optional
+
+
+LOAD = b"L"
+DEFAULT_BAUD = 115200
+# The byte sent for addresses the program leaves empty, as createbin pads by default.
+DEFAULT_FILL = 0x00
+# Bytes written between progress reports.
+CHUNK_SIZE = 64
+# How long the programmer takes to get ready after 'L', as in EepromLoader.write.
+READY_DELAY = 0.1
+# Opening the port resets most Arduino boards; this is how long their bootloader takes to hand over.
+RESET_DELAY = 2.0
+
+
+def flatten_image(image: Dict[int, int], fill: int = DEFAULT_FILL) -> bytes:
+    """Return the bytes from 0x0000 through the last used address, with `fill` in the gaps."""
+    if not image:
+        return b""
+    data = bytearray([fill]) * (max(image) + 1)
+    for address, value in image.items():
+        data[address] = value
+    return bytes(data)
+
+
+class SerialFlasher:
+    """Drive the programmer over `port`: anything with pyserial's `write` and `flush`."""
+
+    def __init__(self, port, ready_delay: float = READY_DELAY) -> None:
+        self.port = port
+        self.ready_delay = ready_delay
+
+    def flash(self, data: bytes, progress: Optional[Callable[[int, int], None]] = None) -> int:
+        """Send `data` as one load and return how many bytes were sent."""
+        self.port.write(LOAD)
+        self.port.flush()
+        time.sleep(self.ready_delay)
+        for start in range(0, len(data), CHUNK_SIZE):
+            chunk = data[start:start + CHUNK_SIZE]
+            self.port.write(chunk)
+            if progress is not None:
+                progress(start + len(chunk), len(data))
+        self.port.flush()
+        return len(data)
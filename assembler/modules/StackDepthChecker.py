@@ -0,0 +1,126 @@
+from __future__ import annotations
+
+from dataclasses import dataclass, field
+from typing import Dict, List, TYPE_CHECKING, Tuple
+
+from .ReachabilityChecker import CONDITIONAL_JUMPS, LAYOUT_DIRECTIVES, UNCONDITIONAL_JUMPS
+
+
+if TYPE_CHECKING:
+    from .AssemblyHelper import AssemblyHelper, ListingEntry
+
+
+@dataclass
+class StackDepthRoot:
+    name: str
+    address: int
+    max_depth: int = 0
+    min_depth: int = 0
+
+
+@dataclass
+class StackDepthReport:
+    roots: List[StackDepthRoot] = field(default_factory=list)
+    warnings: List[str] = field(default_factory=list)
+
+
+class StackDepthChecker:
+    """Track the running PUSH/POP depth along static control flow.
+
+    Analysis starts at 0x0000 and, separately, at every CALL target, each at depth 0.
+    A CALL itself is depth-neutral: the callee is measured on its own and control
+    continues after the call. Each emitted byte is decoded, so PUSHI, PUSHSTR, and
+    RET :STACK are counted through the PUSH/POP instructions they expand to.
+
+    Warnings cover a POP below depth 0 on the path from 0x0000, and join points that
+    are reached with different depths (including loops that push on every pass).
+    CALL targets may pop what their caller pushed, so underflow is not reported there.
+    Bare jumps and RET end a path; their targets cannot be resolved statically.
+    """
+
+    def __init__(self, helper: "AssemblyHelper") -> None:
+        self.helper = helper
+
+    def analyze(
+        self,
+        listing: List["ListingEntry"],
+        labels: Dict[str, int],
+        constants: Dict[str, int],
+    ) -> StackDepthReport:
+        checker = self.helper.reachability_checker
+        rows: List[Tuple["ListingEntry", List[int], List[int]]] = []
+        call_targets: Dict[int, str] = {}
+        for entry in listing:
+            _, instruction_text = self.helper.split_label_prefix(entry.source_text)
+            instruction, args = self.helper.parse_instruction(instruction_text)
+            instruction, args = self.helper.normalize_instruction(instruction, args)
+            target, target_token = checker.resolve_transfer_target(instruction, args, labels, constants)
+            fallthrough = entry.address + len(entry.binary_bytes)
+
+            if instruction == "HLT":
+                successors: List[int] = []
+            elif instruction in UNCONDITIONAL_JUMPS or instruction == "RET":
+                successors = [target] if target is not None else []
+            elif instruction in CONDITIONAL_JUMPS:
+                successors = [fallthrough] + ([target] if target is not None else [])
+            else:
+                successors = [fallthrough]
+
+            if instruction == "CALL" and target is not None:
+                call_targets.setdefault(target, (target_token or "").lstrip("@").upper())
+
+            effects = [] if instruction in LAYOUT_DIRECTIVES else [self.stack_effect(binary) for binary in entry.binary_bytes]
+            rows.append((entry, effects, successors))
+
+        index_by_address = {entry.address: index for index, (entry, _, _) in enumerate(rows)}
+        report = StackDepthReport()
+        roots = [("entry", 0)] + [(name, address) for address, name in sorted(call_targets.items()) if address != 0]
+        reported_lines = set()
+
+        for name, address in roots:
+            root = StackDepthRoot(name=name, address=address)
+            report.roots.append(root)
+            start = index_by_address.get(address)
+            if start is None:
+                continue
+
+            depth_at: Dict[int, int] = {}
+            worklist = [(start, 0)]
+            while worklist:
+                index, depth = worklist.pop()
+                entry, effects, successors = rows[index]
+                if index in depth_at:
+                    if depth_at[index] != depth and (index, "join") not in reported_lines:
+                        reported_lines.add((index, "join"))
+                        report.warnings.append(
+                            f"Line {entry.source_name}:{entry.line_number}: stack depth differs where paths join "
+                            f"({min(depth_at[index], depth)} vs {max(depth_at[index], depth)} from {name})"
+                        )
+                    continue
+                depth_at[index] = depth
+
+                for effect in effects:
+                    depth += effect
+                    root.max_depth = max(root.max_depth, depth)
+                    root.min_depth = min(root.min_depth, depth)
+                    if effect < 0 and depth < 0 and name == "entry" and (index, "underflow") not in reported_lines:
+                        reported_lines.add((index, "underflow"))
+                        report.warnings.append(
+                            f"Line {entry.source_name}:{entry.line_number}: POP without a matching PUSH "
+                            f"(stack depth {depth} on the path from 0x0000)"
+                        )
+
+                for successor in successors:
+                    next_index = index_by_address.get(successor)
+                    if next_index is not None:
+                        worklist.append((next_index, depth))
+
+        return report
+
+    def stack_effect(self, binary: str) -> int:
+        mnemonic = self.helper.disassemble(binary).split()[0]
+        if mnemonic == "PUSH":
+            return 1
+        if mnemonic == "POP":
+            return -1
+        return 0
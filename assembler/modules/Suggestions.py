@@ -0,0 +1,37 @@
+"""
+Suggestions: "did you mean" hints for misspelled names.
+"""
+
+from __future__ import annotations
+
+from typing import Iterable, Optional
+
+
+def edit_distance(left: str, right: str) -> int:
+    """Optimal string alignment distance: insertions, deletions, substitutions, and adjacent swaps."""
+    previous_previous: list[int] = []
+    previous = list(range(len(right) + 1))
+    for i in range(1, len(left) + 1):
+        current = [i] + [0] * len(right)
+        for j in range(1, len(right) + 1):
+            cost = 0 if left[i - 1] == right[j - 1] else 1
+            current[j] = min(previous[j] + 1, current[j - 1] + 1, previous[j - 1] + cost)
+            if i > 1 and j > 1 and left[i - 1] == right[j - 2] and left[i - 2] == right[j - 1]:
+                current[j] = min(current[j], previous_previous[j - 2] + 1)
+        previous_previous, previous = previous, current
+    return previous[len(right)]
+
+
+def closest_match(name: str, candidates: Iterable[str], max_distance: int = 2) -> Optional[str]:
+    """Return the candidate nearest to `name`, or None when nothing is close enough.
+
+    Names of four characters or fewer only match candidates one edit away.
+    """
+    limit = 1 if len(name) <= 4 else max_distance
+    best: Optional[str] = None
+    best_distance = limit + 1
+    for candidate in sorted(set(candidates)):
+        distance = edit_distance(name.upper(), candidate.upper())
+        if distance < best_distance:
+            best, best_distance = candidate, distance
+    return best
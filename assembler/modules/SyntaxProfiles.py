@@ -0,0 +1,108 @@
+"""
+SyntaxProfiles: bundles of parsing options for users coming from other assemblers.
+
+A profile sets the comment markers, enables suffix number literals (`0FFh`, `1010b`), and maps
+directive spellings onto the native ones. An alias containing `{args}` is a template for the whole
+directive, for dialects whose form differs (`REPT n` -> `.repeat n {`). Translation runs on
+comment-stripped lines before preprocessing, so it applies to included files and preprocessor
+directives too.
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass, field
+from typing import Dict, Optional
+
+
+SUFFIX_HEX_RE = re.compile(r"(?<![\w.])([0-9][0-9A-Fa-f]*)[hH]\b")
+SUFFIX_BINARY_RE = re.compile(r"(?<![\w.])([01]+)[bB]\b")
+STRING_OR_CHAR_RE = re.compile(r"\"(?:\\.|[^\"\\])*\"|'(?:\\.|[^'\\])*'")
+LEADING_LABEL_RE = re.compile(r"^(\s*\*?[A-Za-z_][A-Za-z0-9_]*:\s*)?(\S+)")
+
+
+@dataclass(frozen=True)
+class SyntaxProfile:
+    name: str
+    description: str
+    comment_char: str = ";"
+    block_comment_start: str = "/*"
+    block_comment_end: str = "*/"
+    suffix_numbers: bool = False
+    directive_aliases: Dict[str, str] = field(default_factory=dict)
+
+    def translate(self, line: str) -> str:
+        """Rewrite one comment-free line into native syntax."""
+        if not line.strip():
+            return line
+
+        if self.directive_aliases:
+            match = LEADING_LABEL_RE.match(line)
+            if match is not None:
+                native = self.directive_aliases.get(match.group(2).upper())
+                if native is not None and "{args}" in native:
+                    line = line[:match.start(2)] + native.replace("{args}", line[match.end(2):].strip())
+                elif native is not None:
+                    line = f"{line[:match.start(2)]}{native}{line[match.end(2):]}"
+
+        if self.suffix_numbers:
+            pieces = []
+            last_end = 0
+            for literal in STRING_OR_CHAR_RE.finditer(line):
+                pieces.append(self.translate_numbers(line[last_end:literal.start()]))
+                pieces.append(literal.group(0))
+                last_end = literal.end()
+            pieces.append(self.translate_numbers(line[last_end:]))
+            line = "".join(pieces)
+        return line
+
+    @staticmethod
+    def translate_numbers(text: str) -> str:
+        text = SUFFIX_HEX_RE.sub(lambda match: f"0x{match.group(1)}", text)
+        return SUFFIX_BINARY_RE.sub(lambda match: f"0b{match.group(1)}", text)
+
+
+SYNTAX_PROFILES: Dict[str, SyntaxProfile] = {
+    profile.name: profile
+    for profile in (
+        SyntaxProfile(
+            name="arnicomp",
+            description="native syntax: ; comments, 0x/0b prefixes, .org/.align/.fill",
+        ),
+        SyntaxProfile(
+            name="intel",
+            description="; comments, 0FFh/1010b suffixes, ORG/ALIGN/DS/INCLUDE/IF/ELSE/ENDIF/REPT/ENDR",
+            suffix_numbers=True,
+            directive_aliases={
+                "ORG": ".org",
+                "ALIGN": ".align",
+                "DS": ".fill",
+                "INCLUDE": ".include",
+                "IF": ".if",
+                "ELSE": ".else",
+                "ENDIF": ".endif",
+                "REPT": ".repeat {args} {",
+                "ENDR": "}",
+            },
+        ),
+        SyntaxProfile(
+            name="gnu",
+            description="// and /* */ comments, .balign/.space/.skip/.rept/.endr",
+            comment_char="//",
+            directive_aliases={
+                ".BALIGN": ".align",
+                # `.space` is native; `.skip` is GNU's other name for it.
+                ".SKIP": ".space",
+                ".REPT": ".repeat {args} {",
+                ".ENDR": "}",
+            },
+        ),
+    )
+}
+
+
+def get_syntax_profile(name: Optional[str]) -> SyntaxProfile:
+    profile = SYNTAX_PROFILES.get((name or "arnicomp").lower())
+    if profile is None:
+        raise ValueError(f"Unknown syntax profile '{name}'; choose one of: {', '.join(SYNTAX_PROFILES)}")
+    return profile
@@ -0,0 +1,100 @@
+"""
+Targets: the CPU revisions the assembler can encode for.
+
+`arnicomp-v2` is the current ISA described by config/config.json and is the default.
+`arnicomp-v1` is the original CPU, described by the repository-level config/config.json that the
+emulator loads. Every v1 instruction is one byte: `1 imm7` for LDI, otherwise `0 oooo aaa` with a
+4-bit opcode and a 3-bit argcode, each either fixed, a register code, or a small number.
+
+Selecting v1 swaps only the instruction encoder. Includes, macros, conditionals, constants,
+labels, and layout directives behave the same on both targets.
+"""
+
+from __future__ import annotations
+
+import json
+import os
+from typing import Callable, Dict, List, Optional
+
+
+TARGET_V1 = "arnicomp-v1"
+TARGET_V2 = "arnicomp-v2"
+TARGETS = (TARGET_V1, TARGET_V2)
+DEFAULT_TARGET = TARGET_V2
+V1_CONFIG_PATH = os.path.join(os.path.dirname(__file__), "..", "..", "config", "config.json")
+FIELD_WIDTHS = {"opcode": 4, "argcode": 3}
+
+
+def normalize_target(name: Optional[str]) -> str:
+    target = (name or DEFAULT_TARGET).lower()
+    if target not in TARGETS:
+        raise ValueError(f"Unknown target '{name}'; choose one of: {', '.join(TARGETS)}")
+    return target
+
+
+class V1Encoder:
+    """Encode instructions for the arnicomp-v1 CPU from its data-driven instruction table."""
+
+    def __init__(self, config: Dict[str, object]) -> None:
+        self.instructions = {name.upper(): spec for name, spec in config["instructions"].items()}
+        self.register_sets: Dict[str, Dict[str, str]] = {}
+        for group in ("opcode_types", "argcode_types"):
+            for set_name, registers in config.get(group, {}).items():
+                self.register_sets[set_name] = {name.upper(): bits for name, bits in registers.items()}
+
+    @classmethod
+    def load(cls, path: str = V1_CONFIG_PATH) -> "V1Encoder":
+        try:
+            with open(path, "r", encoding="utf-8") as f:
+                return cls(json.load(f))
+        except OSError as exc:
+            raise ValueError(f"Cannot load the {TARGET_V1} instruction set from {path}: {exc.strerror}") from exc
+
+    def encode(self, instruction: str, args: List[str], resolve_number: Callable[[str], int]) -> str:
+        spec = self.instructions.get(instruction)
+        if spec is None:
+            raise ValueError(f"{instruction} is not an {TARGET_V1} instruction; valid: {', '.join(self.instructions)}")
+
+        if spec.get("IM7") == "1":
+            if len(args) != 1:
+                raise ValueError(f"{instruction} expects exactly one immediate operand on {TARGET_V1}")
+            value = resolve_number(args[0])
+            if not (0 <= value <= 127):
+                raise ValueError(f"{instruction} immediate value {value} out of range (0-127) on {TARGET_V1}")
+            return f"1{value:07b}"
+
+        operand_count = sum(1 for kind in FIELD_WIDTHS if spec.get(f"{kind}_type") not in {None, "constant"})
+        if len(args) != operand_count:
+            raise ValueError(f"{instruction} expects {operand_count} operand(s) on {TARGET_V1}, got {len(args)}")
+
+        opcode = self.encode_field(instruction, spec, "opcode", args, resolve_number)
+        argcode = self.encode_field(instruction, spec, "argcode", args, resolve_number)
+        return f"0{opcode}{argcode}"
+
+    def encode_field(
+        self,
+        instruction: str,
+        spec: Dict[str, object],
+        kind: str,
+        args: List[str],
+        resolve_number: Callable[[str], int],
+    ) -> str:
+        field_type = spec.get(f"{kind}_type")
+        if field_type == "constant":
+            return str(spec[kind])
+
+        token = args[int(spec.get(f"{kind}_arg_order", 0))]
+        if field_type == "number":
+            width = int(spec.get(f"{kind}_length", FIELD_WIDTHS[kind]))
+            value = resolve_number(token)
+            if not (0 <= value < (1 << width)):
+                raise ValueError(
+                    f"{instruction} immediate value {value} out of range (0-{(1 << width) - 1}) on {TARGET_V1}"
+                )
+            return f"{value:0{width}b}"
+
+        registers = self.register_sets.get(str(field_type), {})
+        bits = registers.get(token.strip().upper())
+        if bits is None:
+            raise ValueError(f"{instruction} operand {token} must be one of: {', '.join(registers)}")
+        return bits
@@ -1,6 +1,13 @@
 #!/usr/bin/env python3
 from __future__ import annotations
 
+import binascii
+import contextlib
+import io
+import json
+import shutil
+import socket
+import subprocess
 import sys
 from pathlib import Path
 import tempfile
@@ -11,6 +18,22 @@ if str(ROOT) not in sys.path:
     sys.path.insert(0, str(ROOT))
 
 from modules.AssemblyHelper import AssemblyHelper
+from modules.Assembler import AssembleOptions, assemble
+from modules.AsmTest import compare_assembly, expect_assembly, expect_golden
+from modules.BitFields import build_opcode_table
+from modules.BuildMatrix import parse_build_matrix, parse_define
+from modules.Debugger import Debugger
+from modules.Disassembler import disassemble_image, parse_intel_hex, read_symbol_file
+from modules.Devices import UartDevice
+from modules.Emulator import Device, Emulator
+from modules.GdbStub import GdbStub, frame
+from modules.Linker import build_object, link_objects
+from modules.MemoryMap import format_memory_map
+from modules.ProgramTests import format_outcomes, run_tests
+from modules.SerialFlasher import SerialFlasher, flatten_image
+from modules.ProjectConfig import find_project_config, load_project_config
+from modules.OutputFormats import decode_base64, encode_base64, format_c_array, format_c_defines, format_coe, format_symbol_file, format_symbol_json, format_logisim_image, format_mif, format_records, length_prefix, parse_rom_size, parse_split, split_interleaved, checksum8, crc16, group_digits, swap_byte_pairs
+from main import AssembleArgs, AssemblerCLI
 
 
 def to_hex_list(binary_lines):
@@ -43,10 +66,10 @@ def expect_error(name, source_lines, expected_substring, optimize=False):
     raise AssertionError(f"{name}: expected assembly to fail")
 
 
-def assert_listing_case(name, source_lines, expected_listing_fragments, mode="hex", optimize=False):
+def assert_listing_case(name, source_lines, expected_listing_fragments, mode="hex", optimize=False, group_every=None):
     helper = AssemblyHelper()
     helper.convert_to_machine_code(source_lines, source_name="listing_case.asm", optimize=optimize)
-    listing_lines = helper.format_listing(mode)
+    listing_lines = helper.format_listing(mode, group_every)
     listing_text = "".join(listing_lines)
 
     if not listing_lines:
@@ -122,6 +145,93 @@ def assert_optimized_smaller(name, source_lines):
         )
 
 
+def assert_c_array_case(name, source_lines, array_name, expected_hex):
+    helper = AssemblyHelper()
+    binary_lines, _, _ = helper.convert_to_machine_code(source_lines)
+    byte_values = [int(line.strip(), 2) for line in binary_lines]
+    header_text = "".join(format_c_array(byte_values, array_name))
+
+    expected_fragments = [
+        f"#define {array_name.upper()}_LEN {len(expected_hex)}",
+        f"const unsigned char {array_name}[{array_name.upper()}_LEN] = {{",
+        "};",
+    ]
+    for fragment in expected_fragments:
+        if fragment not in header_text:
+            raise AssertionError(f"{name}: expected C header fragment '{fragment}' in:\n{header_text}")
+
+    body = header_text.split("{", 1)[1].split("}", 1)[0]
+    literals = [token.strip() for token in body.split(",") if token.strip()]
+    actual_hex = [f"{int(literal, 16):02X}" for literal in literals]
+    if actual_hex != expected_hex:
+        raise AssertionError(f"{name}: expected {expected_hex}, got {actual_hex}")
+    assert_c_compiles(
+        name,
+        header_text,
+        f'_Static_assert(sizeof {array_name} == {len(expected_hex)}, "array length");\n'
+        f"int main(void) {{ return {array_name}[{array_name.upper()}_LEN - 1]; }}\n",
+    )
+
+
+def assert_c_compiles(name, header_text, check_source):
+    """Compile `check_source` after including `header_text`; skipped when no C compiler is installed."""
+    compiler = shutil.which("cc") or shutil.which("gcc")
+    if compiler is None:
+        return
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        (tmp_path / "generated.h").write_text(header_text, encoding="utf-8")
+        (tmp_path / "check.c").write_text('#include "generated.h"\n' + check_source, encoding="utf-8")
+        result = subprocess.run(
+            [compiler, "-std=c11", "-Wall", "-Werror", "-fsyntax-only", str(tmp_path / "check.c")],
+            capture_output=True,
+            text=True,
+        )
+        if result.returncode != 0:
+            raise AssertionError(f"{name}: generated header does not compile:\n{result.stderr}")
+
+
+def assert_roundtrip_case(name, source_lines):
+    helper = AssemblyHelper()
+    binary_lines, _, _ = helper.convert_to_machine_code(source_lines, verify_roundtrip=True)
+    disassembled = [helper.disassemble(line.strip()) for line in binary_lines]
+    reassembled, _, _ = AssemblyHelper().convert_to_machine_code(disassembled)
+
+    if to_hex_list(reassembled) != to_hex_list(binary_lines):
+        raise AssertionError(
+            f"{name}: expected round-trip {to_hex_list(binary_lines)}, got {to_hex_list(reassembled)}"
+        )
+
+
+def assert_reachability_case(name, source_lines, expected_fragments):
+    helper = AssemblyHelper()
+    helper.convert_to_machine_code(source_lines, check_reachability=True)
+    warnings = helper.last_warnings
+
+    if len(warnings) != len(expected_fragments):
+        raise AssertionError(f"{name}: expected {len(expected_fragments)} warnings, got {warnings}")
+    for warning, fragment in zip(warnings, expected_fragments):
+        if fragment not in warning:
+            raise AssertionError(f"{name}: expected warning containing '{fragment}', got '{warning}'")
+
+
+def assert_svhex_line_endings(name, source_lines, crlf, expected_bytes):
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        source_path = tmp_path / "program.asm"
+        output_path = tmp_path / "program.mem"
+        source_path.write_text("\n".join(source_lines) + "\n", encoding="utf-8")
+
+        cli = AssemblerCLI()
+        cli.configure(AssembleArgs(input_file=str(source_path), crlf=crlf))
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.create_svhex(str(source_path), str(output_path))
+
+        actual_bytes = output_path.read_bytes()
+        if actual_bytes != expected_bytes:
+            raise AssertionError(f"{name}: expected {expected_bytes!r}, got {actual_bytes!r}")
+
+
 def main():
     positive_cases = [
         ("LDL RA, #5", ["LDL RA, #5"], ["C5"]),
@@ -184,12 +294,43 @@ def main():
             ["00", "00", "38"],
         ),
         ("LDI #10", ["LDI #10"], ["CA"]),
+        (
+            "LDI OR of prefixed bit constants",
+            ["equ ENABLE 0x01", "equ IRQ 0x04", "LDI $ENABLE|$IRQ"],
+            ["C5"],
+        ),
+        (
+            "LDI OR of bit constants with spaces",
+            ["equ ENABLE 0x20", "equ IRQ 0x04", "LDI RD, ENABLE | IRQ"],
+            ["E4", "39"],
+        ),
+        (
+            "LDI label plus offset",
+            ["NOP", "table: NOP", "LDI @table + 2"],
+            ["00", "00", "C3"],
+        ),
+        (
+            "LDL OR composition",
+            ["equ LO_BIT 0x01", "equ HI_BIT 0x10", "LDL RA, $LO_BIT | $HI_BIT"],
+            ["D1"],
+        ),
         ("LDI RD, #125", ["LDI RD, #125"], ["FD", "3B"]),
         (
             "LDI forward label",
             ["LDI RA, @target", "NOP", "target:", "HLT"],
             ["C2", "00", "01"],
         ),
+        (
+            # The label's value decides the LDI's size, which moves the label: one byte keeps it at 29.
+            "LDI forward label sized by its own value",
+            ["LDI @target", ".fill 28", "target: HLT"],
+            ["DD", *["00"] * 28, "01"],
+        ),
+        (
+            "LDI forward label pushed past one byte",
+            ["LDI @target", ".fill 31", "target: HLT"],
+            ["C1", "31", *["00"] * 31, "01"],
+        ),
         (
             "LDI forward local label",
             ["root: LDI RA, @*done", "NOP", "*done: HLT"],
@@ -215,12 +356,6 @@ def main():
             ["root: NOP", "LDI LOW(*done)", "*done: HLT"],
             ["00", "C2", "01"],
         ),
-        (
-            "LDI wide constant warning",
-            ["equ WIDE 0x123", "LDI RD, $WIDE"],
-            ["E3", "39"],
-            1,
-        ),
         (
             "equ char literal",
             ["equ ON_CHAR 'A'", "LDI $ON_CHAR"],
@@ -273,8 +408,16 @@ def main():
         ("fill custom byte", [".fill 3, #0xAA"], ["AA", "AA", "AA"]),
         ("org padding", ["NOP", ".org 4", "HLT"], ["00", "00", "00", "00", "01"]),
         ("org custom fill", ["NOP", ".org 4, #0xFF", "HLT"], ["00", "FF", "FF", "FF", "01"]),
+        (
+            "padto computed address",
+            ["equ BANK_SIZE 3", "NOP", ".padto BANK_SIZE*2, #0xFF", "HLT"],
+            ["00", "FF", "FF", "FF", "FF", "FF", "01"],
+        ),
+        ("padto already aligned", ["NOP", ".padto 1", "HLT"], ["00", "01"]),
         ("align padding", ["NOP", ".align 4", "HLT"], ["00", "00", "00", "00", "01"]),
         ("align custom fill", ["NOP", ".align 4, #0x7E", "HLT"], ["00", "7E", "7E", "7E", "01"]),
+        ("entry after padding", [".entry main", ".fill 2, #0xFF", "main: HLT"], ["FF", "FF", "01"]),
+        ("data-only image without entry", [".fill 2, #0xFF"], ["FF", "FF"]),
         (
             "multiline block comment",
             ["LDI #10 /* comment starts", "still comment", "comment ends */", "NOP"],
@@ -386,6 +529,16 @@ def main():
             ["NOP", ".org 0"],
             "behind current address",
         ),
+        (
+            "OR composition undefined constant",
+            ["equ ENABLE 0x01", "LDI $ENABLE|$IRQ"],
+            "Undefined constant reference: $IRQ",
+        ),
+        (
+            "padto already past",
+            ["NOP", "NOP", "NOP", ".padto 1"],
+            "already past",
+        ),
         (
             "align zero",
             [".align 0"],
@@ -401,6 +554,31 @@ def main():
             [".fill 1, 256"],
             "out of range",
         ),
+        (
+            "entry in fill bytes",
+            ["HLT", ".entry table", "table: .fill 2"],
+            "entry point table (0x0001) is in the .fill bytes of 'table: .fill 2'",
+        ),
+        (
+            "entry in org padding",
+            [".entry 0", ".org 2", "HLT"],
+            "entry point 0 (0x0000) is in the .org bytes",
+        ),
+        (
+            "entry inside an instruction",
+            [".entry 1", "JMP end", "end: HLT"],
+            "entry point 1 (0x0001) is inside the instruction at 0x0000",
+        ),
+        (
+            "entry outside the image",
+            [".entry 0x20", "HLT"],
+            "is outside the program image, which ends at 0x0001",
+        ),
+        (
+            "entry set twice",
+            [".entry 0", ".entry 0", "HLT"],
+            ".entry is already set on line",
+        ),
         (
             "local label without global scope",
             ["*loop: NOP"],
@@ -592,6 +770,26 @@ def main():
     )
     passed += 1
 
+    expect_error("bare equ is malformed", ["equ", "NOP"], "Invalid constant definition")
+    passed += 1
+
+    expect_file_error(
+        "bare equ in imported library prelude is malformed",
+        '.import "lib/math.asm" mul_func\nNOP\n',
+        "lib/math.asm:1 ('equ'): Invalid constant definition",
+        include_files={
+            "lib/math.asm": (
+                "equ\n"
+                ".export mul_func\n"
+                ".func\n"
+                "mul_func:\n"
+                "    ret\n"
+                ".endfunc\n"
+            ),
+        },
+    )
+    passed += 1
+
     expect_file_error(
         "import missing export",
         '.import "lib/math.asm" mul_func\nNOP\n',
@@ -778,6 +976,1997 @@ def main():
     assert_optimized_smaller("optimized oscillation case shrinks", oscillation_case)
     passed += 1
 
+    assert_c_array_case(
+        "C array header output",
+        ["LDL RA, #5", "MOV RD, RA", "HLT"] + ["NOP"] * 12,
+        "program_rom",
+        ["C5", "88", "01"] + ["00"] * 12,
+    )
+    passed += 1
+
+    try:
+        format_c_array([0x00], "2bad-name")
+    except ValueError as exc:
+        if "valid C identifier" not in str(exc):
+            raise AssertionError(f"C array invalid name: unexpected error '{exc}'")
+    else:
+        raise AssertionError("C array invalid name: expected failure")
+    passed += 1
+
+    assert_roundtrip_case(
+        "round-trip assemble disassemble assemble",
+        [
+            "start: LDI RD, #125",
+            "MOV RB, ACC",
+            "ADDI #3",
+            "PUSH MARH",
+            "POP M",
+            "INC #2",
+            "CALL done",
+            "JGE start :RD",
+            ".fill 2, #0x9C",
+            "done: HLT",
+        ],
+    )
+    passed += 1
+
+    class BrokenDisassemblyHelper(AssemblyHelper):
+        def disassemble(self, binary_code):
+            if binary_code.strip() == "00000001":
+                return "NOP"
+            return super().disassemble(binary_code)
+
+    try:
+        BrokenDisassemblyHelper().convert_to_machine_code(["NOP", "HLT"], verify_roundtrip=True)
+    except ValueError as exc:
+        if "at 0x0001" not in str(exc):
+            raise AssertionError(f"round-trip mismatch address: unexpected error '{exc}'")
+    else:
+        raise AssertionError("round-trip mismatch: expected failure")
+    passed += 1
+
+    assert_reachability_case(
+        "reachability flags block after unconditional jump",
+        ["start: LDI #1", "JMP start", "dead: NOP", "ADDI #1", "HLT"],
+        ["<input>:3-5: unreachable code at 0x0008-0x000A"],
+    )
+    passed += 1
+
+    assert_reachability_case(
+        "reachability follows branches and calls",
+        ["start: CMP RA", "JEQ skip", "NOP", "skip: CALL fn", "HLT", "fn: NOP", "RET"],
+        [],
+    )
+    passed += 1
+
+    assert_reachability_case(
+        "reachability treats loaded addresses as indirect targets",
+        ["start: LDI @handler", "MOV PRL, RA", "JMP", ".fill 2", "handler: HLT", "orphan: NOP"],
+        ["<input>:6-6: unreachable code at 0x0006-0x0006"],
+    )
+    passed += 1
+
+    matrix_source = [
+        "LDI #1",
+        ".if DEBUG",
+        "ADDI #2",
+        ".endif",
+        "HLT",
+    ]
+    matrix_helper = AssemblyHelper()
+    variants = parse_build_matrix(
+        ["; output   defines", "rom_release.txt DEBUG=0", "rom_debug.txt DEBUG=1"],
+        matrix_helper.evaluate_expression,
+    )
+    matrix_outputs = {
+        variant.output_file: [
+            int(line, 2)
+            for line in matrix_helper.convert_to_machine_code(matrix_source, defines=variant.defines)[0]
+        ]
+        for variant in variants
+    }
+    expected_outputs = {
+        "rom_release.txt": [0xC1, 0x01],
+        "rom_debug.txt": [0xC1, 0x4A, 0x01],
+    }
+    if matrix_outputs != expected_outputs:
+        raise AssertionError(f"build matrix: expected {expected_outputs}, got {matrix_outputs}")
+    passed += 1
+
+    try:
+        parse_build_matrix(["rom.txt DEBUG"], matrix_helper.evaluate_expression)
+    except ValueError as exc:
+        if "NAME=value" not in str(exc):
+            raise AssertionError(f"build matrix malformed define: unexpected error '{exc}'")
+    else:
+        raise AssertionError("build matrix malformed define: expected failure")
+    passed += 1
+
+    assert_svhex_line_endings("svhex uses LF by default", ["NOP", "HLT"], False, b"@0\n00\n01\n")
+    passed += 1
+
+    assert_svhex_line_endings("svhex uses CRLF with --crlf", ["NOP", "HLT"], True, b"@0\r\n00\r\n01\r\n")
+    passed += 1
+
+    suggest_helper = AssemblyHelper()
+    suggest_binary, _, _ = suggest_helper.convert_to_machine_code(
+        ["start: CALL fn", "HLT", "fn: RET"],
+        suggest_optimize=True,
+    )
+    canonical_binary, _, _ = AssemblyHelper().convert_to_machine_code(["start: CALL fn", "HLT", "fn: RET"])
+    if suggest_binary != canonical_binary:
+        raise AssertionError("optimize suggestions: output must stay canonical")
+    if suggest_helper.last_warnings != [
+        "Line <input>:1: 'start: CALL fn' takes 7 byte(s); --optimize encodes it in 4 (saves 3)"
+    ]:
+        raise AssertionError(f"optimize suggestions: unexpected warnings {suggest_helper.last_warnings}")
+    passed += 1
+
+    partial_helper = AssemblyHelper()
+    partial_binary, _, _ = partial_helper.convert_to_machine_code(
+        ["NOP", "ADDI #9", "LDI #40", "FOO RA", "HLT"],
+        partial_placeholder=0xFF,
+    )
+    if to_hex_list(partial_binary) != ["00", "FF", "C8", "31", "FF", "01"]:
+        raise AssertionError(f"partial build: unexpected bytes {to_hex_list(partial_binary)}")
+    if len(partial_helper.last_errors) != 2 or "<input>:2" not in partial_helper.last_errors[0]:
+        raise AssertionError(f"partial build: unexpected errors {partial_helper.last_errors}")
+    passed += 1
+
+    expect_error("partial build still fails without placeholder", ["NOP", "ADDI #9"], "out of range")
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as tmpdir:
+        partial_source = Path(tmpdir) / "partial.asm"
+        partial_source.write_text("NOP\nLDI $MISSING\nHLT\n", encoding="utf-8")
+        result = subprocess.run(
+            [sys.executable, str(Path(__file__).with_name("main.py")), "assemble", str(partial_source), str(Path(tmpdir) / "partial.txt"), "--partial"],
+            capture_output=True,
+            text=True,
+        )
+        if (
+            result.returncode != 1
+            or "Partial build: 1 line(s) replaced with 0x00" not in result.stdout
+            or "Partial build written" not in result.stdout
+            or "successful" in result.stdout
+            or not (Path(tmpdir) / "partial.txt").exists()
+        ):
+            raise AssertionError(f"--partial: a partial build should not report success: {result.returncode} {result.stdout}")
+    passed += 1
+
+    assert_listing_case(
+        "listing without digit grouping",
+        ["LDI #1"],
+        ["      0000  C1  LDL RA, #1"],
+        mode="asm",
+    )
+    passed += 1
+
+    assert_listing_case(
+        "listing with binary digit grouping",
+        ["LDI #1"],
+        ["      0000  C1  1100_0001  LDL RA, #1"],
+        mode="asm",
+        group_every=4,
+    )
+    passed += 1
+
+    if group_digits("11000001", 3, "'") != "11'000'001":
+        raise AssertionError(f"digit grouping from the low end: got {group_digits('11000001', 3, chr(39))}")
+    passed += 1
+
+    assemble_case(
+        "strong label overrides weak default",
+        ["LDI @handler", "HLT", ".weak handler", "handler: NOP", "handler: HLT"],
+        ["C3", "01", "00", "01"],
+    )
+    passed += 1
+
+    assemble_case(
+        "first weak label wins over later weak",
+        ["LDI @handler", ".weak handler", "handler: NOP", ".weak handler", "handler: HLT"],
+        ["C1", "00", "01"],
+    )
+    passed += 1
+
+    assemble_file_case(
+        "weak library default overridden by user file",
+        '.include "lib/vectors.inc"\nCALL irq\nHLT\nirq: RET\n',
+        to_hex_list(AssemblyHelper().convert_to_machine_code(["RET", "CALL irq", "HLT", "irq: RET"])[0]),
+        include_files={"lib/vectors.inc": ".weak irq\nirq: RET\n"},
+    )
+    passed += 1
+
+    expect_error("weak marker without definition", [".weak handler", "NOP"], "not followed by a definition")
+    passed += 1
+
+    expect_error("two strong definitions still clash", [".weak h", "h: NOP", "h: NOP", "h: HLT"], "Duplicate label definition")
+    passed += 1
+
+    if swap_byte_pairs([0x11, 0x22, 0x33, 0x44]) != [0x22, 0x11, 0x44, 0x33]:
+        raise AssertionError(f"byteswap: got {swap_byte_pairs([0x11, 0x22, 0x33, 0x44])}")
+    passed += 1
+
+    byteswap_cli = AssemblerCLI()
+    byteswap_cli.configure(AssembleArgs(input_file="<input>", byteswap=True))
+    byteswap_binary, _, _ = byteswap_cli.convert_source(["LDI #1", "LDI #2", "NOP", "HLT"], "<input>", False)
+    if to_hex_list(byteswap_binary) != ["C2", "C1", "01", "00"]:
+        raise AssertionError(f"byteswap CLI output: got {to_hex_list(byteswap_binary)}")
+    passed += 1
+
+    try:
+        byteswap_cli.convert_source(["NOP", "NOP", "HLT"], "<input>", False)
+    except ValueError as exc:
+        if "even number of bytes" not in str(exc):
+            raise AssertionError(f"byteswap odd length: unexpected error '{exc}'")
+    else:
+        raise AssertionError("byteswap odd length: expected failure")
+    passed += 1
+
+    for optimize in (False, True):
+        expect_assembly(
+            "foo RA\nLDI #$NOPE",
+            diagnostics=["<input>:1:1: error: Unknown instruction: FOO", "<input>:2:1: error: Undefined constant reference: $NOPE"],
+            options=AssembleOptions(optimize=optimize),
+        )
+        # Errors that only the optimizer's layout would meet still come back per line.
+        expect_assembly(
+            "CALL nowhere\nJMP elsewhere\n.byte 300",
+            diagnostics=[
+                "<input>:1:1: error: Undefined label reference: nowhere",
+                "<input>:2:1: error: Undefined label reference: elsewhere",
+                "<input>:3:1: error: .byte value 300 resolves to 300, out of range (-128..255)",
+            ],
+            options=AssembleOptions(optimize=optimize),
+        )
+    passed += 1
+
+    expect_assembly(
+        "LDI #$A\nLDI #$B\nJMP nowhere",
+        diagnostics=[
+            "<input>:1:1: error: Undefined constant reference: $A",
+            "<input>:2:1: error: Undefined constant reference: $B",
+            "<input>:3:1: error: Undefined label reference: nowhere",
+        ],
+    )
+    if len(assemble("LDI #$A\nLDI #$B\nJMP nowhere", AssembleOptions(fail_fast=True)).errors) != 1:
+        raise AssertionError("fail-fast: expected exactly one undefined constant error")
+    passed += 1
+
+    if crc16(b"123456789") != 0x29B1 or checksum8(b"\xC3\xC4") != 0x79:
+        raise AssertionError("checksums: expected the CRC-16/CCITT-FALSE check value 0x29B1 and a zero-sum byte")
+    checksum_source = [
+        "start: LDI #3",
+        "LDI #4",
+        "code_end:",
+        "code_sum: .checksum @start, @code_end",
+        "rom_crc: .crc16 0, @rom_crc",
+        "HLT",
+    ]
+    expect_assembly(checksum_source, "C3 C4 79 ; code_sum\n15 86 ; CRC-16 of C3 C4 79, low byte first\n01")
+    expect_assembly(checksum_source, "C3 C4 79 15 86 01", options=AssembleOptions(optimize=True))
+    expect_assembly(".org 4\nLDI #1\n.checksum 0, 5", "00 00 00 00 C1 3F")
+    expect_error("checksum range past the program", [".checksum 0, 5", "HLT"], ".checksum range ends at 0x0005, past the last byte at 0x0001")
+    expect_error("checksum range covers its own field", ["x: .checksum 0, 1"], ".checksum range 0x0000-0x0001 covers its own field at 0x0000")
+    expect_error(
+        "crc range covers a later checksum",
+        [".crc16 3, 5", "HLT", ".checksum 0, 1", "HLT"],
+        ".crc16 range 0x0003-0x0005 covers a later checksum's (<input>:3) field at 0x0003",
+    )
+    expect_error("checksum range is exclusive", [".checksum 2, 2"], "is empty; the end address is exclusive")
+    crc_cli = AssemblerCLI()
+    crc_cli.configure(AssembleArgs(input_file="<input>", append_crc=True, length_prefix=1))
+    crc_binary, _, _ = crc_cli.convert_source(["LDI #3", "HLT"], "<input>", False)
+    if to_hex_list(crc_binary) != ["04", "C3", "01", "29", "4E"]:
+        raise AssertionError(f"--append-crc: got {to_hex_list(crc_binary)}")
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        crc_cli = AssemblerCLI()
+        crc_cli.configure(AssembleArgs(
+            input_file="crc.asm",
+            append_crc=True,
+            length_prefix=1,
+            byteswap=False,
+            map_file=str(tmp_path / "crc.map"),
+            symbols_file=str(tmp_path / "crc.sym"),
+            rom_size=8,
+        ))
+        with contextlib.redirect_stdout(io.StringIO()):
+            crc_cli.convert_source(["start: LDI #3", "done: HLT"], "crc.asm", False)
+        crc_map = (tmp_path / "crc.map").read_text(encoding="utf-8")
+        crc_symbols = (tmp_path / "crc.sym").read_text(encoding="utf-8")
+        for fragment in (
+            "  .text  0x0000-0x0001       2 bytes (0 padding)\n",
+            "  crc    0x0002-0x0003       2 bytes (--append-crc)\n",
+            "ROM used: 4 of 8 bytes",
+            "Free blocks:\n  0x0004-0x0007       4 bytes\n",
+            "  0x0001  .text  DONE\n",
+        ):
+            if fragment not in crc_map:
+                raise AssertionError(f"--map with --append-crc/--length-prefix: expected {fragment!r} in:\n{crc_map}")
+        # The length prefix is stripped by the loader, so labels keep their CPU addresses.
+        if crc_symbols != "0000 START\n0001 DONE\n":
+            raise AssertionError(f"--symbols with --length-prefix: unexpected {crc_symbols!r}")
+    passed += 1
+
+    expect_error("unknown mnemonic suggests nearest", ["start: NOP", "jpm start"], "Unknown instruction: JPM (did you mean JMP?)")
+    passed += 1
+
+    expect_error("unknown directive suggests nearest", [".algn 4"], "did you mean .ALIGN?")
+    passed += 1
+
+    expect_error("misspelled .entry suggests it", ["start: HLT", ".entyr start"], "did you mean .ENTRY?")
+    passed += 1
+
+    expect_error("undefined label suggests nearest", ["start: NOP", "JMP strat"], "Undefined label reference: strat (did you mean START?)")
+    passed += 1
+
+    expect_error("undefined constant suggests nearest", ["equ LIMIT 3", "LDI $LIMT + 1"], "Undefined constant reference: $LIMT (did you mean $LIMIT?)")
+    passed += 1
+
+    expect_error("prefixed label suggestion keeps prefix", ["loop: NOP", "LDI LOW(@lop)"], "(did you mean @LOOP?)")
+    passed += 1
+
+    expect_error("constant used as a jump target", ["equ LIMIT 3", "JMP LIMIT"], "Undefined label reference: LIMIT (LIMIT is a constant; use $LIMIT)")
+    passed += 1
+
+    try:
+        AssemblyHelper().convert_to_machine_code(["FROB RA"])
+    except ValueError as exc:
+        if "did you mean" in str(exc):
+            raise AssertionError(f"distant mnemonic should not get a suggestion: '{exc}'")
+    else:
+        raise AssertionError("distant mnemonic: expected failure")
+    passed += 1
+
+    stats_helper = AssemblyHelper()
+    stats_helper.convert_to_machine_code(
+        ["start: NOP", "nop", "ADDI #1", "NOP", ".fill 2", "ADDI #2", "CALL start", "HLT"],
+    )
+    expected_histogram = [("NOP", 3), ("ADDI", 2), ("CALL", 1), ("HLT", 1)]
+    if stats_helper.instruction_histogram() != expected_histogram:
+        raise AssertionError(f"instruction histogram: got {stats_helper.instruction_histogram()}")
+    passed += 1
+
+    if AssemblyHelper().evaluate_expression('len("ab\\n")') != 3:
+        raise AssertionError("len() of escaped string literal should be 3")
+    passed += 1
+
+    assemble_case(
+        "LDI string length composes with operators",
+        ["equ EXTRA 2", 'LDI #len("ab\\n") + $EXTRA', 'LDI len("a,b;c") * 2'],
+        ["C5", "CA"],
+    )
+    passed += 1
+
+    expect_error("len requires a string literal", ["LDI #len(5)"], "Unsupported operand value")
+    passed += 1
+
+    assemble_case(
+        "three constants on one equ line",
+        ["equ A 1, B MAX(2, 1), C A + B", "LDI $A", "LDI $B", "LDI $C"],
+        ["C1", "C2", "C3"],
+    )
+    passed += 1
+
+    expect_error(
+        "malformed pair in multi-constant equ",
+        ["equ A 1, B, C 3", "NOP"],
+        "definition 2 of 3: 'B'",
+    )
+    passed += 1
+
+    several_errors = ["NOP", "ADDI #9", "FOO", "JMP nowhere", "HLT"]
+    for fail_fast, expected_count in ((True, 1), (False, 3)):
+        try:
+            AssemblyHelper().convert_to_machine_code(several_errors, fail_fast=fail_fast)
+        except ValueError as exc:
+            reported = str(exc).count("Error on line")
+            if reported != expected_count:
+                raise AssertionError(f"fail_fast={fail_fast}: expected {expected_count} errors, got {reported}: '{exc}'")
+        else:
+            raise AssertionError(f"fail_fast={fail_fast}: expected failure")
+        passed += 1
+
+    for example_name in ["label_boundary_uart_test.asm", "gpio_ssd1306_movement.asm", "gpio_pwm_1khz_sweep_demo.asm"]:
+        example_path = ROOT / "examples" / "fpga" / example_name
+        source_lines = example_path.read_text(encoding="utf-8").splitlines()
+        for optimize in (False, True):
+            outputs = []
+            for cache_parsing in (False, True):
+                helper = AssemblyHelper()
+                helper.cache_parsing = cache_parsing
+                binary, labels, _ = helper.convert_to_machine_code(source_lines, source_name=str(example_path), optimize=optimize)
+                outputs.append((binary, labels))
+            if outputs[0] != outputs[1]:
+                raise AssertionError(f"parse cache changed output for {example_name} (optimize={optimize})")
+        passed += 1
+
+    # Cached operands belong to one constants table: a reused helper must see a changed equ.
+    cache_helper = AssemblyHelper()
+    first_build, _, _ = cache_helper.convert_to_machine_code(["equ LIMIT 1", "LDI $LIMIT", "LDI $LIMIT"])
+    second_build, _, _ = cache_helper.convert_to_machine_code(["equ LIMIT 2", "LDI $LIMIT", "LDI $LIMIT"])
+    if to_hex_list(first_build) == to_hex_list(second_build) or to_hex_list(second_build) != to_hex_list(
+        AssemblyHelper().convert_to_machine_code(["LDI #2", "LDI #2"])[0]
+    ):
+        raise AssertionError(f"operand cache: stale constant {to_hex_list(first_build)} {to_hex_list(second_build)}")
+    passed += 1
+
+    assert_listing_case(
+        "bitfields listing splits encoding fields",
+        ["MOV RD, RA", "LDI #1", "ADDI #5", "JEQ"],
+        [
+            "op:10 dest:001 src:000",
+            "op:11 dest:0 imm:00001",
+            "op:01001 imm:101",
+            "op:00011 cond:000",
+        ],
+        mode="bitfields",
+    )
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as temp_dir:
+        project_dir = Path(temp_dir)
+        (project_dir / ".asmconfig").write_text('{"comment": "//"}', encoding="utf-8")
+        source_dir = project_dir / "src"
+        source_dir.mkdir()
+        config_path = find_project_config(str(source_dir))
+        if config_path != str(project_dir / ".asmconfig"):
+            raise AssertionError(f"expected .asmconfig from parent directory, got {config_path}")
+        args = AssembleArgs(input_file=str(source_dir / "program.asm"))
+        args.apply_project_config(load_project_config(config_path))
+        cli = AssemblerCLI()
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.configure(args)
+            binary, _, _ = cli.convert_source(["NOP // ; not a comment here", "HLT"], args.input_file, optimize=False)
+        if [line.strip() for line in binary] != ["00000000", "00000001"]:
+            raise AssertionError(f".asmconfig comment symbol not applied: {binary}")
+
+        (project_dir / ".asmconfig").write_text('{"comment": "//", "colour": 1}', encoding="utf-8")
+        try:
+            load_project_config(config_path)
+        except ValueError as exc:
+            if "unknown key 'colour'" not in str(exc):
+                raise AssertionError(f"unexpected .asmconfig error: '{exc}'")
+        else:
+            raise AssertionError("expected unknown .asmconfig key to fail")
+
+        (project_dir / ".asmconfig").write_text(
+            '{"pseudo_instructions": {"SETB": {"parameters": ["value"], "expansion": ["LDI \\\\value", "MOV RB, RA"]}}}',
+            encoding="utf-8",
+        )
+        args = AssembleArgs(input_file=str(source_dir / "program.asm"))
+        args.apply_project_config(load_project_config(config_path))
+        cli = AssemblerCLI()
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.configure(args)
+            binary, _, _ = cli.convert_source(["SETB 3"], args.input_file, optimize=False)
+        if [line.strip() for line in binary] != ["11000011", "10010000"]:
+            raise AssertionError(f".asmconfig pseudo-instruction not applied: {binary}")
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as temp_dir:
+        project_dir = Path(temp_dir)
+        (project_dir / "lib").mkdir()
+        (project_dir / "lib" / "consts.inc").write_text("equ STEP 3\n", encoding="utf-8")
+        (project_dir / "other").mkdir()
+        (project_dir / "other" / "consts.inc").write_text("equ STEP 5\n", encoding="utf-8")
+        (project_dir / ".asmconfig").write_text('{"target": "arnicomp-v1", "include_paths": ["lib"]}', encoding="utf-8")
+        (project_dir / "program.asm").write_text('.include "consts.inc"\nADDI $STEP\nOUT RA\n', encoding="utf-8")
+        config = load_project_config(str(project_dir / ".asmconfig"))
+        if config.target != "arnicomp-v1" or config.include_paths != [str(project_dir / "lib")]:
+            raise AssertionError(f".asmconfig target/include_paths: unexpected {config}")
+        args = AssembleArgs(input_file=str(project_dir / "program.asm"))
+        args.apply_project_config(config)
+        cli = AssemblerCLI()
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.configure(args)
+            binary, _, _ = cli.convert_source(
+                (project_dir / "program.asm").read_text(encoding="utf-8").splitlines(), args.input_file, optimize=False
+            )
+        # ADDI 3 and OUT RA only encode this way on arnicomp-v1.
+        if [line.strip() for line in binary] != ["00011011", "01111000"]:
+            raise AssertionError(f".asmconfig target and include_paths not applied: {binary}")
+
+        # -I replaces the .asmconfig list.
+        result = subprocess.run(
+            [sys.executable, str(Path(__file__).with_name("main.py")), "assemble", str(project_dir / "program.asm"),
+             str(project_dir / "program.txt"), "-I", str(project_dir / "other")],
+            capture_output=True,
+            text=True,
+        )
+        output = (project_dir / "program.txt").read_text(encoding="utf-8").split() if result.returncode == 0 else result.stdout
+        if output != ["00011101", "01111000"]:
+            raise AssertionError(f"-I should override .asmconfig include_paths, got {output}")
+
+        missing = assemble('.include "nowhere.inc"', AssembleOptions(include_paths=[str(project_dir / "lib")]))
+        if not any(f"Included file not found: nowhere.inc (also searched: {project_dir / 'lib'})" in str(error) for error in missing.errors):
+            raise AssertionError(f"include_paths: unexpected {missing.diagnostics}")
+
+        for config_text, substring in (
+            ('{"endianness": "big"}', "'endianness' is not supported; instructions are single bytes"),
+            ('{"target": "z80"}', "'target': Unknown target 'z80'"),
+            ('{"include_paths": "lib"}', "'include_paths' must be a list of directory names"),
+        ):
+            (project_dir / ".asmconfig").write_text(config_text, encoding="utf-8")
+            try:
+                load_project_config(str(project_dir / ".asmconfig"))
+            except ValueError as exc:
+                if substring not in str(exc):
+                    raise AssertionError(f"unexpected .asmconfig error for {config_text}: '{exc}'")
+            else:
+                raise AssertionError(f"expected .asmconfig {config_text} to fail")
+    passed += 1
+
+    binary, _, _ = AssemblyHelper().convert_to_machine_code(["start: LDI #5", "MOV RD, RA", "PUSHI #0xA5", "JMP start", "HLT"])
+    program_bytes = [int(line, 2) for line in binary]
+    for compress in (False, True):
+        blob = encode_base64(program_bytes, compress=compress)
+        if decode_base64(blob) != program_bytes:
+            raise AssertionError(f"base64 round trip changed bytes (compress={compress}): '{blob}'")
+        passed += 1
+    try:
+        decode_base64("not base64!")
+    except ValueError as exc:
+        if "Invalid base64" not in str(exc):
+            raise AssertionError(f"unexpected base64 error: '{exc}'")
+    else:
+        raise AssertionError("expected invalid base64 blob to fail")
+    passed += 1
+
+    assemble_case(
+        "min max abs with literals and symbols",
+        [
+            "equ LOW_LIMIT 3",
+            "equ HIGH_LIMIT 10",
+            "equ SPAN ABS(LOW_LIMIT - HIGH_LIMIT)",
+            "LDI $SPAN",
+            "LDI #MAX($LOW_LIMIT, 4)",
+            "LDI #MIN(HIGH_LIMIT, 12, 6)",
+            "LDI #ABS(-2) + 1",
+        ],
+        ["C7", "C4", "C6", "C3"],
+    )
+    passed += 1
+
+    assemble_case(
+        "min max abs in conditional assembly",
+        [
+            ".define DEPTH -4",
+            ".if ABS(DEPTH) - MAX(DEPTH, 4)",
+            "NOP",
+            ".else",
+            "HLT",
+            ".endif",
+            ".if MIN(DEPTH, 0)",
+            "NOP",
+            ".endif",
+        ],
+        ["01", "00"],
+    )
+    passed += 1
+
+    expect_error(
+        "abs with too many arguments",
+        ["equ BAD ABS(1, 2)", "NOP"],
+        "Wrong number of arguments for ABS()",
+    )
+    passed += 1
+
+    helper = AssemblyHelper()
+    _, labels, _ = helper.convert_to_machine_code(["NOP", "loop: .dw 5", "JMP loop"], partial_placeholder=0xFF)
+    if labels.get("LOOP") != 1:
+        raise AssertionError(f"label before a bad directive should still be recorded: {labels}")
+    if helper.last_errors != ["Error on line <input>:2 ('loop: .dw 5'): Unknown directive: .DW"]:
+        raise AssertionError(f"label with bad directive: unexpected errors {helper.last_errors}")
+    passed += 1
+
+    expect_error("label with misspelled directive", ["NOP", "pad: .flil 2, 0", "JMP pad"], "<input>:2 ('pad: .flil 2, 0'): Unknown directive: .FLIL (did you mean .FILL?)")
+    passed += 1
+
+    helper = AssemblyHelper()
+    binary, _, _ = helper.convert_to_machine_code(["NOP", "start: CALL start", "LDI #3", ".fill 2, 0x01", "HLT"])
+    records = format_records(
+        [(entry.address, [int(bits, 2) for bits in entry.binary_bytes]) for entry in helper.last_listing],
+        record_width=4,
+    )
+    if len({len(record) for record in records}) != 1:
+        raise AssertionError(f"records should have uniform width: {records}")
+    expected_records = [
+        "0000 01 00 00 00 00\n",
+        "0001 04 C1 30 A8 C0\n",
+        "0005 03 30 B0 07 00\n",
+        "0008 01 C3 00 00 00\n",
+        "0009 02 01 01 00 00\n",
+        "000B 01 01 00 00 00\n",
+    ]
+    if records != expected_records:
+        raise AssertionError(f"unexpected records: {records}")
+    record_bytes = [int(field, 16) for record in records for field in record.split()[2:2 + int(record.split()[1], 16)]]
+    if record_bytes != [int(line, 2) for line in binary]:
+        raise AssertionError("record payload bytes should match the assembled image")
+    passed += 1
+
+    symbol_outputs = set()
+    for source_lines in (
+        ["equ ZED 1", "equ ALPHA 2", "beta:", "gamma: NOP", "alpha: HLT"],
+        ["equ ALPHA 2", "equ ZED 1", "gamma:", "beta: NOP", "alpha: HLT"],
+    ):
+        _, labels, constants = AssemblyHelper().convert_to_machine_code(source_lines)
+        symbol_outputs.add(tuple(AssemblerCLI().format_symbol_tables(labels, constants)))
+    if len(symbol_outputs) != 1:
+        raise AssertionError(f"symbol table order should not depend on definition order: {symbol_outputs}")
+    printed_names = [line.split()[0] for line in next(iter(symbol_outputs)) if line.startswith("    ")]
+    if printed_names != ["BETA", "GAMMA", "ALPHA", "ALPHA", "ZED"]:
+        raise AssertionError(f"unexpected symbol table order: {printed_names}")
+    passed += 1
+
+    def stack_depth_report(source_lines):
+        helper = AssemblyHelper()
+        _, labels, constants = helper.convert_to_machine_code(source_lines)
+        return helper.stack_depth_checker.analyze(helper.last_listing, labels, constants)
+
+    report = stack_depth_report([
+        "PUSHI #1",
+        "PUSHSTR \"AB\"",
+        "POP RA",
+        "CALL helper",
+        "POP RA",
+        "POP RA",
+        "HLT",
+        "helper: PUSH RD",
+        "POP RD",
+        "RET",
+    ])
+    depths = {root.name: root.max_depth for root in report.roots}
+    if depths != {"entry": 3, "HELPER": 1} or report.warnings:
+        raise AssertionError(f"balanced stack sequence: unexpected report {depths} {report.warnings}")
+    passed += 1
+
+    report = stack_depth_report(["PUSHI #1", "POP RA", "POP RD", "HLT"])
+    if report.warnings != ["Line <input>:3: POP without a matching PUSH (stack depth -1 on the path from 0x0000)"]:
+        raise AssertionError(f"stack underflow: unexpected warnings {report.warnings}")
+    passed += 1
+
+    report = stack_depth_report(["loop: PUSH RA", "JNE loop", "HLT"])
+    if len(report.warnings) != 1 or "stack depth differs where paths join" not in report.warnings[0]:
+        raise AssertionError(f"unbalanced loop: unexpected warnings {report.warnings}")
+    passed += 1
+
+    joined_binary, _, _ = AssemblyHelper().convert_to_machine_code(['PUSHSTR "Hel" "lo\\n" "\\x41", 0 :RD'])
+    single_binary, _, _ = AssemblyHelper().convert_to_machine_code(['PUSHSTR "Hello\\nA", 0 :RD'])
+    if joined_binary != single_binary:
+        raise AssertionError("adjacent PUSHSTR literals should concatenate like one literal")
+    passed += 1
+
+    assemble_case("len of adjacent literals", ['LDI #LEN("ab" "c\\n")'], ["C4"])
+    passed += 1
+
+    for optimize in (False, True):
+        helper = AssemblyHelper()
+        binary, labels, constants = helper.convert_to_machine_code(
+            ["start: LDI $LIMIT", "CALL not_written_yet", "LDI LOW(@not_written_yet)", "HLT"],
+            optimize=optimize,
+            undefined_as_zero=True,
+        )
+        if labels != {"START": 0} or constants:
+            raise AssertionError(f"undef-zero must not add the missing symbols to the symbol tables: {labels} {constants}")
+        if binary[0].strip() != "11000000":
+            raise AssertionError(f"undef-zero: LDI $LIMIT should load 0, got {binary[0].strip()}")
+        expected_warnings = [
+            "Line <input>:1: undefined constant LIMIT assembled as 0 (--undef-zero)",
+            "Line <input>:2: undefined label NOT_WRITTEN_YET assembled as 0 (--undef-zero)",
+            "Line <input>:3: undefined label NOT_WRITTEN_YET assembled as 0 (--undef-zero)",
+        ]
+        if helper.last_warnings != expected_warnings:
+            raise AssertionError(f"undef-zero (optimize={optimize}): unexpected warnings {helper.last_warnings}")
+        passed += 1
+
+    helper = AssemblyHelper()
+    helper.convert_to_machine_code(["JMP later", "LDI @later", "later: HLT"], source_name="my prog.asm", undefined_as_zero=True)
+    if helper.last_warnings:
+        raise AssertionError(f"undef-zero must not assume labels defined later: {helper.last_warnings}")
+    helper.convert_to_machine_code(["LDI $LIMIT + 1"], source_name="my prog.asm", undefined_as_zero=True)
+    if [(d.file, d.line, d.message) for d in helper.last_diagnostics] != [
+        ("my prog.asm", 1, "undefined constant LIMIT assembled as 0 (--undef-zero)")
+    ] or helper.last_undefined_references[0].name != "LIMIT":
+        raise AssertionError(f"undef-zero with a spaced path: unexpected {helper.last_diagnostics}")
+    passed += 1
+
+    expect_error("undefined label without undef-zero", ["CALL not_written_yet", "HLT"], "Undefined label reference")
+    passed += 1
+
+    for width in (1, 2, 3):
+        args = AssembleArgs(input_file="<input>", length_prefix=width)
+        cli = AssemblerCLI()
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.configure(args)
+            prefixed, _, _ = cli.convert_source(["start: NOP", "PUSHSTR \"HELLO\"", "CALL start", "HLT"], "<input>", optimize=False)
+        header = [int(line, 2) for line in prefixed[:width]]
+        encoded_length = sum(value << (8 * index) for index, value in enumerate(header))
+        if encoded_length != len(prefixed) - width:
+            raise AssertionError(f"length prefix {header} does not match {len(prefixed) - width} program bytes")
+        passed += 1
+    try:
+        length_prefix(256, 1)
+    except ValueError as exc:
+        if "does not fit" not in str(exc):
+            raise AssertionError(f"length prefix overflow: unexpected error '{exc}'")
+    else:
+        raise AssertionError("length prefix overflow: expected failure")
+    passed += 1
+
+    def assemble_with_syntax(profile_name, source_lines):
+        args = AssembleArgs(input_file="<input>")
+        args.apply_syntax_profile(profile_name)
+        cli = AssemblerCLI()
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.configure(args)
+            binary, _, _ = cli.convert_source(source_lines, "<input>", optimize=False)
+        return [f"{int(line, 2):02X}" for line in binary]
+
+    dialect_cases = [
+        ("intel", ["start: LDI #1Fh ; suffix hex", "LDI #101b", "ORG 4", "DS 1, 0FFh", "PUSHI 'h'", "HLT"]),
+        ("gnu", ["start: LDI #0x1F // line comment", "/* block */ LDI #0b101", ".balign 4", ".space 1, 0xFF", "PUSHI 'h'", "HLT"]),
+    ]
+    native = AssemblyHelper().convert_to_machine_code(["LDI #0x1F", "LDI #0b101", ".org 4", ".fill 1, 0xFF", "PUSHI 'h'", "HLT"])[0]
+    native_hex = [f"{int(line, 2):02X}" for line in native]
+    for profile_name, source_lines in dialect_cases:
+        dialect_hex = assemble_with_syntax(profile_name, source_lines)
+        if dialect_hex != native_hex:
+            raise AssertionError(f"{profile_name} syntax: expected {native_hex}, got {dialect_hex}")
+        passed += 1
+
+    # GNU's `.skip` is the native `.space`, so its errors name `.space`.
+    if assemble_with_syntax("gnu", [".skip 2, 0xEE", "HLT"]) != ["EE", "EE", "01"]:
+        raise AssertionError("gnu syntax: .skip 2, 0xEE should emit EE EE")
+    try:
+        assemble_with_syntax("gnu", [".skip", "HLT"])
+    except ValueError as exc:
+        if ".space requires count" not in str(exc):
+            raise AssertionError(f"gnu .skip: unexpected error '{exc}'")
+    else:
+        raise AssertionError("gnu .skip without a count: expected failure")
+    passed += 1
+
+    expect_error("native syntax rejects suffix hex", ["LDI #1Fh"], "Unsupported operand value")
+    passed += 1
+
+    helper = AssemblyHelper()
+    try:
+        helper.convert_to_machine_code(
+            ["equ Limit 1", "    limit: NOP", "    FOO RA", "HLT"], source_name="prog.asm", warn_symbol_case=True
+        )
+    except ValueError:
+        pass
+    else:
+        raise AssertionError("diagnostics: expected failure")
+    observed = [(d.severity, d.file, d.line, d.column, d.message) for d in helper.last_diagnostics]
+    expected = [
+        ("error", "prog.asm", 3, 5, "Unknown instruction: FOO"),
+        ("warning", "prog.asm", 2, 5, "label 'limit' differs only in case from constant 'Limit' on line prog.asm:1; both name the symbol LIMIT"),
+    ]
+    if observed != expected:
+        raise AssertionError(f"diagnostics: expected {expected}, got {observed}")
+    helper.convert_to_machine_code(["NOP", "HLT"])
+    if helper.last_diagnostics:
+        raise AssertionError(f"diagnostics should reset on a clean build: {helper.last_diagnostics}")
+    passed += 1
+
+    # Columns come from the source as read: an expanded line points at its invocation.
+    helper = AssemblyHelper()
+    try:
+        helper.convert_to_machine_code([".macro BAD", "  FOO", ".endm", "NOP", "      BAD", "\tLDI #300"], source_name="prog.asm")
+    except ValueError:
+        pass
+    else:
+        raise AssertionError("diagnostic columns: expected failure")
+    observed = [(d.line, d.column) for d in helper.last_diagnostics]
+    if observed != [(5, 7), (6, 2)]:
+        raise AssertionError(f"diagnostic columns: expected [(5, 7), (6, 2)], got {observed}")
+    passed += 1
+
+    expect_error(
+        "labels differing only by case",
+        ["Loop: NOP", "loop: HLT"],
+        "('loop' and 'Loop' on line <input>:1 differ only in case; labels are case-insensitive)",
+    )
+    passed += 1
+
+    helper = AssemblyHelper()
+    helper.convert_to_machine_code(["equ Loop 1", "equ Count 2, count_2 3", "LOOP: LDI $loop", "HLT"], warn_symbol_case=True)
+    expected_warnings = [
+        "Line <input>:3: label 'LOOP' differs only in case from constant 'Loop' on line <input>:1; both name the symbol LOOP",
+    ]
+    if helper.last_warnings != expected_warnings:
+        raise AssertionError(f"warn-symbol-case: expected {expected_warnings}, got {helper.last_warnings}")
+    helper.convert_to_machine_code(["equ Loop 1", "LOOP: LDI $loop", "HLT"])
+    if helper.last_warnings:
+        raise AssertionError(f"symbol case warnings must be opt-in: {helper.last_warnings}")
+    passed += 1
+
+    # Case folding applies to mnemonics and symbols only; string and character literals keep their case.
+    assemble_case("lowercase pushstr", ['pushstr "Hi"', "ldi 'a'", "HLT"], ["C9", "33", "20", "C8", "32", "20", "C1", "33", "01"])
+    assemble_case("uppercase pushstr", ['PUSHSTR "hi"', "LDI 'A'", "HLT"], ["C9", "33", "20", "C8", "33", "20", "C1", "32", "01"])
+    strict_binary, _, _ = AssemblyHelper().convert_to_machine_code(["equ Delay 3", "Loop: LDI $Delay", "LDI 'a'", "HLT"], strict_case=True)
+    if to_hex_list(strict_binary) != ["C3", "C1", "33", "01"]:
+        raise AssertionError(f"strict-case: unexpected {to_hex_list(strict_binary)}")
+    strict_cases = [
+        (
+            ["equ Delay 3, Twice Delay * 2, Other DELAY", "Loop: LDI $delay", "JMP LOOP"],
+            [
+                "'DELAY' does not match the spelling 'Delay' defined on line <input>:1 (--strict-case)",
+                "'delay' does not match the spelling 'Delay' defined on line <input>:1 (--strict-case)",
+                "'LOOP' does not match the spelling 'Loop' defined on line <input>:2 (--strict-case)",
+            ],
+        ),
+        (
+            ["equ Delay 3", "equ DELAY 3", "HLT"],
+            ["constant 'DELAY' differs only in case from constant 'Delay' on line <input>:1; both name the symbol DELAY"],
+        ),
+    ]
+    for source_lines, fragments in strict_cases:
+        try:
+            AssemblyHelper().convert_to_machine_code(source_lines, strict_case=True)
+        except ValueError as exc:
+            for fragment in fragments:
+                if fragment not in str(exc):
+                    raise AssertionError(f"strict-case: expected {fragment!r} in {exc}")
+        else:
+            raise AssertionError(f"strict-case: expected {source_lines} to fail")
+    passed += 1
+
+    section_fill_source = [
+        "HLT", ".align 4", ".text fill=0xFF", ".align 8", ".org 10", ".fill 1", ".fill 1, 0",
+        ".data", "buffer: .fill 2", ".text", ".space 1", ".text fill=0", ".align 16",
+    ]
+    section_fill_bytes = ["01", "00", "00", "00", "FF", "FF", "FF", "FF", "FF", "FF", "FF", "00", "FF", "00", "00", "00"]
+    assemble_case(".text fill", section_fill_source, section_fill_bytes)
+    assemble_case(".text fill optimized", section_fill_source, section_fill_bytes, optimize=True)
+    expect_error(".data fill", [".data fill=0xFF", ".text", "HLT"], ".data takes no operands; its RAM is not initialized")
+    expect_error(".text operand", [".text 5", "HLT"], ".text takes only fill=BYTE, got '5'")
+    passed += 1
+
+    tree = AssemblyHelper().dump_expression_ast("(@TABLE + $OFFSET * 2) >> 1", {"TABLE": 0x10}, {"OFFSET": 3})
+    expected_tree = [
+        "BinOp >> = 11",
+        "  BinOp + = 22",
+        "    Label @TABLE = 16",
+        "    BinOp * = 6",
+        "      Constant $OFFSET = 3",
+        "      Number 2 = 2",
+        "  Number 1 = 1",
+    ]
+    if tree != expected_tree:
+        raise AssertionError(f"dump-ast: expected {expected_tree}, got {tree}")
+    passed += 1
+
+    assemble_case("__LINE__ in an expression", ["NOP", "", "LDI #__LINE__ + 1", "LDI #LEN(__FILE__)"], ["00", "C4", "C7"])
+    passed += 1
+
+    assemble_case(
+        "__LINE__ inside .if and .repeat bodies",
+        [".if 0", "NOP", ".else", "LDI #__LINE__", ".endif", ".repeat 2 {", "LDI #__LINE__", "}"],
+        ["C4", "C7", "C7"],
+    )
+    passed += 1
+
+    assemble_file_case(
+        "__LINE__ inside an include",
+        'NOP\n.include "inc.asm"\nLDI #__LINE__\n',
+        ["00", "00", "C2", "C3"],
+        include_files={"inc.asm": "NOP\nLDI #__LINE__ ; __LINE__ of inc.asm\n"},
+    )
+    passed += 1
+
+    def assemble_include_chain(levels, max_include_depth=None):
+        with tempfile.TemporaryDirectory() as tmpdir:
+            tmp_path = Path(tmpdir)
+            for level in range(1, levels + 1):
+                next_include = f'.include "level{level + 1}.asm"\n' if level < levels else "HLT\n"
+                (tmp_path / f"level{level}.asm").write_text(next_include, encoding="utf-8")
+            options = {} if max_include_depth is None else {"max_include_depth": max_include_depth}
+            binary_lines, _, _ = AssemblyHelper().convert_to_machine_code(
+                ['.include "level1.asm"'], source_name=str(tmp_path / "root.asm"), **options
+            )
+            return to_hex_list(binary_lines)
+
+    if assemble_include_chain(64) != ["01"]:
+        raise AssertionError("include chain at the default depth limit should assemble")
+    for levels, limit in ((65, None), (4, 3)):
+        try:
+            assemble_include_chain(levels, limit)
+        except ValueError as exc:
+            expected_limit = 64 if limit is None else limit
+            message = str(exc)
+            expected_chain = ("root.asm -> ", f"level{expected_limit}.asm -> ", f"level{expected_limit + 1}.asm")
+            if f"Include depth limit of {expected_limit} exceeded" not in message or not all(
+                part in message for part in expected_chain
+            ):
+                raise AssertionError(f"include depth limit: unexpected error {message}")
+        else:
+            raise AssertionError(f"include chain of {levels} should exceed the depth limit")
+    passed += 1
+
+    _, cdefine_labels, cdefine_constants = AssemblyHelper().convert_to_machine_code(
+        ["equ BAUD_DIV 26", "equ OFFSET -3", "start: NOP", "loop: NOP", "*inner: JMP @*inner"]
+    )
+    try:
+        format_c_defines(cdefine_labels, cdefine_constants, "SYMBOLS_H")
+    except ValueError as exc:
+        if "'LOOP__INNER' is a reserved C identifier" not in str(exc):
+            raise AssertionError(f"C defines: unexpected error {exc}")
+    else:
+        raise AssertionError("C defines: local label names should need --mangle")
+    cdefines_text = "".join(format_c_defines(cdefine_labels, cdefine_constants, "SYMBOLS_H", prefix="ARNI_", mangle=True))
+    for fragment in ("#define ARNI_LOOP 0x0001\n", "#define ARNI_LOOP_INNER 0x0002\n", "#define ARNI_OFFSET (-3)\n"):
+        if fragment not in cdefines_text:
+            raise AssertionError(f"C defines: expected '{fragment.strip()}' in:\n{cdefines_text}")
+    assert_c_compiles(
+        "C defines",
+        cdefines_text,
+        '_Static_assert(ARNI_LOOP_INNER == 2, "label address");\n'
+        '_Static_assert(ARNI_BAUD_DIV - ARNI_OFFSET == 29, "constants");\n'
+        "int main(void) { return ARNI_START; }\n",
+    )
+    passed += 1
+
+    # Sources are read whole, and unreadable ones fail with an error naming the file instead of a traceback.
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        long_source = tmp_path / "long.asm"
+        long_source.write_text("".join(f"LDI #{value % 32}  ; line {value} of a source well past 100 bytes\n" for value in range(40)), encoding="utf-8")
+        (tmp_path / "latin1.asm").write_bytes(b"NOP ; caf\xe9\n")
+        for source_path, expected in (
+            (long_source, None),
+            (tmp_path / "latin1.asm", "is not UTF-8 text (byte 0xE9 at offset 9)"),
+            (tmp_path, "Cannot read input file"),
+        ):
+            result = subprocess.run(
+                [sys.executable, str(Path(__file__).with_name("main.py")), "assemble", str(source_path), str(tmp_path / "read.txt")],
+                capture_output=True,
+                text=True,
+            )
+            if expected is None:
+                read_bytes = (tmp_path / "read.txt").read_text(encoding="utf-8").split()
+                if result.returncode != 0 or len(read_bytes) != 40 or read_bytes[-1] != f"{0xC0 | 7:08b}":
+                    raise AssertionError(f"long source should assemble whole: {result.stdout}")
+            elif result.returncode != 1 or expected not in result.stdout or "Traceback" in result.stderr:
+                raise AssertionError(f"unreadable source {source_path.name}: {result.returncode} {result.stdout} {result.stderr}")
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as tmpdir:
+        ihex_source = Path(tmpdir) / "ihex.asm"
+        ihex_source.write_text("start: LDI #5\n.fill 17, #0xA5\nJMP start\n", encoding="utf-8")
+        ihex_cli = AssemblerCLI()
+        ihex_cli.configure(AssembleArgs(input_file=str(ihex_source)))
+        with contextlib.redirect_stdout(io.StringIO()):
+            ihex_cli.create_ihex(str(ihex_source), str(Path(tmpdir) / "ihex.hex"))
+        ihex_text = (Path(tmpdir) / "ihex.hex").read_text(encoding="utf-8")
+    ihex_binary, _, _ = AssemblyHelper().convert_to_machine_code(["start: LDI #5", ".fill 17, #0xA5", "JMP start"])
+    ihex_bytes = bytes(int(line, 2) for line in ihex_binary)
+    ihex_records = ihex_text.splitlines()
+    # Each record: byte count, address, type, data, then the two's complement of the byte sum.
+    ihex_data = b""
+    for record in ihex_records:
+        fields = bytes.fromhex(record[1:])
+        if not record.startswith(":") or fields[0] != len(fields) - 5 or sum(fields) & 0xFF != 0:
+            raise AssertionError(f"intel hex: bad record {record!r}")
+        ihex_data += fields[4:-1]
+    if (
+        [record[:9] for record in ihex_records] != [":10000000", f":{len(ihex_bytes) - 16:02X}001000", ":00000001"]
+        or ihex_records[-1] != ":00000001FF"
+        or ihex_data != ihex_bytes
+    ):
+        raise AssertionError(f"intel hex: unexpected records for {ihex_bytes.hex()}:\n{ihex_text}")
+    passed += 1
+
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        (tmp_path / "numeric.asm").write_text("start:\n1: NOP\nJMP 1b\nJMP 1f\n1: HLT\n", encoding="utf-8")
+        cli = AssemblerCLI()
+        cli.configure(AssembleArgs(input_file="numeric.asm", symbols_file=str(tmp_path / "numeric.sym")))
+        with contextlib.redirect_stdout(io.StringIO()):
+            cli.create_c_defines(str(tmp_path / "numeric.asm"), str(tmp_path / "numeric.h"))
+        header = (tmp_path / "numeric.h").read_text(encoding="utf-8")
+        symbols = (tmp_path / "numeric.sym").read_text(encoding="utf-8")
+        if "#define START 0x0000\n" not in header or "__N" in header or "__N" in symbols:
+            raise AssertionError(f"numeric labels must not be exported:\n{header}{symbols}")
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        (tmp_path / "set.asm").write_text(".set COUNT 1\nLDI #$COUNT\n.set COUNT 2\nLDI #$COUNT\n", encoding="utf-8")
+        with contextlib.redirect_stdout(io.StringIO()) as summary:
+            AssemblerCLI().create_c_defines(str(tmp_path / "set.asm"), str(tmp_path / "set.h"))
+        header = (tmp_path / "set.h").read_text(encoding="utf-8")
+        if "#define COUNT 2\n" not in header or "__SET" in header or "Constants: 1\n" not in summary.getvalue():
+            raise AssertionError(f".set aliases must not be exported:\n{header}{summary.getvalue()}")
+    _, numeric_labels, _ = AssemblyHelper().convert_to_machine_code(["1: NOP", "JMP 1b"])
+    if numeric_labels:
+        raise AssertionError(f"numeric labels must not be exported: {numeric_labels}")
+    passed += 1
+
+    if [parse_rom_size(text) for text in ("32768", "0x8000", "32K")] != [32768] * 3:
+        raise AssertionError("ROM size parsing: expected 32768 for every spelling")
+    with tempfile.TemporaryDirectory() as tmpdir:
+        tmp_path = Path(tmpdir)
+        (tmp_path / "program.txt").write_text("11000001\n00000001\n", encoding="utf-8")
+        with contextlib.redirect_stdout(io.StringIO()):
+            AssemblerCLI().create_bin(str(tmp_path / "program.txt"), str(tmp_path / "program.bin"), 32 * 1024, 0xFF)
+        image = (tmp_path / "program.bin").read_bytes()
+        if len(image) != 32768 or image[:2] != b"\xc1\x01" or set(image[2:]) != {0xFF}:
+            raise AssertionError(f"padded ROM image: unexpected {len(image)}-byte image starting {image[:4].hex()}")
+        with contextlib.redirect_stdout(io.StringIO()):
+            AssemblerCLI().create_bin(str(tmp_path / "program.txt"), str(tmp_path / "split.bin"), 8, 0xFF, parse_split("HI, lo"))
+        checksum_lines = (tmp_path / "split.checksums.txt").read_text(encoding="utf-8").splitlines()
+        if (
+            (tmp_path / "split.hi.bin").read_bytes() != b"\xc1\xff\xff\xff"
+            or (tmp_path / "split.lo.bin").read_bytes() != b"\x01\xff\xff\xff"
+            or (tmp_path / "split.bin").exists()
+            or checksum_lines[1] != f"split.hi.bin  4 bytes  sum16=0x03BE  crc32=0x{binascii.crc32(bytes([0xC1, 0xFF, 0xFF, 0xFF])):08X}"
+            or not checksum_lines[0].startswith("split.bin (combined)  8 bytes  sum16=0x06BC  ")
+        ):
+            raise AssertionError(f"split ROM images: unexpected output {checksum_lines}")
+    if split_interleaved(b"\x01\x02\x03\x04") != (b"\x01\x03", b"\x02\x04"):
+        raise AssertionError("split ROM images: expected even then odd bytes")
+    try:
+        parse_split("hi,hi")
+    except ValueError as exc:
+        if "--split must be one of hi,lo / lo,hi / even,odd" not in str(exc):
+            raise AssertionError(f"split ROM images: unexpected error {exc}")
+    else:
+        raise AssertionError("split ROM images: hi,hi should be rejected")
+    passed += 1
+
+    mif_text = "".join(format_mif([0xC1, 0x01], depth=6))
+    for fragment in ("WIDTH=8;\n", "DEPTH=6;\n", "    0000 : C1;\n", "    0001 : 01;\n", "    [0002..0005] : 00;\n", "END;\n"):
+        if fragment not in mif_text:
+            raise AssertionError(f"MIF output: expected '{fragment.strip()}' in:\n{mif_text}")
+    coe_lines = format_coe([0xC1, 0x01], depth=3)
+    if coe_lines != ["memory_initialization_radix=16;\n", "memory_initialization_vector=\n", "C1,\n", "01,\n", "00;\n"]:
+        raise AssertionError(f"COE output: unexpected {coe_lines}")
+    passed += 1
+
+    logisim_lines = format_logisim_image([0xC1, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x07, 0x00, 0x00])
+    if logisim_lines != ["v2.0 raw\n", "c1 1 5*ff 0 0 7\n"]:
+        raise AssertionError(f"Logisim image: unexpected {logisim_lines}")
+    passed += 1
+
+    assert_listing_case(
+        "listing shows referenced symbol values",
+        ["equ LIMIT 0x2A", "start: LDI $LIMIT", "LDI #LOW(@start) + LIMIT", "JMP start"],
+        [
+            "[2] start: LDI $LIMIT  ; $LIMIT=0x2A\n",
+            "[3] LDI #LOW(@start) + LIMIT  ; @START=0x0000, LIMIT=0x2A\n",
+            "[4] JMP start  ; START=0x0000\n",
+        ],
+    )
+    passed += 1
+
+    cli = AssemblerCLI()
+    cli.error_format = "gnu"
+    cli.warn_symbol_case = True
+    with contextlib.redirect_stdout(io.StringIO()):
+        cli.convert_source(["equ Limit 1", "    limit: HLT"], "prog.asm", optimize=False)
+    expected_warning = "prog.asm:2:5: warning: label 'limit' differs only in case from constant 'Limit' on line prog.asm:1; both name the symbol LIMIT"
+    if cli.helper.last_warnings != [expected_warning]:
+        raise AssertionError(f"gnu error format: unexpected warnings {cli.helper.last_warnings}")
+    try:
+        cli.convert_source(["start: NOP", "    FOO RA", "  BAR", "JMP start"], "prog.asm", optimize=False)
+    except ValueError as exc:
+        expected_message = "2 errors:\nprog.asm:2:5: error: Unknown instruction: FOO\nprog.asm:3:3: error: Unknown instruction: BAR"
+        if str(exc) != expected_message:
+            raise AssertionError(f"gnu error format: unexpected error {exc}")
+    else:
+        raise AssertionError("gnu error format: expected failure")
+    passed += 1
+
+    helper = AssemblyHelper()
+    try:
+        helper.convert_to_machine_code(["equ A MISSING + 1", "equ B 2", "equ C", "start: NOP", "start: HLT"])
+    except ValueError as exc:
+        if not str(exc).startswith("2 errors:\n") or [d.line for d in helper.last_diagnostics] != [1, 3]:
+            raise AssertionError(f"collected constant errors: unexpected {exc}")
+    else:
+        raise AssertionError("collected constant errors: expected failure")
+    try:
+        helper.convert_to_machine_code(["a: NOP", "a: NOP", "b: NOP", "b: HLT", "FOO"])
+    except ValueError as exc:
+        if [(d.line, d.message) for d in helper.last_diagnostics] != [(2, "Duplicate label definition: A"), (4, "Duplicate label definition: B")]:
+            raise AssertionError(f"collected duplicate labels: unexpected {helper.last_diagnostics}")
+    else:
+        raise AssertionError("collected duplicate labels: expected failure")
+    try:
+        helper.convert_to_machine_code(["equ A MISSING", "equ C"], fail_fast=True)
+    except ValueError as exc:
+        if str(exc) != "Error on line <input>:1 ('equ A MISSING'): Unknown constant in expression: MISSING":
+            raise AssertionError(f"fail-fast constant errors: unexpected {exc}")
+    else:
+        raise AssertionError("fail-fast constant errors: expected failure")
+    passed += 1
+
+    data_source = [
+        "start:",
+        "JMP main",
+        'version: .asciiz "v1", "ok"',
+        "table: .byte 1, 0xFF, -1, 'A', LOW(@table)",
+        "words: .word 0x1234, @words, -2",
+        ".space 1, #0xEE",
+        "main:",
+        "HLT",
+    ]
+    data_helper = AssemblyHelper()
+    data_binary, data_labels, _ = data_helper.convert_to_machine_code(data_source)
+    expected_data = bytes([0xD9, 0x30, 0xA8, 0xC0, 0x30, 0xB0, 0x1F]) + b"v1\x00ok\x00" + bytes([0x01, 0xFF, 0xFF, 0x41, 0x0D])
+    expected_data += bytes([0x34, 0x12, 0x12, 0x00, 0xFE, 0xFF, 0xEE, 0x01])
+    if bytes(int(line, 2) for line in data_binary) != expected_data or data_labels["MAIN"] != 25:
+        raise AssertionError(f"data directives: unexpected image {to_hex_list(data_binary)} or labels {data_labels}")
+    for bad_line, message in [
+        (".byte 256", ".byte value 256 resolves to 256, out of range (-128..255)"),
+        (".word 0x10000", ".word value 0x10000 resolves to 65536, out of range (-32768..65535)"),
+        (".byte", ".byte requires a comma-separated list of values"),
+        (".ascii 5", ".ascii expects a quoted string literal, got 5"),
+    ]:
+        expect_error(f"data directive {bad_line}", [bad_line], message)
+    expect_error("entry in data bytes", [".entry table", "HLT", "table: .byte 1"], "is in the .byte bytes of 'table: .byte 1'")
+    passed += 1
+
+    # Several .org regions: labels take each region's origin and the gaps are filled in the image.
+    org_helper = AssemblyHelper()
+    org_binary, org_labels, _ = org_helper.convert_to_machine_code(
+        ["start: JMP main", ".org 0x20", "main: LDI @table[7:0]", "JMP main", ".org 0x40, #0xFF", "table: .fill 2, #0xAA"]
+    )
+    org_jump_main = bytes.fromhex("C0 31 A8 C0 30 B0 1F")
+    if (
+        org_labels != {"START": 0x00, "MAIN": 0x20, "TABLE": 0x40}
+        or bytes(int(line, 2) for line in org_binary)
+        != org_jump_main + bytes(0x20 - 7) + bytes.fromhex("C0 32") + org_jump_main + b"\xFF" * (0x40 - 0x29) + b"\xAA\xAA"
+        or [entry.address for entry in org_helper.last_listing if entry.binary_bytes][-2:] != [0x29, 0x40]
+    ):
+        raise AssertionError(f".org regions: unexpected {org_labels} {to_hex_list(org_binary)}")
+    passed += 1
+
+    endian_source = [".word 0x1234", ".endian big", "net: .word 0x1234, @net", ".byte 1, 2", ".endian little", ".word 0xABCD"]
+    endian_hex = "34 12 12 34 00 02 01 02 CD AB".split()
+    assemble_case("endian word tables", endian_source, endian_hex)
+    assemble_case("endian word tables optimized", endian_source, endian_hex, optimize=True)
+    expect_error(".endian operand", [".endian middle", "HLT"], ".endian takes 'little' or 'big'")
+    passed += 1
+
+    label_equ_source = [
+        "equ BUFSIZE 4",
+        "equ BUFEND buffer + BUFSIZE - 1",
+        "equ PAST @buffer + $BUFSIZE",
+        "equ AFTER BUFEND + 1",
+        "LDI $BUFEND",
+        "LDI $PAST",
+        "LDI AFTER",
+        "LDI (BUFEND >> 1)",
+        "buffer:",
+        "HLT",
+    ]
+    assemble_case("equ with labels", label_equ_source, ["C7", "C8", "C8", "C3", "01"])
+    assemble_case("equ with labels optimized", label_equ_source, ["C7", "C8", "C8", "C3", "01"], optimize=True)
+    expect_error("equ with a label twice", ["equ END stop", "equ END stop + 1", "stop:", "HLT"], "Duplicate constant definition: END")
+    for expression, expected in [("$X", "C2"), ("1 + $X", "C3"), ("($X)", "C2"), ("LOW($X)", "C2"), ("MAX(1, $X)", "C2")]:
+        assemble_case(f"equ {expression}", ["equ X 2", f"equ Y {expression}", "LDI $Y"], [expected])
+    passed += 1
+
+    assemble_case("numeric literal formats", ["LDI #31", "LDI #0x1F", "LDI #0b11111", "LDI #0o37", "LDI 0o37"], ["DF"] * 5)
+    passed += 1
+
+    expect_error("LDI operand above a byte", ["LDI #300"], "LDI operand #300 resolves to 300, out of range (-128..255)")
+    passed += 1
+
+    expect_error("LDI wide constant", ["equ WIDE 0x123", "LDI RD, $WIDE"], "LDI operand $WIDE resolves to 291")
+    passed += 1
+
+    expect_error("PUSHI operand below a signed byte", ["PUSHI #-129"], "PUSHI operand #-129 resolves to -129, out of range (-128..255)")
+    passed += 1
+
+    assemble_case("LDI negative and LOW() operands", ["LDI #-1", "LDI #LOW(0x1234)"], ["DF", "37", "D4", "31"])
+    passed += 1
+
+    expect_error(
+        "jump target beyond 16 bits",
+        ["JMP far", ".org 0x10000", "far: HLT"],
+        "JMP target address far resolves to 65536, out of range (0x0000-0xFFFF)",
+    )
+    passed += 1
+
+    assemble_case(
+        "macro parameters and unique labels",
+        [
+            ".macro countdown reg, n",
+            "    LDI \\reg, #\\n",
+            "wait_\\@: JNE wait_\\@",
+            ".endm",
+            "start: countdown RD, 3",
+            "    countdown RA, 4",
+        ],
+        ["E3", "C1", "30", "A8", "C0", "30", "B0", "19", "C4", "C9", "30", "A8", "C0", "30", "B0", "19"],
+    )
+    passed += 1
+
+    assemble_case(
+        "macro calling macro",
+        [".macro pair a, b", "LDI #\\a", "LDI #\\b", ".endm", ".macro quad x", "pair \\x, \\x", "pair MAX(1, 2), 3", ".endm", "quad 7"],
+        ["C7", "C7", "C2", "C3"],
+    )
+    passed += 1
+
+    assemble_file_case(
+        "macro from include",
+        '.include "macros.asm"\nstart: twice\n',
+        ["00", "00"],
+        include_files={"macros.asm": ".macro twice\n    NOP\n    NOP\n.endm\n"},
+    )
+    passed += 1
+
+    expect_error("macro argument count", [".macro mac a, b", "NOP", ".endm", "mac 1"], "Macro MAC expects 2 argument(s), got 1")
+    passed += 1
+
+    assemble_case(
+        "macro parameter defaults",
+        [".macro delay count=10, step=1", "LDI #\\count", "SUBI #\\step", ".endm", "delay", "delay 3", "delay 3, 2"],
+        ["CA", "69", "C3", "69", "C3", "6A"],
+    )
+    expect_error("too few macro arguments", [".macro put addr, value=0", "NOP", ".endm", "put"], "Macro PUT expects 1 to 2 argument(s), got 0")
+    expect_error("too many macro arguments", [".macro put addr, value=0", "NOP", ".endm", "put 1, 2, 3"], "Macro PUT expects 1 to 2 argument(s), got 3")
+    expect_error("macro default order", [".macro mac a=1, b", ".endm"], ".macro parameter b needs a default because an earlier parameter has one")
+    expect_error("empty macro default", [".macro mac a=", ".endm"], ".macro parameter a has an empty default")
+    passed += 1
+
+    expect_error("recursive macro", [".macro loop", "loop", ".endm", "loop"], "Macro expansion is recursive: LOOP -> LOOP")
+    passed += 1
+
+    macro_chain = "\n".join([
+        ".macro m4", "NOP", ".endm",
+        ".macro m3", "m4", ".endm",
+        ".macro m2", "m3", ".endm",
+        ".macro m1", "m2", ".endm",
+        "m1",
+    ])
+    expect_assembly(macro_chain, bytes([0x00]), options=AssembleOptions(max_macro_depth=4))
+    expect_assembly(
+        macro_chain,
+        diagnostics=["<input>:5:1: error: Macro expansion exceeds the nesting limit of 3: M1 -> M2 -> M3 -> M4"],
+        options=AssembleOptions(max_macro_depth=3),
+    )
+    passed += 1
+
+    expect_error("macro shadowing a mnemonic", [".macro push x", ".endm"], "Macro name push is an instruction or directive")
+    expect_error("macro shadowing a jump alias", [".macro jz", ".endm"], "Macro name jz is an instruction or directive")
+    expect_error("macro shadowing a register", [".macro rb x", "NOP", ".endm"], "Macro name rb is a register")
+    expect_error("macro shadowing a register", [".macro marl", ".endm"], "Macro name marl is a register")
+    passed += 1
+
+    expect_error("unterminated macro", [".macro mac", "NOP"], "missing closing '.endm' for .macro block")
+    passed += 1
+
+    expect_file_error(
+        "include cycle names the closing line",
+        '.include "lib/a.asm"\nNOP\n',
+        "b.asm:2 ('.include \"a.asm\"'): Recursive include detected:",
+        include_files={"lib/a.asm": '.include "b.asm"\n', "lib/b.asm": 'NOP\n.include "a.asm"\n'},
+    )
+    passed += 1
+
+    helper = AssemblyHelper()
+    ifdef_source = [".ifdef DEBUG", "LDI #1", ".ifndef VERBOSE", "LDI #2", ".endif", ".else", "LDI #3", ".endif"]
+    for defines, expected in ((None, ["C3"]), ({"debug": 0}, ["C1", "C2"]), ({"DEBUG": 1, "VERBOSE": 1}, ["C1"])):
+        binary_lines, _, _ = helper.convert_to_machine_code(ifdef_source, defines=defines)
+        if to_hex_list(binary_lines) != expected:
+            raise AssertionError(f".ifdef/.ifndef with {defines}: expected {expected}, got {to_hex_list(binary_lines)}")
+    passed += 1
+
+    expect_error(".ifdef needs one name", [".ifdef A B", ".endif"], ".ifdef requires a single symbol name")
+    passed += 1
+
+    cli = AssemblerCLI()
+    cli.configure(AssembleArgs(input_file="prog.asm", defines={"DEBUG": 1, "UART_BASE": 0xF0}))
+    with contextlib.redirect_stdout(io.StringIO()):
+        binary_lines, _, constants = cli.convert_source(
+            ["equ UART_DATA UART_BASE + 1", ".ifdef DEBUG", "LDI $UART_DATA", ".endif", "HLT"], "prog.asm", optimize=False
+        )
+    if to_hex_list(binary_lines) != ["D1", "37", "01"] or constants.get("UART_BASE") != 0xF0:
+        raise AssertionError(f"command-line defines: got {to_hex_list(binary_lines)}, constants {constants}")
+    passed += 1
+
+    helper = AssemblyHelper()
+    try:
+        helper.convert_to_machine_code(["equ DEBUG 0", "HLT"], defines={"DEBUG": 1})
+    except ValueError as exc:
+        if "Constant DEBUG is already set to 1 by a command-line or build-matrix define" not in str(exc):
+            raise AssertionError(f"define redefined by equ: unexpected error {exc}")
+    else:
+        raise AssertionError("define redefined by equ: expected failure")
+    if parse_define("uart_base=0xF0", AssemblyHelper().evaluate_expression) != ("UART_BASE", 0xF0):
+        raise AssertionError("parse_define: expected ('UART_BASE', 240)")
+    passed += 1
+
+    assemble_case(
+        "numeric labels back and forward",
+        ["f: NOP", "1: NOP", "JNE 1b", "JMP 1f", "*x: NOP", "1: HLT", "JMP *x", "PUSHSTR \"1b\""],
+        [
+            "00", "00", "C1", "30", "A8", "C0", "30", "B0", "19", "D1", "30", "A8", "C0", "30", "B0", "1F",
+            "00", "01", "D0", "30", "A8", "C0", "30", "B0", "1F", "C2", "33", "20", "D1", "31", "20",
+        ],
+    )
+    passed += 1
+
+    expect_error("numeric label without a later definition", ["1: NOP", "JMP 1f"], "Numeric label reference 1f has no '1:' after it")
+    passed += 1
+
+    helper = AssemblyHelper()
+    binary_lines, _, constants = helper.convert_to_machine_code(
+        [".set N 1", "LDI $N", ".set N N + 1", "LDI N", "equ A N * 2", "LDI $A", "PUSHSTR \"N\""]
+    )
+    if to_hex_list(binary_lines) != ["C1", "C2", "C4", "CE", "32", "20"] or constants["N"] != 2:
+        raise AssertionError(f".set redefinition: got {to_hex_list(binary_lines)}, constants {constants}")
+    passed += 1
+
+    expect_error(
+        "duplicate equ",
+        ["equ LIMIT 1", "equ LIMIT 1", "NOP", "equ limit 2"],
+        "('equ limit 2'): Duplicate constant definition: LIMIT = 2 (first defined as 1 on line <input>:1; use .set for a redefinable symbol)",
+    )
+    passed += 1
+
+    expect_error(".set cannot redefine equ", ["equ A 1", ".set A 2"], "A is an equ constant (line <input>:1); .set cannot redefine it")
+    passed += 1
+
+    result = assemble("start: LDI $VALUE\nJMP start\n", AssembleOptions(defines={"VALUE": 1}))
+    if not result.ok or result.binary != bytes.fromhex("C1C030A8C030B01F") or result.labels != {"START": 0}:
+        raise AssertionError(f"library assemble: unexpected result {result}")
+    result = assemble(["start: NOP", "FOO", "JMP strat"])
+    if result.ok or result.binary or [(d.line, d.message) for d in result.errors] != [
+        (2, "Unknown instruction: FOO"),
+        (3, "Undefined label reference: strat (did you mean START?)"),
+    ]:
+        raise AssertionError(f"library assemble errors: unexpected result {result}")
+    expect_assembly("LDI #0x1F // comment\n/* block */ HLT", "DF 01", options=AssembleOptions(syntax="gnu"))
+    expect_assembly("LDI #1Fh ; comment\nHLT", "DF 01", options=AssembleOptions(syntax="intel"))
+    expect_assembly("NOP", diagnostics=["<input>: error: Unknown syntax profile 'nope'; choose one of: arnicomp, intel, gnu"], options=AssembleOptions(syntax="nope"))
+    passed += 1
+
+    source_text = "equ COUNT 3\r\nstart: LDI $COUNT\n  CALL start ; loop\n\nHLT"
+    memory_options = AssembleOptions(source_name="mem.asm", optimize=True)
+    from_lines = assemble(source_text.splitlines(keepends=True), memory_options)
+    for memory_source in (source_text, source_text.encode("utf-8")):
+        from_memory = assemble(memory_source, memory_options)
+        if (from_memory.binary, from_memory.labels, from_memory.constants) != (from_lines.binary, from_lines.labels, from_lines.constants):
+            raise AssertionError(f"assemble({type(memory_source).__name__}) differs from the line API: {from_memory} != {from_lines}")
+    memory_errors = [str(error) for error in assemble("NOP\nFOO\n", AssembleOptions(source_name="mem.asm")).errors]
+    if not memory_errors or not memory_errors[0].startswith("mem.asm:2:"):
+        raise AssertionError(f"assemble(str) should report source line numbers: {memory_errors}")
+    passed += 1
+
+    spaced_source = (
+        "equ LIMIT 5, STEP 1\n.macro twice reg, n=1\n  ADDI \\n\n  MOV RD, \\reg\n.endm\n"
+        "start: LDI RA, $LIMIT\nloop:  twice RA, 2\n  SUBI #1\n  JNE loop\n  HLT\n"
+        ".byte 1, 2\n.set N 3\n.org 0x40\nHLT\n"
+    )
+    spaced_binary = assemble(spaced_source).binary
+    for variant in (
+        spaced_source.replace(" ", "\t"),
+        spaced_source.replace(" ", "   "),
+        spaced_source.replace(" ", " \t "),
+        spaced_source.replace(", ", ","),
+    ):
+        variant_result = assemble(variant)
+        if not variant_result.ok or variant_result.binary != spaced_binary:
+            raise AssertionError(f"whitespace variant assembles differently: {variant!r} -> {variant_result}")
+    passed += 1
+
+    helper = AssemblyHelper()
+    helper.convert_to_machine_code(["equ X 2", "start: LDI $X + 1", "MOV RD, RA", "LDL RA, $X[4:0]", "CALL start :RA"])
+    document = json.loads(json.dumps(helper.program_document("prog.asm")))
+    first = document["statements"][0]
+    if (
+        document["labels"] != {"START": 0}
+        or first["label"] != "START"
+        or first["bytes"] != ["C3"]
+        or first["operands"][0]["tree"]["value"] != 3
+        or [child["node"] for child in first["operands"][0]["tree"]["children"]] != ["Constant", "Number"]
+        or [operand["kind"] for operand in document["statements"][1]["operands"]] != ["register", "register"]
+        or document["statements"][2]["operands"][1]["kind"] != "slice"
+        or document["statements"][3]["operands"][1] != {"text": ":RA", "kind": "modifier"}
+    ):
+        raise AssertionError(f"program JSON: unexpected document {document}")
+    passed += 1
+
+    opcodes = build_opcode_table({
+        "add": {"encoding": "01000 sss"},
+        "inc": {"encoding": "0000001x"},
+        "nop": {"encoding": "00000000"},
+        "ldi": {"encoding": "pseudo over LDL/LDH"},
+    })
+    if opcodes != {"ADD": "01000", "INC": "0000001", "NOP": "00000000"}:
+        raise AssertionError(f"opcode table: unexpected {opcodes}")
+    passed += 1
+
+    v1_result = assemble(
+        "equ STEP 3\nstart: LDI #100\nMOV RD, RA\nADDI $STEP\nOUT RA\nJNE\nLDI @start\n",
+        AssembleOptions(target="arnicomp-v1"),
+    )
+    if not v1_result.ok or list(v1_result.binary) != [0xE4, 0x48, 0x1B, 0x78, 0x17, 0x80]:
+        raise AssertionError(f"arnicomp-v1 target: unexpected result {v1_result.binary.hex()} {v1_result.diagnostics}")
+    passed += 1
+
+    for source, substring in (
+        ("HLT", "HLT is not an arnicomp-v1 instruction; HLT is supported on: arnicomp-v2"),
+        ("FOO", "FOO is not an arnicomp-v1 instruction; valid: MOV"),
+        ("ADDI #8", "ADDI immediate value 8 out of range (0-7) on arnicomp-v1"),
+        ("LDI #128", "LDI immediate value 128 out of range (0-127) on arnicomp-v1"),
+        ("MOV RB, RA", "MOV operand RB must be one of"),
+        ("OUT RA, RD", "OUT expects 1 operand(s) on arnicomp-v1, got 2"),
+    ):
+        v1_errors = [str(diagnostic) for diagnostic in assemble(source, AssembleOptions(target="arnicomp-v1")).errors]
+        if not any(substring in error for error in v1_errors):
+            raise AssertionError(f"arnicomp-v1 target: expected '{substring}' for {source!r}, got {v1_errors}")
+        passed += 1
+
+    for source in ("OUT RA", "LDRL RA"):
+        mnemonic = source.split()[0]
+        expect_error(
+            "v1-only instruction on arnicomp-v2",
+            [source],
+            f"{mnemonic} is not an arnicomp-v2 instruction; {mnemonic} is supported on: arnicomp-v1",
+        )
+        passed += 1
+
+    optimized_v1 = assemble("LDI #1", AssembleOptions(target="arnicomp-v1", optimize=True))
+    if not any("only available for the arnicomp-v2 target" in str(error) for error in optimized_v1.errors):
+        raise AssertionError(f"arnicomp-v1 target: optimize mode should be rejected, got {optimized_v1.diagnostics}")
+    passed += 1
+
+    pseudo_result = assemble(
+        "start: MOVI RB, 0x41\nSETB 2\nHLT",
+        AssembleOptions(pseudo_instructions={"SETB": {"parameters": ["value"], "expansion": ["LDI \\value", "MOV RB, RA"]}}),
+    )
+    if not pseudo_result.ok or list(pseudo_result.binary) != [0xC1, 0x32, 0x90, 0xC2, 0x90, 0x01] or pseudo_result.labels != {"START": 0}:
+        raise AssertionError(f"pseudo-instructions: unexpected result {pseudo_result.binary.hex()} {pseudo_result.diagnostics}")
+    passed += 1
+
+    for table, substring in (
+        ({"HLT": {"expansion": ["NOP"]}}, "Invalid pseudo-instruction HLT in <input>: name is an instruction or directive"),
+        ({"SETB": {"parameters": ["value"]}}, "'expansion' must be a non-empty list of source lines"),
+    ):
+        pseudo_errors = [str(error) for error in assemble("NOP", AssembleOptions(pseudo_instructions=table)).errors]
+        if not any(substring in error for error in pseudo_errors):
+            raise AssertionError(f"pseudo-instructions: expected '{substring}', got {pseudo_errors}")
+        passed += 1
+
+    expect_error(
+        "pseudo-instruction redefined by .macro",
+        [".macro movi dest, value", "NOP", ".endm"],
+        "Macro MOVI is already defined as a pseudo-instruction in",
+    )
+    passed += 1
+
+    assemble_case(
+        "register aliases with shadowing",
+        [".reg counter, RB", "MOV counter, RA", "MOV RA, counter", ".reg counter, RD", "MOV counter, ACC", "PUSHSTR \"counter\""],
+        ["90", "82", "8B"] + [byte for pair in ("D2", "C5", "D4", "CE", "D5", "CF", "C3") for byte in (pair, "33", "20")],
+        expected_warnings=0,
+    )
+    passed += 1
+
+    helper = AssemblyHelper()
+    helper.convert_to_machine_code([".reg counter, RB", ".reg index, RB", "MOV index, RA"])
+    if len(helper.last_warnings) != 1 or "register alias INDEX names RB, which is still aliased as COUNTER" not in helper.last_warnings[0]:
+        raise AssertionError(f"register aliases: expected a same-register warning, got {helper.last_warnings}")
+    passed += 1
+
+    for source_lines, substring in (
+        ([".reg counter, R3"], "Unknown register R3 for .reg COUNTER"),
+        ([".reg acc, RB"], ".reg name ACC is already a register or instruction name"),
+        (["counter: NOP", ".reg counter, RB"], ".reg name COUNTER is also a label"),
+        ([".reg counter"], "Invalid .reg definition: expected '.reg NAME, REGISTER'"),
+    ):
+        expect_error("register alias error", source_lines, substring)
+        passed += 1
+
+    section_source = "\n".join([
+        ".data",
+        "counter: .fill 1",
+        "buffer: .fill 16",
+        ".text",
+        "start: LDI @buffer[7:0]",
+        ".data",
+        ".align 4",
+        "flags: .fill 1",
+        "tail: .space 2",
+        ".text",
+        "LDI @flags[7:0]",
+        "JMP start",
+    ])
+    for optimize in (False, True):
+        section_result = assemble(section_source, AssembleOptions(data_base=0x40, optimize=optimize))
+        expected_labels = {"COUNTER": 0x40, "BUFFER": 0x41, "FLAGS": 0x54, "TAIL": 0x55, "START": 0}
+        if not section_result.ok or section_result.labels != expected_labels or section_result.binary[:1] != bytes([0xC1]):
+            raise AssertionError(f"sections (optimize={optimize}): unexpected {section_result.labels} {section_result.diagnostics}")
+        passed += 1
+
+    for source_lines, substring in (
+        ([".data", "NOP"], "NOP cannot appear in .data"),
+        ([".data", ".byte 1"], ".BYTE cannot appear in .data; only labels and .fill, .space, .org, .padto, and .align"),
+        ([".data", "table: .fill 2, #0xFF"], ".FILL in .data reserves uninitialized RAM and takes no fill byte"),
+        ([".data 0x100"], ".data takes no operands"),
+        ([".entry counter", ".data", "counter: .fill 1", ".text", "HLT"], "entry point counter is a .data label"),
+        (["table: NOP", ".data", "table: .fill 1"], "Duplicate label definition: TABLE"),
+    ):
+        expect_error("data section error", source_lines, substring)
+        passed += 1
+
+    data_jump_source = "\n".join([".data", "buffer: .fill 4", ".text", "start: JMP buffer", "CALL @buffer", "JMP start"])
+    for optimize in (False, True):
+        data_jump = assemble(data_jump_source, AssembleOptions(data_base=0x40, optimize=optimize))
+        data_jump_warnings = [str(diagnostic) for diagnostic in data_jump.diagnostics]
+        if not data_jump.ok or data_jump_warnings != [
+            "<input>:4:1: warning: JMP target BUFFER is a .data label (RAM 0x0040); code runs from ROM, so this jumps to ROM 0x0040",
+            "<input>:5:1: warning: CALL target BUFFER is a .data label (RAM 0x0040); code runs from ROM, so this jumps to ROM 0x0040",
+        ]:
+            raise AssertionError(f".data jump target (optimize={optimize}): unexpected {data_jump_warnings}")
+        passed += 1
+
+    link_main = [".extern uart_putc", ".global start", "start:", "LDI $LIMIT", "CALL uart_putc", "1: JMP 1b", "equ LIMIT 40"]
+    link_uart = ["equ LIMIT 40", ".global uart_putc", "uart_putc:", "MOV RB, RA", "1: JMP 1b", "RET"]
+    main_object = build_object(AssemblyHelper(), link_main, "main.asm")
+    uart_object = build_object(AssemblyHelper(), link_uart, "uart.asm")
+    if (
+        main_object["symbols"] != ["START"]
+        or main_object["locals"] != ["__N1_0"]
+        or main_object["relocations"] != [{"symbol": "UART_PUTC", "kind": "label", "statement": 2, "file": "main.asm", "line": 5}]
+        or main_object["lines"][2]["text"] != "CALL uart_putc"
+    ):
+        raise AssertionError(f"object file: unexpected {main_object['symbols']} {main_object['locals']} {main_object['relocations']}")
+    passed += 1
+
+    for optimize in (False, True):
+        linked_lines, linked_labels, _ = link_objects(AssemblyHelper(), [json.loads(json.dumps(main_object)), uart_object], optimize=optimize)
+        joined_result = assemble("\n".join(link_main + link_uart[1:]), AssembleOptions(optimize=optimize))
+        if bytes(int(line, 2) for line in linked_lines) != joined_result.binary or linked_labels["UART_PUTC"] != joined_result.labels["UART_PUTC"]:
+            raise AssertionError(f"link (optimize={optimize}): linked bytes differ from the joined source")
+        passed += 1
+
+    # Unexported labels are private to their object, and .extern reaches constants in other files too.
+    loop_a = build_object(AssemblyHelper(), [".extern delay, TICKS", "loop: LDI $TICKS", "CALL delay", "JMP loop"], "a.asm")
+    loop_b = build_object(AssemblyHelper(), ["equ TICKS 9", ".global delay", "delay:", "loop: DEC #1", "JNE loop", "RET"], "b.asm")
+    if loop_a["relocations"][0] != {"symbol": "TICKS", "kind": "constant", "statement": 0, "file": "a.asm", "line": 2}:
+        raise AssertionError(f"object file: unexpected constant relocation {loop_a['relocations']}")
+    loop_lines, loop_labels, _ = link_objects(AssemblyHelper(), [loop_a, loop_b])
+    loop_hex = to_hex_list(loop_lines)
+    # a.asm's JMP loop loads 0x00 and b.asm's JNE loop loads 0x0F, where b.asm's loop starts.
+    if (loop_hex[0], loop_hex[8], loop_hex[16]) != ("C9", "C0", "CF") or loop_labels != {"DELAY": 0x0F}:
+        raise AssertionError(f"link of two objects defining loop: unexpected {loop_hex} {loop_labels}")
+    passed += 1
+
+    for source_lines, substring in (
+        (["CALL elsewhere"], "Undefined label reference: elsewhere"),
+        ([".global nowhere", "NOP"], "Error in obj.asm: .global NOWHERE is not defined in this file"),
+        ([".extern here", "here: NOP"], "Error in obj.asm: .extern HERE is defined in this file"),
+        ([".extern"], ".extern requires one or more comma-separated names"),
+    ):
+        try:
+            build_object(AssemblyHelper(), source_lines, "obj.asm")
+        except ValueError as exc:
+            if substring not in str(exc):
+                raise AssertionError(f"object file error: expected '{substring}', got '{exc}'")
+        else:
+            raise AssertionError(f"object file error: expected '{substring}'")
+        passed += 1
+
+    for objects, substring in (
+        ([main_object], "Error on line main.asm:5: Undefined label reference: UART_PUTC (no linked object exports it with .global)"),
+        ([loop_a, build_object(AssemblyHelper(), [".global delay", "delay: RET"], "c.asm")], "Error on line a.asm:2: Undefined constant reference: $TICKS"),
+        ([main_object, uart_object, uart_object], "Duplicate label definition: UART_PUTC"),
+        ([main_object, build_object(AssemblyHelper(), ["equ LIMIT 41", "uart_putc: RET"], "other.asm")], "Constant LIMIT is 41 in other.asm but 40 in main.asm"),
+    ):
+        try:
+            link_objects(AssemblyHelper(), objects)
+        except ValueError as exc:
+            if substring not in str(exc):
+                raise AssertionError(f"link error: expected '{substring}', got '{exc}'")
+        else:
+            raise AssertionError(f"link error: expected '{substring}'")
+        passed += 1
+
+    map_helper = AssemblyHelper()
+    map_lines, map_labels, _ = map_helper.convert_to_machine_code(
+        [".data", "counter: .fill 1", ".text", "start: LDI #5", ".org 0x10", "table: .fill 4, #1", ".padto 0x20"],
+        data_base=0x100,
+    )
+    memory_map = "".join(format_memory_map(map_helper, map_labels, len(map_lines), 0x40, "map.asm"))
+    for fragment in (
+        "  .text  0x0000-0x001F      32 bytes (27 padding)",
+        "  .data  0x0100-0x0100       1 bytes (RAM)",
+        "ROM used: 5 of 64 bytes (7.8%)",
+        "Largest free block: 0x0014-0x003F (44 bytes)",
+        "  0x0001-0x000F      15 bytes",
+        "  0x0100  .data  COUNTER",
+    ):
+        if fragment not in memory_map:
+            raise AssertionError(f"memory map: missing '{fragment}' in\n{memory_map}")
+    passed += 1
+
+    if "ROM overflow: the program is 24 bytes larger than the ROM" not in "".join(format_memory_map(map_helper, map_labels, len(map_lines), 8, "map.asm")):
+        raise AssertionError("memory map: expected a ROM overflow line")
+    passed += 1
+
+    symbol_labels = {"START": 0, "TABLE": 0x40, "LOOP": 0x40, "COUNTER": 0x100}
+    if format_symbol_file(symbol_labels, ["COUNTER"]) != ["0000 START\n", "0040 LOOP\n", "0040 TABLE\n"]:
+        raise AssertionError(f"symbol file: unexpected {format_symbol_file(symbol_labels, ['COUNTER'])}")
+    passed += 1
+
+    symbol_document = json.loads(format_symbol_json(symbol_labels, ["COUNTER"], "program.asm"))
+    if symbol_document["source"] != "program.asm" or [entry["name"] for entry in symbol_document["symbols"]] != ["START", "LOOP", "TABLE", "COUNTER"] or symbol_document["symbols"][-1] != {"name": "COUNTER", "address": 0x100, "section": ".data"}:
+        raise AssertionError(f"symbol json: unexpected {symbol_document}")
+    passed += 1
+
+    source_map_helper = AssemblyHelper()
+    source_map_helper.convert_to_machine_code(
+        [".macro INNER val", "LDI \\val", ".endm", ".macro OUTER", "NOP", "INNER #3", ".endm", "start:", "OUTER", "JMP start"],
+        source_name="map.asm",
+    )
+    source_map = source_map_helper.source_map_document("map.asm")["mappings"]
+    expected_mappings = [
+        (0, 1, 9, [{"macro": "OUTER", "file": "map.asm", "line": 5}]),
+        (1, 1, 9, [{"macro": "OUTER", "file": "map.asm", "line": 6}, {"macro": "INNER", "file": "map.asm", "line": 2}]),
+        (2, 7, 10, []),
+    ]
+    if [(entry["address"], entry["size"], entry["line"], entry["macros"]) for entry in source_map] != expected_mappings:
+        raise AssertionError(f"source map: unexpected {source_map}")
+    passed += 1
+
+    mapped_object = json.loads(json.dumps(build_object(AssemblyHelper(), [".macro TWICE", "NOP", "NOP", ".endm", "TWICE"], "obj.asm")))
+    linked_helper = AssemblyHelper()
+    link_objects(linked_helper, [mapped_object])
+    if [entry["macros"] for entry in linked_helper.source_map_document("obj.o")["mappings"]] != [
+        [{"macro": "TWICE", "file": "obj.asm", "line": 2}], [{"macro": "TWICE", "file": "obj.asm", "line": 3}]
+    ]:
+        raise AssertionError("source map: macro frames lost through an object file")
+    passed += 1
+
+    disasm_result = assemble("start: NOP\nJMP start\n.fill 20, #0xFF")
+    disasm_lines = disassemble_image(AssemblyHelper(), dict(enumerate(disasm_result.binary)), {0: ["START"]})
+    if disasm_lines[:2] != ["START:\n", "0000  00  NOP\n"] or disasm_lines[-2:] != ["0007  1F  JMP  ; -> START\n", "0008  FF  .fill 20, #0xFF\n"]:
+        raise AssertionError(f"disasm: unexpected {disasm_lines}")
+    passed += 1
+
+    hex_image = parse_intel_hex(":0200000000C539\n:0100100007E8\n:00000001FF\n")
+    if hex_image != {0: 0x00, 1: 0xC5, 0x10: 0x07}:
+        raise AssertionError(f"intel hex: unexpected {hex_image}")
+    if disassemble_image(AssemblyHelper(), hex_image)[2:] != ["\n", ".org 0x0010\n", "0010  07  JAL\n"]:
+        raise AssertionError("disasm: expected an .org block after a gap")
+    passed += 1
+
+    def emulate(source, **state):
+        result = assemble(source)
+        if not result.ok:
+            raise AssertionError(f"emulator: {result.diagnostics}")
+        emulator = Emulator(AssemblyHelper(), **state)
+        emulator.load(dict(enumerate(result.binary)))
+        return emulator, emulator.run(1000)
+
+    emulator, run_result = emulate("LDI #3\nMOV RD, RA\nSUBI #5\nMOV RB, ACC\nPUSH RB\nPOP RA\nHLT", sp=0x200)
+    if (
+        run_result.reason != "HLT at 0x0006"
+        or emulator.registers["RA"] != 0xFE
+        or str(emulator.flags) != "Z=0 N=1 C=0 V=0"
+        or emulator.sp != 0x200
+        or emulator.ram[0x200] != 0xFE
+    ):
+        raise AssertionError(f"emulator: unexpected {run_result} {emulator.format_state()}")
+    passed += 1
+
+    emulator, run_result = emulate("CALL fn\nend: JMP end\nfn: LDI #200\nMOV MARL, RA\nINC #2\nMOV M, RA\nRET")
+    if run_result.reason != "idle loop at 0x0007" or emulator.ram[202] != 200 or emulator.registers["LRL"] != 7:
+        raise AssertionError(f"emulator: unexpected {run_result} {emulator.format_state()}")
+    passed += 1
+
+    emulator, run_result = emulate("loop: INC #1\nJMP loop")
+    if run_result.reason != "step limit of 1000 reached":
+        raise AssertionError(f"emulator: expected the step limit, got {run_result}")
+    passed += 1
+
+    timing_source = "start: LDI #0\nMOV RD, RA\nloop: ADDI #1\nMOV RD, ACC\nLDI #3\nCMP RA\nJNE loop\nHLT"
+    emulator, run_result = emulate(timing_source)
+    report = emulator.format_timing_report(assemble(timing_source).labels)
+    # 2 + 3 passes of 11 bytes (JNE loads PRL/PRH first) + HLT; the two taken JNEs cost one extra cycle each.
+    if (
+        emulator.cycles != 38
+        or report[0] != "Timing: 38 cycles, 36 instructions"
+        or report[3] != "      36   94.7%       34        3  LOOP (0x0002)"
+    ):
+        raise AssertionError(f"cycles: unexpected {emulator.cycles} {report}")
+    passed += 1
+
+    trace_records = []
+    emulator, run_result = emulate("LDI #5\nMOV RD, RA\nSUBI #6\nPUSH ACC\nHLT", sp=0x0120, tracer=trace_records.append)
+    if (
+        [record["text"] for record in trace_records] != ["LDL RA, #5", "MOV RD, RA", "SUBI #6", "PUSH ACC", "HLT"]
+        or trace_records[2]["changes"] != {"ACC": [0, 0xFF], "N": [0, 1]}
+        or trace_records[3]["writes"] != [{"address": 0x0120, "value": 0xFF}]
+        or Emulator.format_trace_record(trace_records[3]) != "       4  0003  23  PUSH ACC          SP=0120->0121 [0120]=FF"
+    ):
+        raise AssertionError(f"trace: unexpected records {trace_records}")
+    passed += 1
+
+    snapshot_source = "LDI #0x09\nMOV MARH, RA\nLDI #0x40\nMOV MARL, RA\nLDI #0x07\nMOV M, RA\nLDI #0x00\nMOV MARL, RA\nMOV RB, M\nLDI #0x10\nMOV MARL, RA\nMOV M, RB\nHLT"
+    snapshot_binary = dict(enumerate(assemble(snapshot_source).binary))
+    checkpoint = Emulator(AssemblyHelper())
+    checkpoint.load(snapshot_binary)
+    checkpoint.attach(UartDevice(), 0x0900, 0x09FF)
+    checkpoint.run(8)
+    saved_state = json.loads(json.dumps(checkpoint.save_state()))
+    forked_outputs = []
+    for received in (b"A", b"B"):
+        fork = Emulator(AssemblyHelper())
+        fork.load(snapshot_binary)
+        fork_uart = UartDevice()
+        fork.attach(fork_uart, 0x0900, 0x09FF)
+        fork.restore_state(saved_state)
+        fork_uart.input.extend(received)
+        fork.run(100)
+        forked_outputs.append((bytes(fork_uart.output), fork.cycles, fork.registers["MARH"]))
+    if forked_outputs != [(b"A", 14, 0x09), (b"B", 14, 0x09)]:
+        raise AssertionError(f"snapshot: unexpected forks {forked_outputs}")
+    other = Emulator(AssemblyHelper())
+    other.load({0: 0x01})
+    try:
+        other.restore_state(saved_state)
+        raise AssertionError("snapshot: a different ROM should be rejected")
+    except ValueError as exc:
+        if "different program" not in str(exc):
+            raise
+    passed += 1
+
+    gdb_emulator, _ = emulate("LDI #5\nMOV RD, RA\nstop: ADDI #2\nMOV M, ACC\nHLT")
+    gdb_emulator.pc, gdb_emulator.halted = 0, False
+    stub = GdbStub(gdb_emulator)
+    gdb_replies = [stub.handle_packet(packet) for packet in ("Z0,2,1", "c", "p0c", "s", "p3", "c", "m10000,1", "M0,1:c1", "m0,2", "p0a", "qfThreadInfo", "vMustReplyEmpty")]
+    if gdb_replies != ["OK", "S05", "0200", "S05", "07", "S05", "07", "OK", "c188", "00", "m1", ""]:
+        raise AssertionError(f"gdb stub: unexpected replies {gdb_replies}")
+    if stub.handle_packet("k") is not None or frame("OK") != b"$OK#9a" or frame("a}b") != b"$a}]b#9d":
+        raise AssertionError("gdb stub: bad framing or kill handling")
+    debugger_end, stub_end = socket.socketpair()
+    with debugger_end, stub_end:
+        debugger_end.sendall(b"$g#zz$k#6b")
+        GdbStub(gdb_emulator).serve_connection(stub_end)
+        stub_end.close()
+        gdb_acks = debugger_end.recv(16)
+    if gdb_acks != b"-+":
+        raise AssertionError(f"gdb stub: a non-hex checksum should be refused with '-', got {gdb_acks!r}")
+    passed += 1
+
+    class SegmentDisplay(Device):
+        def __init__(self):
+            self.digits = {}
+
+        def read(self, offset):
+            return self.digits.get(offset, 0)
+
+        def write(self, offset, value):
+            self.digits[offset] = value
+
+    device_result = assemble(
+        "LDI #0x09\nMOV MARH, RA\nLDI #0x40\nMOV MARL, RA\nLDI #0x07\nMOV M, RA\n"
+        "LDI #0x00\nMOV MARL, RA\nMOV RB, M\nLDI #0x10\nMOV MARL, RA\nLDI 'O'\nMOV M, RA\nMOV M, RB\n"
+        "MOV MARH, ZERO\nLDI #0xF9\nMOV MARL, RA\nLDI #0x5B\nMOV M, RA\nMOV RA, M\nPUSH RA\nHLT"
+    )
+    if not device_result.ok:
+        raise AssertionError(f"devices: {device_result.diagnostics}")
+    uart, display = UartDevice(b"K"), SegmentDisplay()
+    device_emulator = Emulator(AssemblyHelper(), sp=0x0300)
+    device_emulator.load(dict(enumerate(device_result.binary)))
+    device_emulator.attach(uart, 0x0900, 0x09FF)
+    device_emulator.attach(display, 0x00F8, 0x00FF)
+    device_emulator.run(1000)
+    if bytes(uart.output) != b"OK" or display.digits != {1: 0x5B} or device_emulator.ram[0xF9] or device_emulator.ram[0x0300] != 0x5B:
+        raise AssertionError(f"devices: unexpected {bytes(uart.output)} {display.digits}")
+    try:
+        device_emulator.attach(Device(), 0x0980, 0x0A00)
+        raise AssertionError("devices: overlapping ranges should be rejected")
+    except ValueError as exc:
+        if "overlaps UartDevice at 0x0900-0x09FF" not in str(exc):
+            raise
+    passed += 1
+
+    debug_helper = AssemblyHelper()
+    debug_binary, debug_labels, _ = debug_helper.convert_to_machine_code(
+        [
+            ".macro BUMP",
+            "    ADD RA",
+            ".endm",
+            ".data",
+            "counter: .fill 1",
+            ".text",
+            "start: LDI #0",
+            "MOV RD, RA",
+            "loop: LDI #1",
+            "BUMP",
+            "MOV RD, ACC",
+            "LDI @counter",
+            "MOV MARL, RA",
+            "MOV M, RD",
+            "LDI #3",
+            "CMP RA",
+            "JNE loop",
+            "HLT",
+        ],
+        source_name="dbg.asm",
+    )
+    debug_emulator = Emulator(debug_helper)
+    debug_emulator.load({address: int(line, 2) for address, line in enumerate(debug_binary)})
+    debugger = Debugger(
+        debug_emulator,
+        debug_labels,
+        debug_helper.source_map_document("dbg.asm")["mappings"],
+        debug_helper.data_labels,
+    )
+    debugger.execute("break loop")
+    debugger.execute("watch [counter]")
+    first_stop = debugger.execute("continue")
+    second_stop = debugger.execute("c")
+    step_stop = debugger.execute("step")
+    if (
+        first_stop[:2] != ["Stopped: breakpoint at 0x0002 after 2 steps", "0x0002 <LOOP>  LDL RA, #1"]
+        or first_stop[-1] != "  watch 1: [counter] = 0 (0x00)"
+        or second_stop[-1] != "  watch 1: [counter] = 1 (0x01)"
+        or step_stop[1:4] != ["0x0003  ADD RA", "  dbg.asm:10: ADD RA", "    in macro BUMP at dbg.asm:2"]
+    ):
+        raise AssertionError(f"debugger: unexpected stops {first_stop} {second_stop} {step_stop}")
+    debugger.execute("delete loop")
+    final_stop = debugger.execute("continue")
+    if final_stop[0] != "Stopped: HLT at 0x0011 after 30 steps" or debugger.execute("p [counter] + RD") != ["[counter] + RD = 6 (0x06)"]:
+        raise AssertionError(f"debugger: unexpected final state {final_stop}")
+    if debugger.execute("break nowhere") != ["Error: Unknown constant in expression: nowhere"]:
+        raise AssertionError("debugger: an unknown label should be reported")
+    passed += 1
+
+    # A --symbols file is what the debugger reads for a bare ROM image, so a breakpoint can name a label.
+    with tempfile.TemporaryDirectory() as tmpdir:
+        symbols_path = Path(tmpdir) / "dbg.sym"
+        symbols_path.write_text("".join(format_symbol_file(debug_labels, list(debug_helper.data_labels))), encoding="utf-8")
+        image_labels = {name: address for address, names in read_symbol_file(str(symbols_path)).items() for name in names}
+    if "COUNTER" in image_labels or image_labels.get("LOOP") != debug_labels["LOOP"]:
+        raise AssertionError(f"symbol file: unexpected labels for the debugger {image_labels}")
+    image_emulator = Emulator(AssemblyHelper())
+    image_emulator.load({address: int(line, 2) for address, line in enumerate(debug_binary)})
+    image_debugger = Debugger(image_emulator, image_labels)
+    image_debugger.execute("break loop")
+    image_stop = image_debugger.execute("continue")
+    if image_stop[:2] != ["Stopped: breakpoint at 0x0002 after 2 steps", "0x0002 <LOOP>  LDL RA, #1"]:
+        raise AssertionError(f"symbol file: breakpoint by label did not stop at LOOP: {image_stop}")
+    passed += 1
+
+    check_helper = AssemblyHelper()
+    if check_helper.evaluate_expression("0 <= 5 < 8 and not 0") != 1 or check_helper.evaluate_expression("2 == 3 or 1 > 2") != 0:
+        raise AssertionError("expressions: comparisons and boolean operators should give 1 or 0")
+    check_source = [
+        "equ EXPECTED 8",
+        ".data",
+        "total: .fill 1",
+        ".text",
+        "HLT",
+        ".test adds_one",
+        "LDI #7",
+        "MOV RD, RA",
+        "ADDI #1",
+        "MOV RB, ACC",
+        "LDI @total",
+        "MOV MARL, RA",
+        "MOV M, RB",
+        '.assert ACC == EXPECTED and [total] == 8, "7 + 1"',
+        ".endtest",
+        ".test wrong",
+        "LDI #2",
+        ".assert RA == 3",
+        ".endtest",
+    ]
+    check_binary, check_labels, check_constants = check_helper.convert_to_machine_code(check_source, source_name="t.asm")
+    if check_helper.last_tests or check_helper.last_assertions or "__CHECK0" in check_labels:
+        raise AssertionError(".test: blocks should be left out unless include_tests is set")
+    check_helper.include_tests = True
+    check_binary, check_labels, check_constants = check_helper.convert_to_machine_code(check_source, source_name="t.asm")
+    check_image = {address: int(line, 2) for address, line in enumerate(check_binary)}
+
+    def make_check_emulator():
+        emulator = Emulator(check_helper, symbols={**check_constants, **check_labels})
+        emulator.load(check_image)
+        emulator.add_assertions(check_helper.last_assertions)
+        return emulator
+
+    check_lines = format_outcomes(run_tests(make_check_emulator, check_helper.last_tests, 1000))
+    if (
+        [test.name for test in check_helper.last_tests] != ["adds_one", "wrong"]
+        or check_lines[0] != "PASS  adds_one (8 steps, 8 cycles)"
+        or check_lines[1] != "FAIL  wrong (t.asm:16): assertion failed at 0x000A: t.asm:18: RA == 3 [RA=0x02]"
+        or check_lines[2] != "2 tests, 1 passed, 1 failed"
+    ):
+        raise AssertionError(f".test: unexpected results {check_lines}")
+    emulator, run_result = emulate('LDI #3\n.assert RA == 4, "three"\nHLT')
+    if run_result.reason != "HLT at 0x0001":
+        raise AssertionError("run: asserts only reach the emulator through add_assertions")
+    assertion_helper = AssemblyHelper()
+    assertion_binary, _, _ = assertion_helper.convert_to_machine_code(['LDI #3', '.assert RA == 4, "three"', "HLT"])
+    emulator = Emulator(assertion_helper)
+    emulator.load({address: int(line, 2) for address, line in enumerate(assertion_binary)})
+    emulator.add_assertions(assertion_helper.last_assertions)
+    failed_result, resumed_result = emulator.run(100), emulator.run(100)
+    if (
+        failed_result.reason != "assertion failed at 0x0001: <input>:2: RA == 4 (three) [RA=0x03]"
+        or resumed_result.reason != "HLT at 0x0001"
+    ):
+        raise AssertionError(f".assert: unexpected stops {failed_result} {resumed_result}")
+    for bad_source, expected in [
+        ([".assert RX == 1"], "Unknown constant in expression: RX"),
+        ([".test a", ".test b"], ".test blocks cannot nest"),
+        ([".endtest"], ".endtest without a matching .test"),
+        ([".test a", "NOP"], "is missing its .endtest"),
+    ]:
+        try:
+            AssemblyHelper().convert_to_machine_code(bad_source)
+        except ValueError as exc:
+            if expected not in str(exc):
+                raise AssertionError(f".assert/.test: unexpected error {exc}")
+        else:
+            raise AssertionError(f".assert/.test: {bad_source} should be rejected")
+    passed += 1
+
+    expect_assembly("start: LDI #3\nJMP start", "C3 ; LDI #3\nC0 30 A8 C0 30 B0 1F")
+    expect_assembly("JMP nowhere", diagnostics=["<input>:1:1: error: Undefined label reference: nowhere"])
+    byte_problems = compare_assembly("LDI #3\nHLT\nNOP", "C3 00")
+    if byte_problems != [
+        "bytes differ (expected 2 bytes, got 3):",
+        "  addr  expected  actual  source",
+        "  0001  00        01      <input>:2: HLT",
+        "  0002  --        00      <input>:3: NOP",
+    ]:
+        raise AssertionError(f"asmtest: unexpected byte diff {byte_problems}")
+    if compare_assembly("JMP nowhere", "00")[:2] != ["assembly failed:", "  <input>:1:1: error: Undefined label reference: nowhere"]:
+        raise AssertionError("asmtest: a failed build should be reported when no diagnostics are expected")
+    with tempfile.TemporaryDirectory() as golden_dir:
+        golden_path = str(Path(golden_dir) / "program.golden")
+        expect_golden("LDI #3\nHLT", golden_path)
+        expect_golden("LDI #3\nHLT", golden_path)
+        try:
+            expect_golden("LDI #4\nHLT", golden_path)
+        except AssertionError as exc:
+            if "-0000: C3 01\n+0000: C4 01" not in str(exc):
+                raise AssertionError(f"asmtest: unexpected golden diff {exc}")
+        else:
+            raise AssertionError("asmtest: a changed binary should fail the golden check")
+    passed += 1
+
+    class FakeProgrammer:
+        """Records what the host sends, as the Arduino programmer receives it."""
+
+        def __init__(self):
+            self.received = bytearray()
+            self.flushes = 0
+
+        def write(self, data):
+            self.received.extend(data)
+
+        def flush(self):
+            self.flushes += 1
+
+    flash_image = {address: address & 0xFF for address in range(0x3C, 0x46)}
+    flash_image.update({0x80: 0x11, 0x81: 0x22})
+    flash_data = flatten_image(flash_image, 0xFF)
+    if len(flash_data) != 0x82 or flash_data[:0x3C] != b"\xFF" * 0x3C or flash_data[0x3C:0x46] != bytes(range(0x3C, 0x46)):
+        raise AssertionError(f"flash: unexpected flattened image {flash_data.hex()}")
+    programmer = FakeProgrammer()
+    progress = []
+    sent = SerialFlasher(programmer, ready_delay=0).flash(flash_data, lambda done, total: progress.append((done, total)))
+    if sent != 0x82 or bytes(programmer.received) != b"L" + flash_data or progress != [(64, 130), (128, 130), (130, 130)]:
+        raise AssertionError(f"flash: unexpected load {bytes(programmer.received[:8])} {progress}")
+    passed += 1
+
     smoke_examples = [
         ROOT / "examples" / "fpga" / "gpio_ssd1306_init_only.asm",
         ROOT / "examples" / "fpga" / "gpio_ssd1306_fill_screen.asm",